@@ -0,0 +1,11 @@
+// storage.go sets up the storage of uploaded files.
+package config
+
+import (
+	"github.com/axkeyz/gacha-api/internal/storage"
+)
+
+// SetupStorage returns the storage that uploaded files are kept in.
+func SetupStorage() storage.Storage {
+	return storage.NewLocal()
+}
@@ -1,5 +1,6 @@
 CREATE EXTENSION pgcrypto;
 CREATE EXTENSION citext;
+CREATE EXTENSION btree_gist;
 
 CREATE TABLE "staff_role" (
     id SERIAL PRIMARY KEY,
@@ -57,10 +58,23 @@ VALUES (1,'xah', crypt('xConfused9', gen_salt('bf')), 'xahkun@gmail.com');
 
 INSERT into staff_action (name) VALUES ('staff-create'), ('staff-update'), ('staffrole-create'),
 ('staffrole-update'), ('stafflog-read'), ('staffaction-create'), ('staffaction-update'), ('staff-action-delete'),
-('staffpermission-create'), ('staffpermission-update'), ('staffpermission-delete');
+('staffpermission-create'), ('staffpermission-update'), ('staffpermission-delete'),
+('currency-create'), ('currency-update'), ('currency-issue'), ('currency-report'),
+('exchange-create'), ('exchange-update'), ('exchange-execute'),
+('banner-create'), ('banner-update'), ('banner-delete'), ('summon-create'), ('spark-exchange'),
+('seed-rotate'), ('summon-verify'), ('duplicate-update'), ('summon-refund'),
+('hero-create'), ('hero-update'), ('reference-create'), ('reference-update'), ('reference-delete'),
+('multiplier-update'), ('advantage-update'),
+('action-create'), ('action-update'), ('action-delete'), ('skillaction-update'),
+('growth-update'), ('growth-delete'), ('summon-level'),
+('revision-create'), ('revision-update'), ('revision-approve'), ('revision-publish'), ('revision-rollback'),
+('art-upload'), ('art-delete'), ('art-link'), ('sound-upload'), ('sound-update'), ('sound-delete'),
+('locale-update'), ('translation-update');
 
 INSERT INTO staff_permission (staff_role_id, staff_action_id) VALUES (1,1), (1,2), (1,3), (1,4), (1,5),
-(1,6), (1,7), (1,8), (1,9), (1,10), (1,11);
+(1,6), (1,7), (1,8), (1,9), (1,10), (1,11), (1,12), (1,13), (1,14), (1,15), (1,16), (1,17), (1,18), (1,19), (1,20), (1,21), (1,22), (1,23), (1,24), (1,25), (1,26), (1,27), (1,28), (1,29), (1,30), (1,31), (1,32), (1,33), (1,34), (1,35), (1,36), (1,37), (1,38), (1,39), (1,40), (1,41),
+(1,42), (1,43), (1,44), (1,45), (1,46), (1,47), (1,48), (1,49), (1,50), (1,51), (1,52), (1,53), (1,54),
+(28,54);
 
 -- Create player table: This table records all users (players) of the game
 CREATE TABLE "player" (
@@ -146,6 +160,51 @@ CREATE TABLE "guild_member_history" (
     CONSTRAINT fk_guild_memberhistory_role FOREIGN KEY (guild_role_id) REFERENCES "guild_role" (id)
 );
 
+-- Create hero reference tables: the classes, rarities & elements that heroes are assigned.
+-- Rarities are also the rarity tiers of banner loot tables, where the highest rarity (id) is
+-- the top tier that pity applies to
+CREATE TABLE "hero_class" (
+    id INTEGER PRIMARY KEY CHECK (id > 0),
+    name VARCHAR(25) UNIQUE NOT NULL,
+    display_name TEXT NOT NULL,
+    icon TEXT,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE "hero_rarity" (
+    id INTEGER PRIMARY KEY CHECK (id > 0),
+    name VARCHAR(25) UNIQUE NOT NULL,
+    display_name TEXT NOT NULL,
+    icon TEXT,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE "hero_element" (
+    id INTEGER PRIMARY KEY CHECK (id > 0),
+    name VARCHAR(25) UNIQUE NOT NULL,
+    display_name TEXT NOT NULL,
+    icon TEXT,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO hero_class (id, name, display_name, sort_order) VALUES (1, 'warrior', 'Warrior', 1),
+(2, 'knight', 'Knight', 2), (3, 'ranger', 'Ranger', 3), (4, 'mage', 'Mage', 4),
+(5, 'healer', 'Healer', 5), (6, 'assassin', 'Assassin', 6);
+
+INSERT INTO hero_rarity (id, name, display_name, sort_order) VALUES (1, 'common', 'Common', 1),
+(2, 'uncommon', 'Uncommon', 2), (3, 'rare', 'Rare', 3), (4, 'epic', 'Epic', 4),
+(5, 'legendary', 'Legendary', 5);
+
+INSERT INTO hero_element (id, name, display_name, sort_order) VALUES (1, 'fire', 'Fire', 1),
+(2, 'water', 'Water', 2), (3, 'earth', 'Earth', 3), (4, 'wind', 'Wind', 4),
+(5, 'light', 'Light', 5), (6, 'dark', 'Dark', 6);
+
 -- Create hero tables
 CREATE TABLE "hero" (
     id SERIAL PRIMARY KEY,
@@ -155,7 +214,10 @@ CREATE TABLE "hero" (
     element INTEGER NOT NULL,
     is_active BOOLEAN NOT NULL DEFAULT FALSE,
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_hero_class FOREIGN KEY (class) REFERENCES "hero_class" (id),
+    CONSTRAINT fk_hero_rarity FOREIGN KEY (rarity) REFERENCES "hero_rarity" (id),
+    CONSTRAINT fk_hero_element FOREIGN KEY (element) REFERENCES "hero_element" (id)
 );
 
 CREATE TABLE "hero_background" (
@@ -191,7 +253,7 @@ CREATE TABLE "hero_skill" (
 CREATE UNIQUE INDEX "hero_skill_id" ON hero_skill (id, hero_id);
 
 CREATE TABLE "hero_skill_multiplier" (
-    hero_skill_id INTEGER NOT NULL,
+    hero_skill_id INTEGER PRIMARY KEY,
     hero_id INTEGER NOT NULL,
     power DECIMAL NOT NULL,
     attack DECIMAL NOT NULL,
@@ -206,17 +268,93 @@ CREATE TABLE "hero_skill_multiplier" (
     CONSTRAINT fk_hero_skill_multiplier FOREIGN KEY (hero_skill_id, hero_id) REFERENCES "hero_skill" (id, hero_id)
 );
 
+-- Growth curves of every hero of a rarity, or of a single hero (which takes precedence): the
+-- multiplier of attack, health & defence by level. Linear & exponential curves grow by rate per
+-- level, and piecewise curves interpolate between points ([{"Level": n, "Multiplier": x}])
+CREATE TABLE "growth_curve" (
+    id SERIAL PRIMARY KEY,
+    rarity INTEGER UNIQUE,
+    hero_id INTEGER UNIQUE,
+    type VARCHAR(11) NOT NULL CHECK (type IN ('linear', 'exponential', 'piecewise')),
+    rate DECIMAL NOT NULL DEFAULT 0 CHECK (rate >= 0),
+    points JSONB NOT NULL DEFAULT '[]',
+    max_level INTEGER NOT NULL CHECK (max_level BETWEEN 1 AND 200),
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((rarity IS NULL) <> (hero_id IS NULL)),
+    CONSTRAINT fk_growth_curve_rarity FOREIGN KEY (rarity) REFERENCES "hero_rarity" (id),
+    CONSTRAINT fk_growth_curve_hero FOREIGN KEY (hero_id) REFERENCES "hero" (id)
+);
+
+-- Revisions of a hero's content (hero, background, base stats, skills & skill multipliers as
+-- JSON). Drafts are approved by another member of staff, then published live; the revision
+-- that was live is archived, and at most one revision of a hero is published at a time
+CREATE TABLE "hero_revision" (
+    id SERIAL PRIMARY KEY,
+    hero_id INTEGER NOT NULL,
+    number INTEGER NOT NULL,
+    status VARCHAR(9) NOT NULL DEFAULT 'draft' CHECK (status IN ('draft', 'approved', 'published', 'archived')),
+    content JSONB NOT NULL,
+    note TEXT,
+    rollback_of INTEGER,
+    created_by INTEGER NOT NULL,
+    approved_by INTEGER,
+    published_by INTEGER,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    approved_at TIMESTAMP,
+    published_at TIMESTAMP,
+    UNIQUE (hero_id, number),
+    CONSTRAINT fk_hero_revision_hero FOREIGN KEY (hero_id) REFERENCES "hero" (id),
+    CONSTRAINT fk_hero_revision_rollback FOREIGN KEY (rollback_of) REFERENCES "hero_revision" (id),
+    CONSTRAINT fk_hero_revision_created_by FOREIGN KEY (created_by) REFERENCES "staff" (id),
+    CONSTRAINT fk_hero_revision_approved_by FOREIGN KEY (approved_by) REFERENCES "staff" (id),
+    CONSTRAINT fk_hero_revision_published_by FOREIGN KEY (published_by) REFERENCES "staff" (id)
+);
+
+CREATE UNIQUE INDEX "hero_revision_published" ON hero_revision (hero_id) WHERE status = 'published';
+
+-- Element advantage matrix: the damage multiplier & hit chance bonus (percent) of an attacking
+-- element against a defending element. Pairs without a row are neutral (1x damage, no bonus)
+CREATE TABLE "element_advantage" (
+    attacker_element INTEGER NOT NULL,
+    defender_element INTEGER NOT NULL,
+    damage DECIMAL NOT NULL DEFAULT 1 CHECK (damage >= 0),
+    hit_chance INTEGER NOT NULL DEFAULT 0 CHECK (hit_chance BETWEEN -100 AND 100),
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (attacker_element, defender_element),
+    CONSTRAINT fk_element_advantage_attacker FOREIGN KEY (attacker_element) REFERENCES "hero_element" (id) ON DELETE CASCADE,
+    CONSTRAINT fk_element_advantage_defender FOREIGN KEY (defender_element) REFERENCES "hero_element" (id) ON DELETE CASCADE
+);
+
+-- Fire > Wind > Earth > Water > Fire, and Light & Dark are strong against each other
+INSERT INTO element_advantage (attacker_element, defender_element, damage, hit_chance) VALUES
+(1, 4, 1.1, 15), (4, 3, 1.1, 15), (3, 2, 1.1, 15), (2, 1, 1.1, 15),
+(4, 1, 0.9, -15), (3, 4, 0.9, -15), (2, 3, 0.9, -15), (1, 2, 0.9, -15),
+(5, 6, 1.1, 15), (6, 5, 1.1, 15);
+
+-- Skill actions: a named, typed action with JSON params that are validated against the schema
+-- of the type (see battle.ActionTypes) on save
 CREATE TABLE "hero_action_possible" (
     id SERIAL PRIMARY KEY,
-    name VARCHAR(15) UNIQUE NOT NULL
+    name VARCHAR(25) UNIQUE NOT NULL,
+    type VARCHAR(15) NOT NULL CHECK (type IN ('damage', 'heal', 'buff', 'debuff', 'cleanse', 'stun', 'summon')),
+    params JSONB NOT NULL DEFAULT '{}',
+    description TEXT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
 );
 
+INSERT INTO hero_action_possible (name, type, params, description) VALUES
+('strike', 'damage', '{"multiplier": 1, "hits": 1}', 'A single hit'),
+('mend', 'heal', '{"amount": 15, "target": "ally"}', 'Heals the weakest ally'),
+('attack-break', 'debuff', '{"stat": "attack", "amount": 50, "turns": 2}', 'Halves attack'),
+('stun', 'stun', '{"turns": 1}', 'Skips the next turn');
+
 CREATE TABLE "hero_action_allowed" (
     id SERIAL PRIMARY KEY,
     execution_order INTEGER NOT NULL,
     hero_skill_id INTEGER NOT NULL,
     hero_action_id INTEGER NOT NULL,
-    chance INTEGER NOT NULL,
+    chance INTEGER NOT NULL CHECK (chance BETWEEN 0 AND 100),
     CONSTRAINT fk_hero_action_allowed_skill FOREIGN KEY (hero_skill_id) REFERENCES "hero_skill" (id),
     CONSTRAINT fk_hero_action_allowed_possible FOREIGN KEY (hero_action_id) REFERENCES "hero_action_possible" (id)
 );
@@ -227,11 +365,152 @@ CREATE TABLE "currency" (
     name TEXT NOT NULL UNIQUE,
     url TEXT NOT NULL UNIQUE,
     description TEXT NOT NULL,
+    max_balance INTEGER CHECK (max_balance > 0),
+    split_paid BOOLEAN NOT NULL DEFAULT FALSE,
+    spend_priority VARCHAR(4) NOT NULL DEFAULT 'free' CHECK (spend_priority IN ('free', 'paid')),
     is_active BOOLEAN DEFAULT FALSE,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Uploaded images, stored (with a PNG thumbnail) under the SHA-256 hash of their content so that
+-- the same image is only stored once
+CREATE TABLE "art_asset" (
+    id SERIAL PRIMARY KEY,
+    hash CHAR(64) NOT NULL UNIQUE,
+    file_name TEXT NOT NULL UNIQUE,
+    thumbnail TEXT NOT NULL UNIQUE,
+    original_name TEXT NOT NULL,
+    mime_type VARCHAR(10) NOT NULL CHECK (mime_type IN ('image/png', 'image/jpeg', 'image/gif')),
+    size INTEGER NOT NULL CHECK (size > 0),
+    width INTEGER NOT NULL CHECK (width BETWEEN 16 AND 4096),
+    height INTEGER NOT NULL CHECK (height BETWEEN 16 AND 4096),
+    uploaded_by INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_art_asset_uploaded_by FOREIGN KEY (uploaded_by) REFERENCES "staff" (id)
+);
+
+-- Art of a hero (icon, portrait or splash), skill or currency (icon), at most one per purpose
+CREATE TABLE "art_link" (
+    id SERIAL PRIMARY KEY,
+    art_asset_id INTEGER NOT NULL,
+    hero_id INTEGER,
+    hero_skill_id INTEGER,
+    currency_id INTEGER,
+    purpose VARCHAR(8) NOT NULL CHECK (purpose IN ('icon', 'portrait', 'splash')),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (hero_id, purpose),
+    UNIQUE (hero_skill_id, purpose),
+    UNIQUE (currency_id, purpose),
+    CHECK (num_nonnulls(hero_id, hero_skill_id, currency_id) = 1),
+    CHECK (purpose = 'icon' OR hero_id IS NOT NULL),
+    CONSTRAINT fk_art_link_asset FOREIGN KEY (art_asset_id) REFERENCES "art_asset" (id),
+    CONSTRAINT fk_art_link_hero FOREIGN KEY (hero_id) REFERENCES "hero" (id) ON DELETE CASCADE,
+    CONSTRAINT fk_art_link_skill FOREIGN KEY (hero_skill_id) REFERENCES "hero_skill" (id) ON DELETE CASCADE,
+    CONSTRAINT fk_art_link_currency FOREIGN KEY (currency_id) REFERENCES "currency" (id) ON DELETE CASCADE
+);
+
+-- Uploaded voice lines, sound effects & music of a hero or skill (or neither). Files are stored
+-- under the SHA-256 hash of their content, and can be shared by several sound assets. Voice lines
+-- are tagged by language (e.g. en, ja or pt-BR) for voice packs
+CREATE TABLE "sound_asset" (
+    id SERIAL PRIMARY KEY,
+    hash CHAR(64) NOT NULL,
+    file_name TEXT NOT NULL,
+    original_name TEXT NOT NULL,
+    mime_type VARCHAR(10) NOT NULL CHECK (mime_type IN ('audio/wav', 'audio/ogg', 'audio/mpeg')),
+    size INTEGER NOT NULL CHECK (size > 0),
+    category VARCHAR(5) NOT NULL CHECK (category IN ('voice', 'sfx', 'music')),
+    language VARCHAR(6),
+    hero_id INTEGER,
+    hero_skill_id INTEGER,
+    duration DECIMAL NOT NULL CHECK (duration >= 0),
+    sample_rate INTEGER NOT NULL CHECK (sample_rate > 0),
+    channels INTEGER NOT NULL CHECK (channels > 0),
+    uploaded_by INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (category != 'voice' OR (hero_id IS NOT NULL AND language IS NOT NULL)),
+    CONSTRAINT fk_sound_asset_hero FOREIGN KEY (hero_id) REFERENCES "hero" (id) ON DELETE CASCADE,
+    CONSTRAINT fk_sound_asset_skill FOREIGN KEY (hero_skill_id, hero_id) REFERENCES "hero_skill" (id, hero_id) ON DELETE CASCADE,
+    CONSTRAINT fk_sound_asset_uploaded_by FOREIGN KEY (uploaded_by) REFERENCES "staff" (id)
+);
+
+CREATE INDEX "sound_asset_hash" ON sound_asset (hash);
+
+-- Locales that hero, skill & currency text is translated into. Text without a translation falls
+-- back to the fallback locale (and its fallback, and so on), then to the source text of the
+-- default locale, which is stored in the hero, hero_background, hero_skill & currency tables
+CREATE TABLE "locale" (
+    code VARCHAR(6) PRIMARY KEY,
+    name TEXT NOT NULL,
+    fallback VARCHAR(6),
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (fallback != code),
+    CHECK (NOT is_default OR fallback IS NULL),
+    CONSTRAINT fk_locale_fallback FOREIGN KEY (fallback) REFERENCES "locale" (code)
+);
+
+CREATE UNIQUE INDEX "locale_default" ON locale (is_default) WHERE is_default;
+
+INSERT INTO locale (code, name, fallback, is_default) VALUES
+('en', 'English', NULL, TRUE), ('ja', 'Japanese', NULL, FALSE), ('fr', 'French', NULL, FALSE),
+('es', 'Spanish', NULL, FALSE), ('es-MX', 'Spanish (Mexico)', 'es', FALSE), ('pt-BR', 'Portuguese (Brazil)', NULL, FALSE);
+
+-- Translations of a field of hero, skill or currency text (by the id of the hero, skill or
+-- currency) into a locale, with the source text that was translated so that translations are
+-- reported as outdated when the source text changes
+CREATE TABLE "translation" (
+    locale VARCHAR(6) NOT NULL,
+    field VARCHAR(22) NOT NULL CHECK (field IN ('hero_name', 'hero_short_description', 'hero_long_description', 'skill_description', 'currency_description')),
+    source_id INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    source_text TEXT NOT NULL,
+    updated_by INTEGER NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (locale, field, source_id),
+    CONSTRAINT fk_translation_locale FOREIGN KEY (locale) REFERENCES "locale" (code) ON DELETE CASCADE,
+    CONSTRAINT fk_translation_updated_by FOREIGN KEY (updated_by) REFERENCES "staff" (id)
+);
+
+-- Exchanges convert a bundle of input currencies (and duplicate heroes) into a bundle of output currencies
+CREATE TABLE "exchange" (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    description TEXT NOT NULL,
+    limit_count INTEGER CHECK (limit_count > 0),
+    limit_hours INTEGER CHECK (limit_hours > 0),
+    run_start TIMESTAMP,
+    run_end TIMESTAMP,
+    is_active BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CHECK (run_end > run_start)
+);
+
+CREATE TABLE "exchange_item" (
+    exchange_id INTEGER NOT NULL,
+    currency_id INTEGER NOT NULL,
+    is_input BOOLEAN NOT NULL,
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    PRIMARY KEY (exchange_id, currency_id, is_input),
+    CONSTRAINT fk_exchange_item_exchange FOREIGN KEY (exchange_id) REFERENCES "exchange" (id) ON DELETE CASCADE,
+    CONSTRAINT fk_exchange_item_currency FOREIGN KEY (currency_id) REFERENCES "currency" (id)
+);
+
+-- Exchanges can also take duplicate heroes as inputs: amount copies of the hero on top of the
+-- copy that the player keeps
+CREATE TABLE "exchange_hero" (
+    exchange_id INTEGER NOT NULL,
+    hero_id INTEGER NOT NULL,
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    PRIMARY KEY (exchange_id, hero_id),
+    CONSTRAINT fk_exchange_hero_exchange FOREIGN KEY (exchange_id) REFERENCES "exchange" (id) ON DELETE CASCADE,
+    CONSTRAINT fk_exchange_hero_hero FOREIGN KEY (hero_id) REFERENCES "hero" (id)
+);
+
 CREATE TABLE "ring_skill" (
     id SERIAL PRIMARY KEY,
     name TEXT NOT NULL UNIQUE
@@ -244,13 +523,88 @@ CREATE TABLE "ring" (
     CONSTRAINT fk_ring_skill FOREIGN KEY (skill_id) REFERENCES "ring_skill" (id)
 );
 
+-- Hero banners feature one or more heroes. Banners switch on (is_active) automatically between
+-- run_start & run_end while enabled. Enabled featured banners cannot overlap in the same slot.
+-- Pulls on a banner with a spark currency earn spark points, which are exchanged for featured
+-- heroes, and expire or convert to another currency once run_end passes.
 CREATE TABLE "hero_banner" (
     id SERIAL PRIMARY KEY,
-    hero_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    banner_type VARCHAR(15) NOT NULL DEFAULT 'featured' CHECK (banner_type IN ('featured', 'standard')),
+    slot INTEGER NOT NULL DEFAULT 1,
+    is_enabled BOOLEAN NOT NULL DEFAULT FALSE,
     is_active BOOLEAN DEFAULT FALSE,
     run_start TIMESTAMP,
     run_end TIMESTAMP,
-    CONSTRAINT fk_hero_banner_hero FOREIGN KEY (hero_id) REFERENCES "hero" (id)
+    cost_currency_id INTEGER NOT NULL,
+    cost_single INTEGER NOT NULL CHECK (cost_single > 0),
+    cost_multi INTEGER NOT NULL CHECK (cost_multi > 0),
+    pity_soft_start INTEGER NOT NULL DEFAULT 0 CHECK (pity_soft_start >= 0),
+    pity_soft_step DECIMAL(7,4) NOT NULL DEFAULT 0 CHECK (pity_soft_step >= 0),
+    pity_hard INTEGER NOT NULL DEFAULT 0 CHECK (pity_hard >= 0),
+    featured_rate DECIMAL(7,4) NOT NULL DEFAULT 0 CHECK (featured_rate >= 0 AND featured_rate <= 100),
+    spark_currency_id INTEGER UNIQUE,
+    spark_per_pull INTEGER NOT NULL DEFAULT 0 CHECK (spark_per_pull >= 0),
+    spark_cost INTEGER NOT NULL DEFAULT 0 CHECK (spark_cost >= 0),
+    spark_on_end VARCHAR(7) NOT NULL DEFAULT 'expire' CHECK (spark_on_end IN ('expire', 'convert')),
+    spark_convert_currency_id INTEGER,
+    spark_convert_rate INTEGER NOT NULL DEFAULT 0 CHECK (spark_convert_rate >= 0),
+    spark_settled_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CHECK (run_end > run_start),
+    CONSTRAINT fk_hero_banner_cost FOREIGN KEY (cost_currency_id) REFERENCES "currency" (id),
+    CONSTRAINT fk_hero_banner_spark FOREIGN KEY (spark_currency_id) REFERENCES "currency" (id),
+    CONSTRAINT fk_hero_banner_spark_convert FOREIGN KEY (spark_convert_currency_id) REFERENCES "currency" (id),
+    CONSTRAINT no_overlapping_featured_banner EXCLUDE USING gist (slot WITH =, tsrange(run_start, run_end) WITH &&)
+        WHERE (banner_type = 'featured' AND is_enabled)
+);
+
+CREATE TABLE "hero_banner_hero" (
+    hero_banner_id INTEGER NOT NULL,
+    hero_id INTEGER NOT NULL,
+    weight INTEGER NOT NULL DEFAULT 1 CHECK (weight > 0),
+    is_featured BOOLEAN NOT NULL DEFAULT TRUE,
+    PRIMARY KEY (hero_banner_id, hero_id),
+    CONSTRAINT fk_hero_banner_hero_banner FOREIGN KEY (hero_banner_id) REFERENCES "hero_banner" (id) ON DELETE CASCADE,
+    CONSTRAINT fk_hero_banner_hero_hero FOREIGN KEY (hero_id) REFERENCES "hero" (id)
+);
+
+-- The loot table of a banner: the rate (percent) of each rarity tier. Heroes within a tier are
+-- picked from the banner's heroes of that rarity by weight.
+CREATE TABLE "hero_banner_rate" (
+    hero_banner_id INTEGER NOT NULL,
+    rarity INTEGER NOT NULL,
+    rate DECIMAL(7,4) NOT NULL CHECK (rate >= 0 AND rate <= 100),
+    PRIMARY KEY (hero_banner_id, rarity),
+    CONSTRAINT fk_hero_banner_rate_banner FOREIGN KEY (hero_banner_id) REFERENCES "hero_banner" (id) ON DELETE CASCADE,
+    CONSTRAINT fk_hero_banner_rate_rarity FOREIGN KEY (rarity) REFERENCES "hero_rarity" (id)
+);
+
+-- What happens when a player summons a hero they already own, by rarity: keep a separate copy,
+-- raise the limit break of the copy they own (up to max_limit_break), or convert it to currency.
+-- Rarities without a policy keep duplicates.
+CREATE TABLE "duplicate_policy" (
+    rarity INTEGER PRIMARY KEY,
+    policy VARCHAR(11) NOT NULL DEFAULT 'keep' CHECK (policy IN ('keep', 'limit-break', 'convert')),
+    max_limit_break INTEGER NOT NULL DEFAULT 0 CHECK (max_limit_break >= 0),
+    currency_id INTEGER,
+    amount INTEGER NOT NULL DEFAULT 0 CHECK (amount >= 0),
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_duplicate_policy_currency FOREIGN KEY (currency_id) REFERENCES "currency" (id),
+    CONSTRAINT fk_duplicate_policy_rarity FOREIGN KEY (rarity) REFERENCES "hero_rarity" (id)
+);
+
+-- Published odds of each hero banner. A new version is published whenever an enabled banner's
+-- loot table changes (table_hash), generated from the same data the summon engine uses.
+CREATE TABLE "hero_banner_odds" (
+    hero_banner_id INTEGER NOT NULL,
+    version INTEGER NOT NULL,
+    table_hash CHAR(64) NOT NULL,
+    disclosure JSONB NOT NULL,
+    published_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (hero_banner_id, version),
+    CONSTRAINT fk_hero_banner_odds_banner FOREIGN KEY (hero_banner_id) REFERENCES "hero_banner" (id) ON DELETE CASCADE
 );
 
 -- Add player heroes & resources
@@ -258,6 +612,7 @@ CREATE TABLE "player_currency" (
     player_id INTEGER NOT NULL,
     currency_id INTEGER NOT NULL,
     amount INTEGER NOT NULL,
+    paid_amount INTEGER NOT NULL DEFAULT 0,
     CONSTRAINT fk_currency_player FOREIGN KEY (player_id) REFERENCES "player" (id)
 );
 
@@ -268,18 +623,91 @@ CREATE TABLE "player_transaction" (
     player_id INTEGER NOT NULL,
     currency_id INTEGER NOT NULL,
     change INTEGER NOT NULL,
+    reason VARCHAR(25) NOT NULL DEFAULT 'grant',
+    paid_change INTEGER NOT NULL DEFAULT 0,
+    free_change INTEGER NOT NULL DEFAULT 0,
+    player_exchange_id INTEGER,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     CONSTRAINT fk_player_currency_transaction FOREIGN KEY (player_id, currency_id) REFERENCES "player_currency" (player_id, currency_id)
 );
 
 CREATE UNIQUE INDEX "player_transaction_id" ON player_transaction (id, player_id);
 
+-- Every grant of currency is a lot. Lots are consumed by the currency's spend priority, then first-to-expire first
+CREATE TABLE "player_currency_lot" (
+    id SERIAL PRIMARY KEY,
+    player_id INTEGER NOT NULL,
+    currency_id INTEGER NOT NULL,
+    transaction_id INTEGER NOT NULL,
+    amount INTEGER NOT NULL CHECK (amount > 0),
+    remaining INTEGER NOT NULL CHECK (remaining >= 0),
+    is_paid BOOLEAN NOT NULL DEFAULT FALSE,
+    expires_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_player_currency_lot FOREIGN KEY (player_id, currency_id) REFERENCES "player_currency" (player_id, currency_id),
+    CONSTRAINT fk_player_currency_lot_transaction FOREIGN KEY (transaction_id, player_id) REFERENCES "player_transaction" (id, player_id)
+);
+
+CREATE INDEX "player_currency_lot_live" ON player_currency_lot (player_id, currency_id, expires_at) WHERE remaining > 0;
+
+CREATE TABLE "player_exchange" (
+    id SERIAL PRIMARY KEY,
+    exchange_id INTEGER NOT NULL,
+    player_id INTEGER NOT NULL,
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_player_exchange_exchange FOREIGN KEY (exchange_id) REFERENCES "exchange" (id),
+    CONSTRAINT fk_player_exchange_player FOREIGN KEY (player_id) REFERENCES "player" (id)
+);
+
+CREATE INDEX "player_exchange_player" ON player_exchange (player_id, exchange_id, created_at);
+
+ALTER TABLE "player_transaction" ADD CONSTRAINT fk_player_transaction_exchange FOREIGN KEY (player_exchange_id) REFERENCES "player_exchange" (id);
+
+-- Summons are pulled from a per-player random stream: draw n is HMAC-SHA256(seed, n). Players see
+-- the commitment (SHA-256 of the seed) while the seed is active, and the seed once it is revealed.
+CREATE TABLE "player_seed" (
+    id SERIAL PRIMARY KEY,
+    player_id INTEGER NOT NULL,
+    seed BYTEA NOT NULL,
+    commitment CHAR(64) NOT NULL,
+    draws BIGINT NOT NULL DEFAULT 0 CHECK (draws >= 0),
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    revealed_at TIMESTAMP,
+    CHECK (is_active = (revealed_at IS NULL)),
+    CONSTRAINT fk_player_seed_player FOREIGN KEY (player_id) REFERENCES "player" (id)
+);
+
+CREATE UNIQUE INDEX player_seed_active ON "player_seed" (player_id) WHERE is_active;
+
+-- Loot tables that summons were pulled from, by hash (summon.table_hash), so that seeded summons
+-- can be replayed against the table they were pulled from after their banner is edited
+CREATE TABLE "loot_table_snapshot" (
+    hash CHAR(64) PRIMARY KEY,
+    loot_table JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
 CREATE TABLE "summon" (
     id SERIAL PRIMARY KEY,
     transaction_id INTEGER NOT NULL,
     player_id INTEGER NOT NULL,
     hero_id INTEGER NOT NULL,
     hero_banner_id INTEGER NOT NULL,
+    rarity INTEGER NOT NULL,
+    is_featured BOOLEAN NOT NULL DEFAULT FALSE,
+    source VARCHAR(15) NOT NULL DEFAULT 'pull' CHECK (source IN ('pull', 'spark')),
+    pity_count INTEGER NOT NULL DEFAULT 0,
+    pity_guaranteed BOOLEAN NOT NULL DEFAULT FALSE,
+    player_seed_id INTEGER,
+    draw_index BIGINT,
+    table_hash CHAR(64),
+    duplicate_policy VARCHAR(11) CHECK (duplicate_policy IN ('keep', 'limit-break', 'convert')),
+    duplicate_of INTEGER,
+    duplicate_transaction_id INTEGER,
+    player_exchange_id INTEGER,
+    limit_break INTEGER NOT NULL DEFAULT 0 CHECK (limit_break >= 0),
     level INTEGER DEFAULT 1,
     friendship DECIMAL DEFAULT 0,
     is_active BOOLEAN DEFAULT TRUE,
@@ -287,10 +715,27 @@ CREATE TABLE "summon" (
     deleted_at TIMESTAMP,
     CONSTRAINT fk_summon_transaction FOREIGN KEY (transaction_id, player_id) REFERENCES "player_transaction" (id, player_id),
     CONSTRAINT fk_summon_hero FOREIGN KEY (hero_id) REFERENCES "hero" (id),
-    CONSTRAINT fk_summon_banner FOREIGN KEY (hero_banner_id) REFERENCES "hero_banner" (id)
+    CONSTRAINT fk_summon_rarity FOREIGN KEY (rarity) REFERENCES "hero_rarity" (id),
+    CONSTRAINT fk_summon_banner FOREIGN KEY (hero_banner_id) REFERENCES "hero_banner" (id),
+    CONSTRAINT fk_summon_seed FOREIGN KEY (player_seed_id) REFERENCES "player_seed" (id),
+    CONSTRAINT fk_summon_duplicate FOREIGN KEY (duplicate_of) REFERENCES "summon" (id),
+    CONSTRAINT fk_summon_duplicate_transaction FOREIGN KEY (duplicate_transaction_id, player_id) REFERENCES "player_transaction" (id, player_id),
+    CONSTRAINT fk_summon_exchange FOREIGN KEY (player_exchange_id) REFERENCES "player_exchange" (id)
 );
 
-CREATE TABLE "summon_stats" {
+-- Pity progress of each player on each banner type: pulls since the last top rarity hero,
+-- and whether the next top rarity hero is guaranteed to be featured (after a lost 50/50)
+CREATE TABLE "player_pity" (
+    player_id INTEGER NOT NULL,
+    banner_type VARCHAR(15) NOT NULL,
+    pulls INTEGER NOT NULL DEFAULT 0,
+    guaranteed BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (player_id, banner_type),
+    CONSTRAINT fk_player_pity_player FOREIGN KEY (player_id) REFERENCES "player" (id)
+);
+
+CREATE TABLE "summon_stats" (
     summon_id INTEGER NOT NULL UNIQUE,
     attack INTEGER NOT NULL,
     crit_chance INTEGER NOT NULL,
@@ -302,12 +747,13 @@ CREATE TABLE "summon_stats" {
     evasion INTEGER NOT NULL,
     resistance INTEGER NOT NULL,
     constraint fk_summon_stats FOREIGN KEY (summon_id) REFERENCES "summon" (id)
-}
+);
 
+-- Rings are equipped to a summon, and unequipped (summon_id is NULL) when that summon is refunded
 CREATE TABLE "player_ring" (
     player_id INTEGER NOT NULL,
     ring_id INTEGER NOT NULL UNIQUE,
-    summon_id INTEGER NOT NULL,
+    summon_id INTEGER,
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     deleted_at TIMESTAMP,
     CONSTRAINT fk_player_ring FOREIGN KEY (ring_id) REFERENCES "ring" (id),
@@ -1 +1,248 @@
+// actions.go manages the actions of hero skills.
 package hero
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/battle"
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// IndexActionTypes returns the registry of action types and the
+// schema of their params @ GET /admin/skill-actions/types
+func IndexActionTypes(c echo.Context) error {
+	return c.JSON(http.StatusOK, battle.ListActionTypes())
+}
+
+// IndexActions returns a list of all hero actions
+// @ GET /admin/skill-actions
+func IndexActions(c echo.Context) error {
+	// Bind query parameters to model
+	filter := new(methods.HeroAction)
+	if err := c.Bind(filter); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.ErrBadRequest
+	}
+
+	// Get all applicable actions
+	actions, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return actions
+	return c.JSON(http.StatusOK, actions)
+}
+
+// CreateAction creates a new hero action
+// @ POST /admin/skill-actions/new
+func CreateAction(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "action-create"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	action := bindAction(c)
+
+	if err := action.Create(); err != nil {
+		// Failed to create action
+		staffLog.Create(false, methods.Error{Details: err, Data: action})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return action
+	staffLog.Create(true, methods.Error{Data: action})
+	return c.JSON(http.StatusOK, action)
+}
+
+// ReadAction returns a single hero action
+// @ GET /admin/skill-actions/:id
+func ReadAction(c echo.Context) error {
+	var filter methods.HeroAction
+	filter.ID, _ = strconv.Atoi(c.Param("id"))
+
+	// Get the action
+	actions, err := filter.Read()
+	if err != nil || len(actions) == 0 {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return action
+	return c.JSON(http.StatusOK, actions[0])
+}
+
+// UpdateAction updates a single hero action
+// @ POST /admin/skill-actions/:id
+func UpdateAction(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "action-update"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	action := bindAction(c)
+	action.ID, _ = strconv.Atoi(c.Param("id"))
+
+	if err := action.Update(); err != nil {
+		// Failed to update action
+		staffLog.Create(false, methods.Error{Details: err, Data: action})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return action
+	staffLog.Create(true, methods.Error{Data: action})
+	return c.JSON(http.StatusOK, action)
+}
+
+// DeleteAction deletes a single hero action that no skill carries
+// out @ DELETE /admin/skill-actions/:id
+func DeleteAction(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "action-delete"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	var action methods.HeroAction
+	action.ID, _ = strconv.Atoi(c.Param("id"))
+
+	if err := action.Delete(); err != nil {
+		// Failed to delete action
+		staffLog.Create(false, methods.Error{Details: err, Data: action})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return action
+	staffLog.Create(true, methods.Error{Data: action})
+	return c.JSON(http.StatusOK, action)
+}
+
+// ReadSkillActions returns the actions of a hero's skill, in
+// execution order @ GET /admin/heroes/:id/skills/:skill/actions
+func ReadSkillActions(c echo.Context) error {
+	heroID, _ := strconv.Atoi(c.Param("id"))
+	skillID, _ := strconv.Atoi(c.Param("skill"))
+
+	// Get the actions
+	actions, err := methods.ReadSkillActions(heroID, skillID)
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return actions
+	return c.JSON(http.StatusOK, actions)
+}
+
+// UpdateSkillActions replaces the actions of a hero's skill. The nth
+// action_ids, orders & chances values make up the nth action
+// @ POST /admin/heroes/:id/skills/:skill/actions
+func UpdateSkillActions(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "skillaction-update"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	heroID, _ := strconv.Atoi(c.Param("id"))
+	skillID, _ := strconv.Atoi(c.Param("skill"))
+
+	var actions []methods.SkillAction
+	if form, err := c.FormParams(); err == nil {
+		orders, chances := form["orders"], form["chances"]
+
+		for i, value := range form["action_ids"] {
+			action := methods.SkillAction{HeroSkillID: skillID, Chance: 100}
+			action.HeroActionID, _ = strconv.Atoi(value)
+			action.ExecutionOrder = i + 1
+
+			if i < len(orders) {
+				action.ExecutionOrder, _ = strconv.Atoi(orders[i])
+			}
+			if i < len(chances) {
+				action.Chance, _ = strconv.Atoi(chances[i])
+			}
+
+			actions = append(actions, action)
+		}
+	}
+
+	if err := methods.SaveSkillActions(heroID, skillID, actions); err != nil {
+		// Failed to save actions
+		staffLog.Create(false, methods.Error{Details: err, Data: actions})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return actions
+	staffLog.Create(true, methods.Error{Data: actions})
+	return c.JSON(http.StatusOK, actions)
+}
+
+// bindAction binds the form values of an action create or update
+// request to a HeroAction.
+func bindAction(c echo.Context) methods.HeroAction {
+	return methods.HeroAction{
+		Name:        c.FormValue("name"),
+		Type:        c.FormValue("type"),
+		Params:      json.RawMessage(c.FormValue("params")),
+		Description: c.FormValue("description"),
+	}
+}
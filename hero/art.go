@@ -1 +1,226 @@
+// art.go manages the art of heroes, skills & currencies.
 package hero
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/media"
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// IndexArt returns a list of all art assets
+// @ GET /admin/art
+func IndexArt(c echo.Context) error {
+	// Bind query parameters to model
+	filter := new(methods.ArtAsset)
+	if err := c.Bind(filter); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.ErrBadRequest
+	}
+
+	// Get all applicable art
+	assets, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return art
+	return c.JSON(http.StatusOK, assets)
+}
+
+// UploadArt uploads an image (the file form value) as an art asset
+// @ POST /admin/art/new
+func UploadArt(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "art-upload"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	name, data, err := readUpload(c, media.MaxImageBytes)
+	if err != nil {
+		// Failed to read upload
+		staffLog.Create(false, methods.Error{Details: err, Data: name})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	asset, err := methods.UploadArt(name, data, user.ID)
+	if err != nil {
+		// Failed to upload art
+		staffLog.Create(false, methods.Error{Details: err, Data: asset})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return art
+	staffLog.Create(true, methods.Error{Data: asset})
+	return c.JSON(http.StatusOK, asset)
+}
+
+// ReadArt returns a single art asset with its links
+// @ GET /admin/art/:id
+func ReadArt(c echo.Context) error {
+	var filter methods.ArtAsset
+	filter.ID, _ = strconv.Atoi(c.Param("id"))
+
+	// Get the art
+	assets, err := filter.Read()
+	if err != nil || len(assets) == 0 {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return art
+	return c.JSON(http.StatusOK, assets[0])
+}
+
+// DeleteArt deletes an unlinked art asset & its files
+// @ DELETE /admin/art/:id
+func DeleteArt(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "art-delete"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	var asset methods.ArtAsset
+	asset.ID, _ = strconv.Atoi(c.Param("id"))
+
+	if err := asset.Delete(); err != nil {
+		// Failed to delete art
+		staffLog.Create(false, methods.Error{Details: err, Data: asset})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return deleted art
+	staffLog.Create(true, methods.Error{Data: asset})
+	return c.JSON(http.StatusOK, asset)
+}
+
+// LinkArt links an art asset to a hero, skill or currency
+// @ POST /admin/art/:id/links
+func LinkArt(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "art-link"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	link := methods.ArtLink{Purpose: c.FormValue("purpose")}
+	link.ArtAssetID, _ = strconv.Atoi(c.Param("id"))
+	link.HeroID, _ = strconv.Atoi(c.FormValue("hero_id"))
+	link.HeroSkillID, _ = strconv.Atoi(c.FormValue("hero_skill_id"))
+	link.CurrencyID, _ = strconv.Atoi(c.FormValue("currency_id"))
+
+	if err := link.Save(); err != nil {
+		// Failed to link art
+		staffLog.Create(false, methods.Error{Details: err, Data: link})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return link
+	staffLog.Create(true, methods.Error{Data: link})
+	return c.JSON(http.StatusOK, link)
+}
+
+// UnlinkArt removes a link of an art asset
+// @ DELETE /admin/art/:id/links/:link
+func UnlinkArt(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "art-link"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	var link methods.ArtLink
+	link.ArtAssetID, _ = strconv.Atoi(c.Param("id"))
+	link.ID, _ = strconv.Atoi(c.Param("link"))
+
+	if err := link.Delete(); err != nil {
+		// Failed to unlink art
+		staffLog.Create(false, methods.Error{Details: err, Data: link})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return deleted link
+	staffLog.Create(true, methods.Error{Data: link})
+	return c.JSON(http.StatusOK, link)
+}
+
+// readUpload reads the uploaded file form value, and returns its
+// name & data. Files larger than limit are rejected.
+func readUpload(c echo.Context, limit int) (string, []byte, error) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return "", nil, err
+	} else if header.Size > int64(limit) {
+		return header.Filename, nil, echo.ErrStatusRequestEntityTooLarge
+	}
+
+	file, err := header.Open()
+	if err != nil {
+		return header.Filename, nil, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, int64(limit)+1))
+	if err == nil && len(data) > limit {
+		err = echo.ErrStatusRequestEntityTooLarge
+	}
+
+	return header.Filename, data, err
+}
@@ -0,0 +1,45 @@
+// battle.go runs headless battles between teams of heroes.
+package hero
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// SimulateBattles fights teams of heroes against each other and
+// returns the win rates of each matchup & hero. Each repeated teams
+// value is a comma separated list of hero IDs
+// @ GET /admin/battles/simulate
+func SimulateBattles(c echo.Context) error {
+	var request methods.BattleSimulation
+	request.Battles, _ = strconv.Atoi(c.QueryParam("battles"))
+	request.Seed, _ = strconv.ParseInt(c.QueryParam("seed"), 10, 64)
+
+	for _, value := range c.QueryParams()["teams"] {
+		var team []int
+		for _, id := range strings.Split(value, ",") {
+			heroID, err := strconv.Atoi(strings.TrimSpace(id))
+			if err != nil {
+				return echo.NewHTTPError(http.StatusBadRequest,
+					"Teams must be lists of hero IDs")
+			}
+			team = append(team, heroID)
+		}
+		request.Teams = append(request.Teams, team)
+	}
+
+	report, err := request.Run()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Return simulation report
+	return c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,93 @@
+// damage.go manages the element advantage matrix and calculates the
+// damage of hero skills.
+package hero
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// IndexElementAdvantages returns the element advantage matrix
+// @ GET /admin/advantages
+func IndexElementAdvantages(c echo.Context) error {
+	var filter methods.ElementAdvantage
+
+	// Get the matrix
+	matrix, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return matrix
+	return c.JSON(http.StatusOK, matrix)
+}
+
+// UpdateElementAdvantage creates or replaces the advantage of an
+// attacking element over a defending element
+// @ POST /admin/advantages/:attacker/:defender
+func UpdateElementAdvantage(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "advantage-update"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	var advantage methods.ElementAdvantage
+	attacker, _ := strconv.Atoi(c.Param("attacker"))
+	defender, _ := strconv.Atoi(c.Param("defender"))
+	advantage.AttackerElement = methods.HeroElement(attacker)
+	advantage.DefenderElement = methods.HeroElement(defender)
+	advantage.Damage, _ = strconv.ParseFloat(c.FormValue("damage"), 64)
+	advantage.HitChance, _ = strconv.Atoi(c.FormValue("hit_chance"))
+
+	if err := advantage.Save(); err != nil {
+		// Failed to save advantage
+		staffLog.Create(false, methods.Error{Details: err, Data: advantage})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return advantage
+	staffLog.Create(true, methods.Error{Data: advantage})
+	return c.JSON(http.StatusOK, advantage)
+}
+
+// CalculateDamage returns the expected damage, crit range & hit
+// chance of an attacking hero's skill against a defending hero
+// @ GET /admin/damage
+func CalculateDamage(c echo.Context) error {
+	// Bind query parameters to model
+	request := new(methods.DamageRequest)
+	if err := c.Bind(request); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.ErrBadRequest
+	}
+
+	calculation, err := request.Calculate()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return calculation
+	return c.JSON(http.StatusOK, calculation)
+}
@@ -0,0 +1,151 @@
+// hero.go manages CRUD operations for the hero catalogue.
+package hero
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// IndexHeroes returns a list of all heroes
+// @ GET /admin/heroes
+func IndexHeroes(c echo.Context) error {
+	// Bind query parameters to model
+	filter := new(methods.Hero)
+	if err := c.Bind(filter); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.ErrBadRequest
+	}
+
+	// Get all applicable heroes
+	heroes, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return heroes
+	return c.JSON(http.StatusOK, heroes)
+}
+
+// CreateHero creates a new hero with its background, base stats &
+// skills @ POST /admin/heroes/new
+func CreateHero(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "hero-create"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	hero, err := bindHero(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err = hero.Create(); err != nil {
+		// Failed to create hero
+		staffLog.Create(false, methods.Error{Details: err, Data: hero})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return hero
+	staffLog.Create(true, methods.Error{Data: hero})
+	return c.JSON(http.StatusOK, hero)
+}
+
+// ReadHero returns a single hero with its background, base stats &
+// skills @ GET /admin/heroes/:id
+func ReadHero(c echo.Context) error {
+	var filter methods.Hero
+	filter.ID, _ = strconv.Atoi(c.Param("id"))
+	filter.Locale = c.QueryParam("locale")
+
+	// Get the hero
+	heroes, err := filter.Read()
+	if err != nil || len(heroes) == 0 {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return hero
+	return c.JSON(http.StatusOK, heroes[0])
+}
+
+// UpdateHero updates a single hero with its background, base stats &
+// skills @ POST /admin/heroes/:id
+func UpdateHero(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "hero-update"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	hero, err := bindHero(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	hero.ID, _ = strconv.Atoi(c.Param("id"))
+
+	if err = hero.Update(); err != nil {
+		// Failed to update hero
+		staffLog.Create(false, methods.Error{Details: err, Data: hero})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return hero
+	staffLog.Create(true, methods.Error{Data: hero})
+	return c.JSON(http.StatusOK, hero)
+}
+
+// bindHero binds the form values of a hero create or update request
+// to a Hero.
+func bindHero(c echo.Context) (methods.Hero, error) {
+	hero := methods.Hero{Name: c.FormValue("name")}
+
+	class, _ := strconv.Atoi(c.FormValue("class"))
+	rarity, _ := strconv.Atoi(c.FormValue("rarity"))
+	element, _ := strconv.Atoi(c.FormValue("element"))
+	hero.Class = methods.HeroClass(class)
+	hero.Rarity = methods.HeroRarity(rarity)
+	hero.Element = methods.HeroElement(element)
+	hero.IsActive, _ = strconv.ParseBool(c.FormValue("is_active"))
+
+	hero.Background = bindBackground(c)
+	var err error
+	if hero.Stats, err = bindStats(c); err != nil {
+		return hero, err
+	}
+	hero.Skills, err = bindSkills(c)
+
+	return hero, err
+}
@@ -1 +1,247 @@
+// lore.go manages the background (lore) of heroes, and the
+// translation of hero, skill & currency text into other locales.
 package hero
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// bindBackground binds the form values of a hero's background.
+func bindBackground(c echo.Context) methods.HeroBackground {
+	return methods.HeroBackground{
+		ShortDescription: c.FormValue("short_description"),
+		LongDescription:  c.FormValue("long_description"),
+	}
+}
+
+// IndexLocales returns every locale that text is translated into
+// @ GET /admin/locales
+func IndexLocales(c echo.Context) error {
+	// Get all locales
+	locales, err := methods.ReadLocales()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return locales
+	return c.JSON(http.StatusOK, locales)
+}
+
+// SaveLocale creates or updates the name & fallback of a locale
+// @ POST /admin/locales/:code
+func SaveLocale(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "locale-update"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	locale := methods.Locale{
+		Code:     c.Param("code"),
+		Name:     c.FormValue("name"),
+		Fallback: c.FormValue("fallback"),
+	}
+
+	if err := locale.Save(); err != nil {
+		// Failed to save locale
+		staffLog.Create(false, methods.Error{Details: err, Data: locale})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return locale
+	staffLog.Create(true, methods.Error{Data: locale})
+	return c.JSON(http.StatusOK, locale)
+}
+
+// IndexTranslations returns the translatable text of a locale with
+// its translations, or only missing & outdated translations if
+// missing is set @ GET /admin/translations/:locale
+func IndexTranslations(c echo.Context) error {
+	// Bind query parameters to model
+	filter := new(methods.Translation)
+	if err := c.Bind(filter); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.ErrBadRequest
+	}
+	filter.Locale = c.Param("locale")
+
+	// Get all applicable translations
+	translations, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return translations
+	return c.JSON(http.StatusOK, translations)
+}
+
+// SaveTranslations creates, replaces or (without text) removes
+// translations into a locale @ POST /admin/translations/:locale
+func SaveTranslations(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "translation-update"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	locale := c.Param("locale")
+	translations := bindTranslations(c)
+
+	if _, err := methods.SaveTranslations(
+		locale, translations, user.ID,
+	); err != nil {
+		// Failed to save translations
+		staffLog.Create(false, methods.Error{Details: err, Data: translations})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return translations
+	staffLog.Create(true, methods.Error{Data: translations})
+	return c.JSON(http.StatusOK, translations)
+}
+
+// ExportTranslations returns the translations of a locale as a JSON
+// or XLIFF (format=xliff) file, filtered like IndexTranslations
+// @ GET /admin/translations/:locale/export
+func ExportTranslations(c echo.Context) error {
+	// Bind query parameters to model
+	filter := new(methods.Translation)
+	if err := c.Bind(filter); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.ErrBadRequest
+	}
+	filter.Locale = c.Param("locale")
+	format := c.QueryParam("format")
+
+	document, err := filter.Export(format)
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return file
+	name, contentType := filter.Locale+".json", echo.MIMEApplicationJSON
+	if format == methods.FormatXLIFF {
+		name, contentType = filter.Locale+".xlf", "application/x-xliff+xml"
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		`attachment; filename="`+name+`"`)
+	return c.Blob(http.StatusOK, contentType, document)
+}
+
+// ImportTranslations saves the translations of an uploaded JSON or
+// XLIFF file (the file form value) into a locale
+// @ POST /admin/translations/:locale/import
+func ImportTranslations(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "translation-update"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	locale := c.Param("locale")
+	name, data, err := readUpload(c, maxTranslationBytes)
+	if err != nil {
+		// Failed to read upload
+		staffLog.Create(false, methods.Error{Details: err, Data: name})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	count, err := methods.ImportTranslations(locale, data, user.ID)
+	result := map[string]interface{}{"Locale": locale, "File": name,
+		"Imported": count}
+	if err != nil {
+		// Failed to import translations
+		staffLog.Create(false, methods.Error{Details: err, Data: result})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return the number of imported translations
+	staffLog.Create(true, methods.Error{Data: result})
+	return c.JSON(http.StatusOK, result)
+}
+
+// maxTranslationBytes is the largest translation file that can be
+// imported.
+const maxTranslationBytes = 10 << 20
+
+// bindTranslations binds the repeated translation form values. The
+// nth fields, source_ids & texts values make up the nth translation.
+func bindTranslations(c echo.Context) []methods.Translation {
+	var translations []methods.Translation
+
+	form, err := c.FormParams()
+	if err != nil {
+		return translations
+	}
+
+	ids := form["source_ids"]
+	texts := form["texts"]
+
+	for i, field := range form["fields"] {
+		translation := methods.Translation{
+			Locale: c.Param("locale"),
+			Field:  field,
+		}
+
+		if i < len(ids) {
+			translation.SourceID, _ = strconv.Atoi(ids[i])
+		}
+		if i < len(texts) {
+			translation.Text = texts[i]
+		}
+
+		translations = append(translations, translation)
+	}
+
+	return translations
+}
@@ -1 +1,77 @@
+// multiplier.go manages the stat multipliers of hero skills.
 package hero
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// ReadSkillMultiplier returns the multiplier of a hero's skill
+// @ GET /admin/heroes/:id/skills/:skill/multiplier
+func ReadSkillMultiplier(c echo.Context) error {
+	var multiplier methods.HeroSkillMultiplier
+	multiplier.HeroID, _ = strconv.Atoi(c.Param("id"))
+	multiplier.HeroSkillID, _ = strconv.Atoi(c.Param("skill"))
+
+	// Get the multiplier
+	if err := multiplier.Read(); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return multiplier
+	return c.JSON(http.StatusOK, multiplier)
+}
+
+// UpdateSkillMultiplier creates or replaces the multiplier of a
+// hero's skill @ POST /admin/heroes/:id/skills/:skill/multiplier
+func UpdateSkillMultiplier(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "multiplier-update"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	var multiplier methods.HeroSkillMultiplier
+	multiplier.HeroID, _ = strconv.Atoi(c.Param("id"))
+	multiplier.HeroSkillID, _ = strconv.Atoi(c.Param("skill"))
+
+	m := &multiplier.Multiplier
+	m.Power, _ = strconv.ParseFloat(c.FormValue("power"), 64)
+	m.Attack, _ = strconv.ParseFloat(c.FormValue("attack"), 64)
+	m.CritDamage, _ = strconv.ParseFloat(c.FormValue("crit_damage"), 64)
+	m.Defence, _ = strconv.ParseFloat(c.FormValue("defence"), 64)
+	m.Health, _ = strconv.ParseFloat(c.FormValue("health"), 64)
+	m.PercentHealth, _ = strconv.ParseFloat(c.FormValue("percent_health"), 64)
+	m.VsDebuffed, _ = strconv.ParseFloat(c.FormValue("vs_debuffed"), 64)
+	m.VsEvaded, _ = strconv.ParseFloat(c.FormValue("vs_evaded"), 64)
+	m.VsHighHP, _ = strconv.ParseFloat(c.FormValue("vs_high_hp"), 64)
+	m.VsHighAtk, _ = strconv.ParseFloat(c.FormValue("vs_high_atk"), 64)
+
+	if err := multiplier.Save(); err != nil {
+		// Failed to save multiplier
+		staffLog.Create(false, methods.Error{Details: err, Data: multiplier})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return multiplier
+	staffLog.Create(true, methods.Error{Data: multiplier})
+	return c.JSON(http.StatusOK, multiplier)
+}
@@ -0,0 +1,171 @@
+// reference.go manages the classes, rarities & elements of heroes.
+package hero
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// IndexReferences returns a list of all classes, rarities or
+// elements (by kind) @ GET /admin/references/:kind
+func IndexReferences(c echo.Context) error {
+	// Bind query parameters to model
+	filter := new(methods.Reference)
+	if err := c.Bind(filter); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.ErrBadRequest
+	}
+	filter.Kind = c.Param("kind")
+
+	// Get all applicable references
+	references, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return references
+	return c.JSON(http.StatusOK, references)
+}
+
+// CreateReference creates a new class, rarity or element
+// @ POST /admin/references/:kind/new
+func CreateReference(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "reference-create"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	reference := bindReference(c)
+	reference.ID, _ = strconv.Atoi(c.FormValue("id"))
+
+	if err := reference.Create(); err != nil {
+		// Failed to create reference
+		staffLog.Create(false, methods.Error{Details: err, Data: reference})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return reference
+	staffLog.Create(true, methods.Error{Data: reference})
+	return c.JSON(http.StatusOK, reference)
+}
+
+// ReadReference returns a single class, rarity or element
+// @ GET /admin/references/:kind/:id
+func ReadReference(c echo.Context) error {
+	filter := methods.Reference{Kind: c.Param("kind")}
+	filter.ID, _ = strconv.Atoi(c.Param("id"))
+
+	// Get the reference
+	references, err := filter.Read()
+	if err != nil || len(references) == 0 {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return reference
+	return c.JSON(http.StatusOK, references[0])
+}
+
+// UpdateReference updates a single class, rarity or element
+// @ POST /admin/references/:kind/:id
+func UpdateReference(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "reference-update"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	reference := bindReference(c)
+	reference.ID, _ = strconv.Atoi(c.Param("id"))
+
+	if err := reference.Update(); err != nil {
+		// Failed to update reference
+		staffLog.Create(false, methods.Error{Details: err, Data: reference})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return reference
+	staffLog.Create(true, methods.Error{Data: reference})
+	return c.JSON(http.StatusOK, reference)
+}
+
+// DeleteReference deletes a single class, rarity or element that is
+// not in use @ DELETE /admin/references/:kind/:id
+func DeleteReference(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "reference-delete"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	reference := methods.Reference{Kind: c.Param("kind")}
+	reference.ID, _ = strconv.Atoi(c.Param("id"))
+
+	if err := reference.Delete(); err != nil {
+		// Failed to delete reference
+		staffLog.Create(false, methods.Error{Details: err, Data: reference})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return reference
+	staffLog.Create(true, methods.Error{Data: reference})
+	return c.JSON(http.StatusOK, reference)
+}
+
+// bindReference binds the form values of a reference create or
+// update request to a Reference.
+func bindReference(c echo.Context) methods.Reference {
+	reference := methods.Reference{
+		Kind:        c.Param("kind"),
+		Name:        c.FormValue("name"),
+		DisplayName: c.FormValue("display_name"),
+		Icon:        c.FormValue("icon"),
+	}
+	reference.SortOrder, _ = strconv.Atoi(c.FormValue("sort_order"))
+
+	return reference
+}
@@ -0,0 +1,250 @@
+// revision.go manages the draft & publish workflow of heroes.
+package hero
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// IndexRevisions returns the revision history of a hero
+// @ GET /admin/heroes/:id/revisions
+func IndexRevisions(c echo.Context) error {
+	// Bind query parameters to model
+	filter := new(methods.HeroRevision)
+	if err := c.Bind(filter); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.ErrBadRequest
+	}
+	filter.HeroID, _ = strconv.Atoi(c.Param("id"))
+
+	// Get all applicable revisions
+	revisions, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return revisions
+	return c.JSON(http.StatusOK, revisions)
+}
+
+// CreateRevision creates a new draft revision of a hero
+// @ POST /admin/heroes/:id/revisions
+func CreateRevision(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "revision-create"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	revision, err := bindRevision(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	revision.CreatedBy = user.ID
+
+	if err = revision.Create(); err != nil {
+		// Failed to create revision
+		staffLog.Create(false, methods.Error{Details: err, Data: revision})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return revision
+	staffLog.Create(true, methods.Error{Data: revision})
+	return c.JSON(http.StatusOK, revision)
+}
+
+// ReadRevision returns a single revision of a hero
+// @ GET /admin/heroes/:id/revisions/:revision
+func ReadRevision(c echo.Context) error {
+	var filter methods.HeroRevision
+	filter.HeroID, _ = strconv.Atoi(c.Param("id"))
+	filter.ID, _ = strconv.Atoi(c.Param("revision"))
+
+	// Get the revision
+	revisions, err := filter.Read()
+	if err != nil || len(revisions) == 0 {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return revision
+	return c.JSON(http.StatusOK, revisions[0])
+}
+
+// UpdateRevision updates a draft revision of a hero
+// @ POST /admin/heroes/:id/revisions/:revision
+func UpdateRevision(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "revision-update"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	revision, err := bindRevision(c)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+	revision.ID, _ = strconv.Atoi(c.Param("revision"))
+
+	if err = revision.Update(user.ID); err != nil {
+		// Failed to update revision
+		staffLog.Create(false, methods.Error{Details: err, Data: revision})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return revision
+	staffLog.Create(true, methods.Error{Data: revision})
+	return c.JSON(http.StatusOK, revision)
+}
+
+// ApproveRevision approves a draft revision of a hero
+// @ POST /admin/heroes/:id/revisions/:revision/approve
+func ApproveRevision(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "revision-approve"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	var revision methods.HeroRevision
+	revision.HeroID, _ = strconv.Atoi(c.Param("id"))
+	revision.ID, _ = strconv.Atoi(c.Param("revision"))
+
+	if err := revision.Approve(user.ID); err != nil {
+		// Failed to approve revision
+		staffLog.Create(false, methods.Error{Details: err, Data: revision})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return revision
+	staffLog.Create(true, methods.Error{Data: revision})
+	return c.JSON(http.StatusOK, revision)
+}
+
+// PublishRevision makes an approved revision of a hero live
+// @ POST /admin/heroes/:id/revisions/:revision/publish
+func PublishRevision(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "revision-publish"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	var revision methods.HeroRevision
+	revision.HeroID, _ = strconv.Atoi(c.Param("id"))
+	revision.ID, _ = strconv.Atoi(c.Param("revision"))
+
+	if err := revision.Publish(user.ID); err != nil {
+		// Failed to publish revision
+		staffLog.Create(false, methods.Error{Details: err, Data: revision})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return revision
+	staffLog.Create(true, methods.Error{Data: revision})
+	return c.JSON(http.StatusOK, revision)
+}
+
+// RollbackRevision publishes the content of a previously published
+// revision of a hero again
+// @ POST /admin/heroes/:id/revisions/:revision/rollback
+func RollbackRevision(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "revision-rollback"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	var revision methods.HeroRevision
+	revision.HeroID, _ = strconv.Atoi(c.Param("id"))
+	revision.ID, _ = strconv.Atoi(c.Param("revision"))
+
+	rollback, err := revision.Rollback(user.ID)
+	if err != nil {
+		// Failed to roll back
+		staffLog.Create(false, methods.Error{Details: err, Data: revision})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return the new live revision
+	staffLog.Create(true, methods.Error{Data: rollback})
+	return c.JSON(http.StatusOK, rollback)
+}
+
+// bindRevision binds the form values of a revision create or update
+// request to a HeroRevision. Its content is bound like a hero.
+func bindRevision(c echo.Context) (methods.HeroRevision, error) {
+	content, err := bindHero(c)
+	revision := methods.HeroRevision{
+		Content: content,
+		Note:    c.FormValue("note"),
+	}
+	revision.HeroID, _ = strconv.Atoi(c.Param("id"))
+
+	return revision, err
+}
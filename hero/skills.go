@@ -1 +1,67 @@
-package hero
\ No newline at end of file
+// skills.go manages the skills of heroes.
+package hero
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/battle"
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// bindSkills binds the repeated skill form values of a hero. The
+// nth skill_ids, skill_icons, skill_descriptions, skill_actives,
+// skill_multipliers (as JSON) & skill_actions (as a JSON array)
+// values make up the nth skill; skills without an id are new.
+func bindSkills(c echo.Context) ([]methods.HeroSkill, error) {
+	var skills []methods.HeroSkill
+
+	form, err := c.FormParams()
+	if err != nil {
+		return skills, err
+	}
+
+	ids := form["skill_ids"]
+	descriptions := form["skill_descriptions"]
+	actives := form["skill_actives"]
+	multipliers := form["skill_multipliers"]
+	actions := form["skill_actions"]
+
+	for i, icon := range form["skill_icons"] {
+		skill := methods.HeroSkill{Icon: icon, IsActiveSkill: true}
+
+		if i < len(ids) {
+			skill.ID, _ = strconv.Atoi(ids[i])
+		}
+		if i < len(descriptions) {
+			skill.Description = descriptions[i]
+		}
+		if i < len(actives) {
+			skill.IsActiveSkill, _ = strconv.ParseBool(actives[i])
+		}
+		if i < len(multipliers) && multipliers[i] != "" {
+			skill.Multiplier = new(battle.Multiplier)
+			if err = json.Unmarshal(
+				[]byte(multipliers[i]), skill.Multiplier,
+			); err != nil {
+				return skills, errors.New("Skill multipliers must be JSON objects")
+			}
+		}
+		if i < len(actions) && actions[i] != "" {
+			if err = json.Unmarshal(
+				[]byte(actions[i]), &skill.Actions,
+			); err != nil {
+				return skills, errors.New("Skill actions must be JSON arrays")
+			} else if skill.Actions == nil {
+				skill.Actions = []methods.SkillAction{}
+			}
+		}
+
+		skills = append(skills, skill)
+	}
+
+	return skills, nil
+}
@@ -1 +1,181 @@
+// sound.go manages the voice lines, sound effects & music of heroes
+// & their skills.
 package hero
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/media"
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// IndexSounds returns a list of all sound assets
+// @ GET /admin/sounds
+func IndexSounds(c echo.Context) error {
+	// Bind query parameters to model
+	filter := new(methods.SoundAsset)
+	if err := c.Bind(filter); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.ErrBadRequest
+	}
+
+	// Get all applicable sounds
+	sounds, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return sounds
+	return c.JSON(http.StatusOK, sounds)
+}
+
+// UploadSound uploads a WAV, OGG or MP3 file (the file form value)
+// as a sound asset @ POST /admin/sounds/new
+func UploadSound(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "sound-upload"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	sound := bindSound(c)
+	sound.UploadedBy = user.ID
+
+	name, data, err := readUpload(c, media.MaxSoundBytes)
+	sound.OriginalName = name
+	if err != nil {
+		// Failed to read upload
+		staffLog.Create(false, methods.Error{Details: err, Data: sound})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	if err := sound.Upload(data); err != nil {
+		// Failed to upload sound
+		staffLog.Create(false, methods.Error{Details: err, Data: sound})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return sound
+	staffLog.Create(true, methods.Error{Data: sound})
+	return c.JSON(http.StatusOK, sound)
+}
+
+// ReadSound returns a single sound asset
+// @ GET /admin/sounds/:id
+func ReadSound(c echo.Context) error {
+	var filter methods.SoundAsset
+	filter.ID, _ = strconv.Atoi(c.Param("id"))
+
+	// Get the sound
+	sounds, err := filter.Read()
+	if err != nil || len(sounds) == 0 {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return sound
+	return c.JSON(http.StatusOK, sounds[0])
+}
+
+// UpdateSound updates the category, language, hero & skill of a
+// sound asset @ POST /admin/sounds/:id
+func UpdateSound(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "sound-update"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	sound := bindSound(c)
+	sound.ID, _ = strconv.Atoi(c.Param("id"))
+
+	if err := sound.Update(); err != nil {
+		// Failed to update sound
+		staffLog.Create(false, methods.Error{Details: err, Data: sound})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return sound
+	staffLog.Create(true, methods.Error{Data: sound})
+	return c.JSON(http.StatusOK, sound)
+}
+
+// DeleteSound deletes a sound asset
+// @ DELETE /admin/sounds/:id
+func DeleteSound(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "sound-delete"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	var sound methods.SoundAsset
+	sound.ID, _ = strconv.Atoi(c.Param("id"))
+
+	if err := sound.Delete(); err != nil {
+		// Failed to delete sound
+		staffLog.Create(false, methods.Error{Details: err, Data: sound})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return deleted sound
+	staffLog.Create(true, methods.Error{Data: sound})
+	return c.JSON(http.StatusOK, sound)
+}
+
+// bindSound binds the form values of a sound upload or update
+// request to a SoundAsset.
+func bindSound(c echo.Context) methods.SoundAsset {
+	sound := methods.SoundAsset{
+		Category: c.FormValue("category"),
+		Language: c.FormValue("language"),
+	}
+	sound.HeroID, _ = strconv.Atoi(c.FormValue("hero_id"))
+	sound.HeroSkillID, _ = strconv.Atoi(c.FormValue("hero_skill_id"))
+
+	return sound
+}
@@ -1 +1,164 @@
+// stats.go manages the base stats & growth curves of heroes.
 package hero
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// bindStats binds the form values of a hero's base stats. Every stat
+// is required, as heroes are always saved with all of their stats.
+func bindStats(c echo.Context) (methods.HeroBaseStat, error) {
+	var stats methods.HeroBaseStat
+	var err error
+
+	fields := []struct {
+		name  string
+		value *int
+	}{
+		{"attack", &stats.Attack},
+		{"crit_chance", &stats.CritChance},
+		{"crit_damage", &stats.CritDamage},
+		{"hit_chance", &stats.HitChance},
+		{"effectiveness", &stats.Effectiveness},
+		{"health", &stats.Health},
+		{"defence", &stats.Defence},
+		{"evasion", &stats.Evasion},
+		{"resistance", &stats.Resistance},
+	}
+
+	for _, field := range fields {
+		if *field.value, err = strconv.Atoi(c.FormValue(field.name)); err != nil {
+			return stats, errors.New("Base stat " + field.name +
+				" must be an integer")
+		}
+	}
+
+	return stats, nil
+}
+
+// IndexGrowthCurves returns the growth curves of every rarity & hero,
+// filtered by ?rarity & ?hero_id @ GET /admin/growth
+func IndexGrowthCurves(c echo.Context) error {
+	// Bind query parameters to model
+	filter := new(methods.GrowthCurve)
+	if err := c.Bind(filter); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.ErrBadRequest
+	}
+
+	// Get all applicable curves
+	curves, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return curves
+	return c.JSON(http.StatusOK, curves)
+}
+
+// SaveGrowthCurve creates or replaces the growth curve of a rarity
+// or a hero. Piecewise points are given as a JSON list of Level &
+// Multiplier objects @ POST /admin/growth
+func SaveGrowthCurve(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "growth-update"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	var curve methods.GrowthCurve
+	rarity, _ := strconv.Atoi(c.FormValue("rarity"))
+	curve.Rarity = methods.HeroRarity(rarity)
+	curve.HeroID, _ = strconv.Atoi(c.FormValue("hero_id"))
+	curve.Type = c.FormValue("type")
+	curve.Rate, _ = strconv.ParseFloat(c.FormValue("rate"), 64)
+	curve.MaxLevel, _ = strconv.Atoi(c.FormValue("max_level"))
+
+	if points := c.FormValue("points"); points != "" {
+		if err := json.Unmarshal([]byte(points), &curve.Points); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest,
+				"Points must be a JSON list")
+		}
+	}
+
+	if err := curve.Save(); err != nil {
+		// Failed to save curve
+		staffLog.Create(false, methods.Error{Details: err, Data: curve})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return curve
+	staffLog.Create(true, methods.Error{Data: curve})
+	return c.JSON(http.StatusOK, curve)
+}
+
+// DeleteGrowthCurve deletes a single growth curve
+// @ DELETE /admin/growth/:id
+func DeleteGrowthCurve(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "growth-delete"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	var curve methods.GrowthCurve
+	curve.ID, _ = strconv.Atoi(c.Param("id"))
+
+	if err := curve.Delete(); err != nil {
+		// Failed to delete curve
+		staffLog.Create(false, methods.Error{Details: err, Data: curve})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return curve
+	staffLog.Create(true, methods.Error{Data: curve})
+	return c.JSON(http.StatusOK, curve)
+}
+
+// CheckGrowthDrift returns the summons whose stored stats differ from
+// their stats recalculated from their growth curves
+// @ GET /admin/growth/drift
+func CheckGrowthDrift(c echo.Context) error {
+	drifts, err := methods.CheckSummonStats()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return drifted summons
+	return c.JSON(http.StatusOK, drifts)
+}
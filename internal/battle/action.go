@@ -0,0 +1,267 @@
+// action.go contains the registry of skill action types: what each
+// action does, and the JSON parameters it takes. The registry is the
+// single definition of actions shared by the game server & battles.
+package battle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+)
+
+// Types of action
+const (
+	ActionDamage  = "damage"
+	ActionHeal    = "heal"
+	ActionBuff    = "buff"
+	ActionDebuff  = "debuff"
+	ActionCleanse = "cleanse"
+	ActionStun    = "stun"
+	ActionSummon  = "summon"
+)
+
+// Kinds of action parameter
+const (
+	ParamNumber  = "number"
+	ParamInteger = "integer"
+	ParamString  = "string"
+)
+
+// kindNames name each kind of param in errors
+var kindNames = map[string]string{
+	ParamNumber:  "a number",
+	ParamInteger: "an integer",
+	ParamString:  "a string",
+}
+
+// Stats that buffs & debuffs can change
+var buffStats = []string{
+	"attack", "crit_chance", "crit_damage", "hit_chance", "effectiveness",
+	"defence", "evasion", "resistance",
+}
+
+//========================== ACTION TYPE =========================//
+// ActionType is a type of skill action, and the schema of its
+// parameters.
+//
+// Actions of the type are saved with a JSON object of Params. Params
+// that are not Required take their Default when left out, and params
+// that are not in the schema are rejected.
+//================================================================//
+type ActionType struct {
+	Type        string  `json:",omitempty"`
+	Description string  `json:",omitempty"`
+	Params      []Param `json:",omitempty"`
+}
+
+// Param is a parameter of an ActionType. Numbers & integers must be
+// between Min & Max, and strings must be one of Enum.
+type Param struct {
+	Name        string      `json:",omitempty"`
+	Kind        string      `json:",omitempty"`
+	Description string      `json:",omitempty"`
+	Required    bool        `json:",omitempty"`
+	Min         float64     `json:",omitempty"`
+	Max         float64     `json:",omitempty"`
+	Enum        []string    `json:",omitempty"`
+	Default     interface{} `json:",omitempty"`
+}
+
+// ActionParams are the decoded parameters of an action. Only the
+// params of the action's type are used.
+type ActionParams struct {
+	Multiplier float64 `json:"multiplier,omitempty"`
+	Hits       int     `json:"hits,omitempty"`
+	Target     string  `json:"target,omitempty"`
+	Stat       string  `json:"stat,omitempty"`
+	Amount     float64 `json:"amount,omitempty"`
+	Turns      int     `json:"turns,omitempty"`
+	Count      int     `json:"count,omitempty"`
+	HeroID     int     `json:"hero_id,omitempty"`
+}
+
+// ActionTypes is the registry of action types, by type.
+var ActionTypes = map[string]ActionType{
+	ActionDamage: {
+		Type:        ActionDamage,
+		Description: "Deals the skill's damage to the target",
+		Params: []Param{
+			{Name: "multiplier", Kind: ParamNumber, Min: 0, Max: 10, Default: 1.0,
+				Description: "Scales the skill's damage"},
+			{Name: "hits", Kind: ParamInteger, Min: 1, Max: 10, Default: 1,
+				Description: "Number of hits, each rolled separately"},
+		},
+	},
+	ActionHeal: {
+		Type:        ActionHeal,
+		Description: "Heals by a percentage of the healer's max health",
+		Params: []Param{
+			{Name: "amount", Kind: ParamNumber, Required: true, Min: 0, Max: 100,
+				Description: "Percentage of the healer's max health"},
+			{Name: "target", Kind: ParamString, Enum: []string{"self", "ally", "team"},
+				Default: "ally", Description: "Self, the weakest ally, or every ally"},
+		},
+	},
+	ActionBuff: {
+		Type:        ActionBuff,
+		Description: "Raises a stat of the caster's living allies for a number of turns",
+		Params: []Param{
+			{Name: "stat", Kind: ParamString, Required: true, Enum: buffStats},
+			{Name: "amount", Kind: ParamNumber, Required: true, Min: 0, Max: 100,
+				Description: "Percent of attack, defence & crit damage, or points of other stats"},
+			{Name: "turns", Kind: ParamInteger, Min: 1, Max: 10, Default: 2},
+		},
+	},
+	ActionDebuff: {
+		Type:        ActionDebuff,
+		Description: "Lowers a stat of the target for a number of turns, unless resisted",
+		Params: []Param{
+			{Name: "stat", Kind: ParamString, Required: true, Enum: buffStats},
+			{Name: "amount", Kind: ParamNumber, Required: true, Min: 0, Max: 100,
+				Description: "Percent of attack, defence & crit damage, or points of other stats"},
+			{Name: "turns", Kind: ParamInteger, Min: 1, Max: 10, Default: 2},
+		},
+	},
+	ActionCleanse: {
+		Type:        ActionCleanse,
+		Description: "Removes debuffs from the weakest ally",
+		Params: []Param{
+			{Name: "count", Kind: ParamInteger, Min: 1, Max: 10, Default: 1,
+				Description: "Most debuffs removed"},
+		},
+	},
+	ActionStun: {
+		Type:        ActionStun,
+		Description: "The target skips its turns, unless resisted",
+		Params: []Param{
+			{Name: "turns", Kind: ParamInteger, Min: 1, Max: 5, Default: 1},
+		},
+	},
+	ActionSummon: {
+		Type:        ActionSummon,
+		Description: "Calls another hero into battle (not simulated)",
+		Params: []Param{
+			{Name: "hero_id", Kind: ParamInteger, Required: true, Min: 1,
+				Max: math.MaxInt32},
+		},
+	},
+}
+
+// ListActionTypes returns the registry of action types, in order of
+// type.
+func ListActionTypes() []ActionType {
+	var types []ActionType
+	for _, actionType := range ActionTypes {
+		types = append(types, actionType)
+	}
+
+	sort.Slice(types, func(i, j int) bool {
+		return types[i].Type < types[j].Type
+	})
+
+	return types
+}
+
+// DecodeAction validates the JSON params of an action of the given
+// type against its schema, and returns them decoded with defaults.
+func DecodeAction(actionType string, params []byte) (ActionParams, error) {
+	var decoded ActionParams
+
+	schema, ok := ActionTypes[actionType]
+	if !ok {
+		return decoded, errors.New("Action type " + actionType + " is unknown")
+	}
+
+	values := make(map[string]interface{})
+	if len(bytes.TrimSpace(params)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(params))
+		decoder.UseNumber()
+		if err := decoder.Decode(&values); err != nil || decoder.More() {
+			return decoded, errors.New("Action params must be a JSON object")
+		}
+	}
+
+	// A null body decodes to no params
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+
+	known := make(map[string]bool)
+	for _, param := range schema.Params {
+		known[param.Name] = true
+
+		value, ok := values[param.Name]
+		if !ok {
+			if param.Required {
+				return decoded, errors.New("Action param " + param.Name +
+					" is required")
+			} else if param.Default != nil {
+				values[param.Name] = param.Default
+			}
+			continue
+		}
+
+		if err := param.check(value); err != nil {
+			return decoded, err
+		}
+
+		// Whole numbers such as 2.0 are integers, but only decode as
+		// integers without a fraction
+		if param.Kind == ParamInteger {
+			f, _ := value.(json.Number).Float64()
+			values[param.Name] = int64(f)
+		}
+	}
+
+	for name := range values {
+		if !known[name] {
+			return decoded, errors.New("Action param " + name + " is unknown")
+		}
+	}
+
+	// Values were checked, so they decode
+	checked, _ := json.Marshal(values)
+	err := json.Unmarshal(checked, &decoded)
+
+	return decoded, err
+}
+
+// Param.check returns an error if value is not a valid value of the
+// param.
+func (param *Param) check(value interface{}) error {
+	invalid := errors.New("Action param " + param.Name + " must be " +
+		kindNames[param.Kind])
+
+	switch param.Kind {
+	case ParamString:
+		text, ok := value.(string)
+		if !ok {
+			return invalid
+		}
+		for _, option := range param.Enum {
+			if text == option {
+				return nil
+			}
+		}
+		return errors.New("Action param " + param.Name + " is not an option")
+	case ParamNumber, ParamInteger:
+		number, ok := value.(json.Number)
+		if !ok {
+			return invalid
+		}
+
+		f, err := number.Float64()
+		if err != nil {
+			return invalid
+		} else if param.Kind == ParamInteger && f != math.Trunc(f) {
+			return invalid
+		} else if f < param.Min || f > param.Max {
+			return errors.New("Action param " + param.Name + " is out of range")
+		}
+		return nil
+	}
+
+	return invalid
+}
@@ -0,0 +1,78 @@
+package battle
+
+import "testing"
+
+func TestDecodeAction(t *testing.T) {
+	tests := []struct {
+		name       string
+		actionType string
+		params     string
+		want       ActionParams
+		fails      bool
+	}{
+		{name: "defaults", actionType: ActionDamage, params: `{}`,
+			want: ActionParams{Multiplier: 1, Hits: 1}},
+		{name: "empty body", actionType: ActionDamage, params: ``,
+			want: ActionParams{Multiplier: 1, Hits: 1}},
+		{name: "whitespace body", actionType: ActionDamage, params: " \n",
+			want: ActionParams{Multiplier: 1, Hits: 1}},
+		{name: "null body", actionType: ActionDamage, params: `null`,
+			want: ActionParams{Multiplier: 1, Hits: 1}},
+		{name: "given values", actionType: ActionDamage, params: `{"multiplier": 2.5, "hits": 3}`,
+			want: ActionParams{Multiplier: 2.5, Hits: 3}},
+		{name: "string option", actionType: ActionHeal, params: `{"amount": 20, "target": "team"}`,
+			want: ActionParams{Amount: 20, Target: "team"}},
+		{name: "string default", actionType: ActionHeal, params: `{"amount": 20}`,
+			want: ActionParams{Amount: 20, Target: "ally"}},
+		{name: "whole float integer", actionType: ActionStun, params: `{"turns": 2.0}`,
+			want: ActionParams{Turns: 2}},
+		{name: "unknown type", actionType: "explode", params: `{}`, fails: true},
+		{name: "null body missing required", actionType: ActionHeal, params: `null`, fails: true},
+		{name: "missing required", actionType: ActionBuff, params: `{"amount": 10}`, fails: true},
+		{name: "unknown param", actionType: ActionDamage, params: `{"power": 1}`, fails: true},
+		{name: "below min", actionType: ActionDamage, params: `{"hits": 0}`, fails: true},
+		{name: "above max", actionType: ActionStun, params: `{"turns": 6}`, fails: true},
+		{name: "fractional integer", actionType: ActionDamage, params: `{"hits": 1.5}`, fails: true},
+		{name: "number as string", actionType: ActionDamage, params: `{"hits": "2"}`, fails: true},
+		{name: "string as number", actionType: ActionBuff, params: `{"stat": 1, "amount": 1}`, fails: true},
+		{name: "not an option", actionType: ActionBuff, params: `{"stat": "luck", "amount": 1}`, fails: true},
+		{name: "null value", actionType: ActionDamage, params: `{"hits": null}`, fails: true},
+		{name: "array", actionType: ActionDamage, params: `[1, 2]`, fails: true},
+		{name: "string", actionType: ActionDamage, params: `"hits"`, fails: true},
+		{name: "number", actionType: ActionDamage, params: `3`, fails: true},
+		{name: "truncated", actionType: ActionDamage, params: `{"hits": 2`, fails: true},
+		{name: "trailing data", actionType: ActionDamage, params: `{"hits": 2} x`, fails: true},
+		{name: "malformed", actionType: ActionDamage, params: `{hits: 2}`, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			decoded, err := DecodeAction(test.actionType, []byte(test.params))
+			if test.fails {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", decoded)
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if decoded != test.want {
+				t.Errorf("decoded %+v, want %+v", decoded, test.want)
+			}
+		})
+	}
+}
+
+func TestListActionTypes(t *testing.T) {
+	types := ListActionTypes()
+	if len(types) != len(ActionTypes) {
+		t.Fatalf("listed %d types, want %d", len(types), len(ActionTypes))
+	}
+
+	for i := 1; i < len(types); i++ {
+		if types[i-1].Type >= types[i].Type {
+			t.Errorf("%s is listed before %s", types[i-1].Type, types[i].Type)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// damage.go contains the damage formula of skills, which scales the
+// attacker's stats by the skill's multipliers and reduces it by the
+// target's defence.
+package battle
+
+import (
+	"math"
+)
+
+// DefenceScale is the defence that halves damage taken. Damage is
+// reduced by DefenceScale / (DefenceScale + defence).
+var DefenceScale = 300.0
+
+// DamageVariance is the spread of damage around its mean, as a
+// fraction (0.05 is +-5%).
+var DamageVariance = 0.05
+
+// Stats are the stats of a hero in battle. Crit chance, hit chance,
+// effectiveness, evasion & resistance are percentages, and crit
+// damage is the percentage of damage a critical hit deals.
+type Stats struct {
+	Attack        int `json:",omitempty"`
+	CritChance    int `json:",omitempty"`
+	CritDamage    int `json:",omitempty"`
+	HitChance     int `json:",omitempty"`
+	Effectiveness int `json:",omitempty"`
+	Health        int `json:",omitempty"`
+	Defence       int `json:",omitempty"`
+	Evasion       int `json:",omitempty"`
+	Resistance    int `json:",omitempty"`
+}
+
+//========================== MULTIPLIER ==========================//
+// Multiplier is how a skill scales with stats.
+//
+// The attacker's attack, defence & health are scaled by Attack,
+// Defence & Health, and the sum by Power. PercentHealth deals a
+// fraction of the target's health on top. CritDamage is added to the
+// attacker's crit damage (as a fraction). The vs multipliers are
+// bonuses (as fractions) against debuffed targets, targets that
+// evaded their last attack, targets with high health (scaled by the
+// target's remaining health) & targets with a higher attack.
+//================================================================//
+type Multiplier struct {
+	Power         float64 `json:",omitempty"`
+	Attack        float64 `json:",omitempty"`
+	CritDamage    float64 `json:",omitempty"`
+	Defence       float64 `json:",omitempty"`
+	Health        float64 `json:",omitempty"`
+	PercentHealth float64 `json:",omitempty"`
+	VsDebuffed    float64 `json:",omitempty"`
+	VsEvaded      float64 `json:",omitempty"`
+	VsHighHP      float64 `json:",omitempty"`
+	VsHighAtk     float64 `json:",omitempty"`
+}
+
+// Advantage is the advantage of an attacking element over a
+// defending element: a damage multiplier and a hit chance bonus (in
+// percent, which may be negative).
+type Advantage struct {
+	Damage    float64 `json:",omitempty"`
+	HitChance int     `json:",omitempty"`
+}
+
+// Neutral is the Advantage between elements without one.
+var Neutral = Advantage{Damage: 1}
+
+// Target is the defender of a skill, with its remaining health (in
+// percent of its max health) and its status.
+type Target struct {
+	Stats
+	HealthPercent float64 `json:",omitempty"`
+	Debuffed      bool    `json:",omitempty"`
+	Evaded        bool    `json:",omitempty"`
+}
+
+// Range is the lowest, mean & highest damage of a hit.
+type Range struct {
+	Min  float64 `json:",omitempty"`
+	Mean float64 `json:",omitempty"`
+	Max  float64 `json:",omitempty"`
+}
+
+// DamageReport is the damage of a single use of a skill. Chances are
+// in percent. Expected is the mean damage, including misses & crits.
+type DamageReport struct {
+	HitChance  float64 `json:",omitempty"`
+	CritChance float64 `json:",omitempty"`
+	Normal     Range   `json:",omitempty"`
+	Crit       Range   `json:",omitempty"`
+	Expected   float64 `json:",omitempty"`
+}
+
+// Damage calculates the damage of a skill used by an attacker with
+// the given stats against a target.
+func Damage(
+	attacker Stats, target Target, skill Multiplier, advantage Advantage,
+) DamageReport {
+	var report DamageReport
+
+	report.HitChance = clamp(
+		float64(attacker.HitChance + advantage.HitChance - target.Evasion),
+	)
+	report.CritChance = clamp(float64(attacker.CritChance))
+
+	hit := skill.hit(attacker, target) * advantage.Damage
+	crit := hit * skill.critFactor(attacker)
+
+	report.Normal = spread(hit)
+	report.Crit = spread(crit)
+	report.Expected = report.HitChance / 100 *
+		(hit*(1-report.CritChance/100) + crit*report.CritChance/100)
+
+	return report
+}
+
+// Multiplier.hit returns the mean damage of a hit that is not a
+// critical hit, before elemental advantage.
+func (skill Multiplier) hit(attacker Stats, target Target) float64 {
+	scaling := float64(attacker.Attack)*skill.Attack +
+		float64(attacker.Defence)*skill.Defence +
+		float64(attacker.Health)*skill.Health
+	raw := scaling*skill.Power + float64(target.Health)*skill.PercentHealth
+
+	bonus := 1 + skill.VsHighHP*clamp(target.HealthPercent)/100
+	if target.Debuffed {
+		bonus += skill.VsDebuffed
+	}
+	if target.Evaded {
+		bonus += skill.VsEvaded
+	}
+	if target.Attack > attacker.Attack {
+		bonus += skill.VsHighAtk
+	}
+
+	defence := math.Max(float64(target.Defence), 0)
+	return math.Max(raw*bonus*DefenceScale/(DefenceScale+defence), 0)
+}
+
+// Multiplier.critFactor returns the factor that critical hits
+// multiply damage by, which is at least 1.
+func (skill Multiplier) critFactor(attacker Stats) float64 {
+	return math.Max(float64(attacker.CritDamage)/100+skill.CritDamage, 1)
+}
+
+// spread returns the Range of damage around a mean.
+func spread(mean float64) Range {
+	return Range{
+		Min:  mean * (1 - DamageVariance),
+		Mean: mean,
+		Max:  mean * (1 + DamageVariance),
+	}
+}
+
+// clamp bounds a percentage between 0 & 100.
+func clamp(percent float64) float64 {
+	return math.Min(math.Max(percent, 0), 100)
+}
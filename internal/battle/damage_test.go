@@ -0,0 +1,105 @@
+package battle
+
+import (
+	"math"
+	"testing"
+)
+
+// near reports whether two damages are equal, within rounding.
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestDamage(t *testing.T) {
+	attacker := Stats{Attack: 100, HitChance: 100}
+	basic := Multiplier{Power: 1, Attack: 1}
+
+	tests := []struct {
+		name      string
+		attacker  Stats
+		target    Target
+		skill     Multiplier
+		advantage Advantage
+		hit       float64
+		crit      float64
+		hitChance float64
+		expected  float64
+	}{
+		{name: "basic", attacker: attacker, skill: basic, advantage: Neutral,
+			hit: 100, crit: 100, hitChance: 100, expected: 100},
+		{name: "defence halves at scale", attacker: attacker, skill: basic,
+			target:    Target{Stats: Stats{Defence: 300}},
+			advantage: Neutral, hit: 50, crit: 50, hitChance: 100, expected: 50},
+		{name: "negative defence is none", attacker: attacker, skill: basic,
+			target:    Target{Stats: Stats{Defence: -300}},
+			advantage: Neutral, hit: 100, crit: 100, hitChance: 100, expected: 100},
+		{name: "crits", attacker: Stats{Attack: 100, HitChance: 100, CritChance: 50, CritDamage: 150},
+			skill: basic, advantage: Neutral, hit: 100, crit: 150, hitChance: 100, expected: 125},
+		{name: "skill crit damage", attacker: Stats{Attack: 100, HitChance: 100, CritChance: 100, CritDamage: 150},
+			skill: Multiplier{Power: 1, Attack: 1, CritDamage: 0.5}, advantage: Neutral,
+			hit: 100, crit: 200, hitChance: 100, expected: 200},
+		{name: "crits never lower damage", attacker: Stats{Attack: 100, HitChance: 100, CritChance: 100, CritDamage: 50},
+			skill: basic, advantage: Neutral, hit: 100, crit: 100, hitChance: 100, expected: 100},
+		{name: "crit chance clamps", attacker: Stats{Attack: 100, HitChance: 100, CritChance: 250, CritDamage: 200},
+			skill: basic, advantage: Neutral, hit: 100, crit: 200, hitChance: 100, expected: 200},
+		{name: "evasion", attacker: Stats{Attack: 100, HitChance: 90}, skill: basic,
+			target:    Target{Stats: Stats{Evasion: 40}},
+			advantage: Neutral, hit: 100, crit: 100, hitChance: 50, expected: 50},
+		{name: "hit chance clamps high", attacker: Stats{Attack: 100, HitChance: 90}, skill: basic,
+			advantage: Advantage{Damage: 1, HitChance: 20}, hit: 100, crit: 100, hitChance: 100, expected: 100},
+		{name: "hit chance clamps low", attacker: attacker, skill: basic,
+			target:    Target{Stats: Stats{Evasion: 120}},
+			advantage: Neutral, hit: 100, crit: 100, hitChance: 0, expected: 0},
+		{name: "advantage", attacker: attacker, skill: basic,
+			advantage: Advantage{Damage: 1.5}, hit: 150, crit: 150, hitChance: 100, expected: 150},
+		{name: "zero advantage", attacker: attacker, skill: basic,
+			advantage: Advantage{}, hit: 0, crit: 0, hitChance: 100, expected: 0},
+		{name: "defence & health scaling", attacker: Stats{Defence: 50, Health: 1000, HitChance: 100},
+			skill: Multiplier{Power: 2, Defence: 1, Health: 0.1}, advantage: Neutral,
+			hit: 300, crit: 300, hitChance: 100, expected: 300},
+		{name: "percent health", attacker: attacker, skill: Multiplier{PercentHealth: 0.1},
+			target:    Target{Stats: Stats{Health: 1000}},
+			advantage: Neutral, hit: 100, crit: 100, hitChance: 100, expected: 100},
+		{name: "vs high health", attacker: attacker, skill: Multiplier{Power: 1, Attack: 1, VsHighHP: 0.5},
+			target:    Target{HealthPercent: 150},
+			advantage: Neutral, hit: 150, crit: 150, hitChance: 100, expected: 150},
+		{name: "vs debuffed & evaded", attacker: attacker,
+			skill:     Multiplier{Power: 1, Attack: 1, VsDebuffed: 0.2, VsEvaded: 0.3},
+			target:    Target{Debuffed: true, Evaded: true},
+			advantage: Neutral, hit: 150, crit: 150, hitChance: 100, expected: 150},
+		{name: "vs high attack", attacker: attacker, skill: Multiplier{Power: 1, Attack: 1, VsHighAtk: 1},
+			target:    Target{Stats: Stats{Attack: 200}},
+			advantage: Neutral, hit: 200, crit: 200, hitChance: 100, expected: 200},
+		{name: "vs lower attack", attacker: attacker, skill: Multiplier{Power: 1, Attack: 1, VsHighAtk: 1},
+			target:    Target{Stats: Stats{Attack: 100}},
+			advantage: Neutral, hit: 100, crit: 100, hitChance: 100, expected: 100},
+		{name: "negative damage is none", attacker: attacker, skill: Multiplier{Power: -1, Attack: 1},
+			advantage: Neutral, hit: 0, crit: 0, hitChance: 100, expected: 0},
+		{name: "no stats", skill: basic, advantage: Neutral},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			report := Damage(test.attacker, test.target, test.skill, test.advantage)
+
+			if !near(report.Normal.Mean, test.hit) {
+				t.Errorf("hit = %v, want %v", report.Normal.Mean, test.hit)
+			}
+			if !near(report.Crit.Mean, test.crit) {
+				t.Errorf("crit = %v, want %v", report.Crit.Mean, test.crit)
+			}
+			if !near(report.HitChance, test.hitChance) {
+				t.Errorf("hit chance = %v, want %v", report.HitChance, test.hitChance)
+			}
+			if !near(report.Expected, test.expected) {
+				t.Errorf("expected = %v, want %v", report.Expected, test.expected)
+			}
+
+			normal := report.Normal
+			if !near(normal.Min, test.hit*(1-DamageVariance)) ||
+				!near(normal.Max, test.hit*(1+DamageVariance)) {
+				t.Errorf("range = %+v, want ±%v of %v", normal, DamageVariance, test.hit)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+// growth.go contains the growth curves that connect a hero's level
+// to its stats.
+package battle
+
+import (
+	"errors"
+	"math"
+	"sort"
+)
+
+// Types of growth curve
+const (
+	GrowthLinear      = "linear"
+	GrowthExponential = "exponential"
+	GrowthPiecewise   = "piecewise"
+)
+
+// MaxLevel is the highest level any curve can reach.
+const MaxLevel = 200
+
+//============================ CURVE =============================//
+// Curve is how a hero's attack, health & defence grow with its
+// level, as a multiplier of its base stats. Percentage stats (crit,
+// hit, effectiveness, evasion & resistance) do not grow.
+//
+// At level L, a linear curve multiplies by 1 + Rate × (L - 1), and
+// an exponential curve by (1 + Rate)^(L - 1). A piecewise curve
+// interpolates linearly between its Points, and holds the last
+// point's multiplier after it. Every curve is 1 at level 1.
+//================================================================//
+type Curve struct {
+	Type     string  `json:",omitempty"`
+	Rate     float64 `json:",omitempty"`
+	Points   []Point `json:",omitempty"`
+	MaxLevel int     `json:",omitempty"`
+}
+
+// Point is the multiplier of a piecewise Curve at a level.
+type Point struct {
+	Level      int     `json:",omitempty"`
+	Multiplier float64 `json:",omitempty"`
+}
+
+// Flat is the Curve of heroes without one: stats do not grow.
+var Flat = Curve{Type: GrowthLinear, MaxLevel: MaxLevel}
+
+// Curve.Check returns an error if the curve is invalid, and sorts
+// the points of a piecewise curve by level.
+func (curve *Curve) Check() error {
+	if curve.MaxLevel < 1 || curve.MaxLevel > MaxLevel {
+		return errors.New("Max level must be between 1 and 200")
+	}
+
+	switch curve.Type {
+	case GrowthLinear, GrowthExponential:
+		if curve.Rate < 0 {
+			return errors.New("Growth rate cannot be negative")
+		}
+	case GrowthPiecewise:
+		if len(curve.Points) == 0 {
+			return errors.New("Piecewise curves need points")
+		}
+
+		sort.Slice(curve.Points, func(i, j int) bool {
+			return curve.Points[i].Level < curve.Points[j].Level
+		})
+
+		for i, point := range curve.Points {
+			if point.Level < 1 || point.Level > curve.MaxLevel {
+				return errors.New("Points must be between level 1 and max level")
+			} else if point.Multiplier <= 0 {
+				return errors.New("Point multipliers must be positive")
+			} else if i > 0 && point.Level == curve.Points[i-1].Level {
+				return errors.New("Points cannot repeat a level")
+			}
+		}
+
+		if first := curve.Points[0]; first.Level == 1 && first.Multiplier != 1 {
+			return errors.New("Curves must be 1 at level 1")
+		}
+	default:
+		return errors.New("Curve must be linear, exponential or piecewise")
+	}
+
+	return nil
+}
+
+// Curve.Multiplier returns the multiplier of the curve at a level.
+func (curve *Curve) Multiplier(level int) float64 {
+	if level < 1 {
+		level = 1
+	}
+
+	switch curve.Type {
+	case GrowthExponential:
+		return math.Pow(1+curve.Rate, float64(level-1))
+	case GrowthPiecewise:
+		// Level 1 is always 1
+		prev := Point{Level: 1, Multiplier: 1}
+		for _, point := range curve.Points {
+			if level <= point.Level {
+				if point.Level == prev.Level {
+					return point.Multiplier
+				}
+				t := float64(level-prev.Level) / float64(point.Level-prev.Level)
+				return prev.Multiplier + t*(point.Multiplier-prev.Multiplier)
+			}
+			prev = point
+		}
+		return prev.Multiplier
+	}
+
+	return 1 + curve.Rate*float64(level-1)
+}
+
+// Curve.Apply returns the stats of a hero with the given base stats
+// at a level. Grown stats are rounded to the nearest whole number.
+func (curve *Curve) Apply(base Stats, level int) Stats {
+	multiplier := curve.Multiplier(level)
+
+	stats := base
+	stats.Attack = int(math.Round(float64(base.Attack) * multiplier))
+	stats.Health = int(math.Round(float64(base.Health) * multiplier))
+	stats.Defence = int(math.Round(float64(base.Defence) * multiplier))
+
+	return stats
+}
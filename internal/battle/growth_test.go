@@ -0,0 +1,176 @@
+package battle
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestCurveCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		curve Curve
+		fails bool
+	}{
+		{name: "flat", curve: Flat},
+		{name: "linear", curve: Curve{Type: GrowthLinear, Rate: 0.05, MaxLevel: 60}},
+		{name: "exponential", curve: Curve{Type: GrowthExponential, Rate: 0.02, MaxLevel: 60}},
+		{name: "piecewise", curve: Curve{Type: GrowthPiecewise, MaxLevel: 60, Points: []Point{
+			{Level: 20, Multiplier: 2}, {Level: 60, Multiplier: 4},
+		}}},
+		{name: "piecewise from level 1", curve: Curve{Type: GrowthPiecewise, MaxLevel: 60, Points: []Point{
+			{Level: 1, Multiplier: 1}, {Level: 60, Multiplier: 4},
+		}}},
+		{name: "single level", curve: Curve{Type: GrowthLinear, MaxLevel: 1}},
+		{name: "highest level", curve: Curve{Type: GrowthLinear, MaxLevel: MaxLevel}},
+		{name: "no max level", curve: Curve{Type: GrowthLinear}, fails: true},
+		{name: "max level too high", curve: Curve{Type: GrowthLinear, MaxLevel: MaxLevel + 1}, fails: true},
+		{name: "negative rate", curve: Curve{Type: GrowthExponential, Rate: -0.1, MaxLevel: 60}, fails: true},
+		{name: "unknown type", curve: Curve{Type: "cubic", MaxLevel: 60}, fails: true},
+		{name: "no type", curve: Curve{MaxLevel: 60}, fails: true},
+		{name: "no points", curve: Curve{Type: GrowthPiecewise, MaxLevel: 60}, fails: true},
+		{name: "point below level 1", curve: Curve{Type: GrowthPiecewise, MaxLevel: 60, Points: []Point{
+			{Level: 0, Multiplier: 1},
+		}}, fails: true},
+		{name: "point past max level", curve: Curve{Type: GrowthPiecewise, MaxLevel: 60, Points: []Point{
+			{Level: 61, Multiplier: 2},
+		}}, fails: true},
+		{name: "zero multiplier", curve: Curve{Type: GrowthPiecewise, MaxLevel: 60, Points: []Point{
+			{Level: 30, Multiplier: 0},
+		}}, fails: true},
+		{name: "repeated level", curve: Curve{Type: GrowthPiecewise, MaxLevel: 60, Points: []Point{
+			{Level: 30, Multiplier: 2}, {Level: 30, Multiplier: 3},
+		}}, fails: true},
+		{name: "not 1 at level 1", curve: Curve{Type: GrowthPiecewise, MaxLevel: 60, Points: []Point{
+			{Level: 1, Multiplier: 2},
+		}}, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.curve.Check(); test.fails && err == nil {
+				t.Error("expected an error")
+			} else if !test.fails && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestCurveCheckSortsPoints(t *testing.T) {
+	curve := Curve{Type: GrowthPiecewise, MaxLevel: 60, Points: []Point{
+		{Level: 60, Multiplier: 4}, {Level: 1, Multiplier: 1}, {Level: 20, Multiplier: 2},
+	}}
+	if err := curve.Check(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []Point{{Level: 1, Multiplier: 1}, {Level: 20, Multiplier: 2}, {Level: 60, Multiplier: 4}}
+	if !reflect.DeepEqual(curve.Points, want) {
+		t.Errorf("points = %v, want %v", curve.Points, want)
+	}
+}
+
+func TestCurveMultiplier(t *testing.T) {
+	linear := Curve{Type: GrowthLinear, Rate: 0.05, MaxLevel: 60}
+	exponential := Curve{Type: GrowthExponential, Rate: 0.1, MaxLevel: 60}
+	piecewise := Curve{Type: GrowthPiecewise, MaxLevel: 60, Points: []Point{
+		{Level: 11, Multiplier: 2}, {Level: 31, Multiplier: 2.5}, {Level: 51, Multiplier: 4.5},
+	}}
+	step := Curve{Type: GrowthPiecewise, MaxLevel: 60, Points: []Point{
+		{Level: 1, Multiplier: 1}, {Level: 2, Multiplier: 3},
+	}}
+
+	tests := []struct {
+		name       string
+		curve      Curve
+		level      int
+		multiplier float64
+	}{
+		{name: "flat", curve: Flat, level: 80, multiplier: 1},
+		{name: "linear at level 1", curve: linear, level: 1, multiplier: 1},
+		{name: "linear", curve: linear, level: 21, multiplier: 2},
+		{name: "linear at max level", curve: linear, level: 60, multiplier: 3.95},
+		{name: "linear below level 1", curve: linear, level: 0, multiplier: 1},
+		{name: "linear at a negative level", curve: linear, level: -5, multiplier: 1},
+		{name: "exponential at level 1", curve: exponential, level: 1, multiplier: 1},
+		{name: "exponential", curve: exponential, level: 3, multiplier: 1.21},
+		{name: "exponential at max level", curve: exponential, level: 60, multiplier: math.Pow(1.1, 59)},
+		{name: "exponential below level 1", curve: exponential, level: 0, multiplier: 1},
+		{name: "piecewise at level 1", curve: piecewise, level: 1, multiplier: 1},
+		{name: "piecewise before first point", curve: piecewise, level: 6, multiplier: 1.5},
+		{name: "piecewise at a point", curve: piecewise, level: 11, multiplier: 2},
+		{name: "piecewise between points", curve: piecewise, level: 21, multiplier: 2.25},
+		{name: "piecewise between later points", curve: piecewise, level: 46, multiplier: 4},
+		{name: "piecewise at last point", curve: piecewise, level: 51, multiplier: 4.5},
+		{name: "piecewise holds after last point", curve: piecewise, level: 60, multiplier: 4.5},
+		{name: "piecewise holds past max level", curve: piecewise, level: 200, multiplier: 4.5},
+		{name: "piecewise below level 1", curve: piecewise, level: 0, multiplier: 1},
+		{name: "step at level 1", curve: step, level: 1, multiplier: 1},
+		{name: "step", curve: step, level: 2, multiplier: 3},
+		{name: "step holds", curve: step, level: 3, multiplier: 3},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if multiplier := test.curve.Multiplier(test.level); !near(multiplier, test.multiplier) {
+				t.Errorf("multiplier = %v, want %v", multiplier, test.multiplier)
+			}
+		})
+	}
+}
+
+func TestCurveApply(t *testing.T) {
+	base := Stats{
+		Attack: 100, CritChance: 15, CritDamage: 150, HitChance: 90,
+		Effectiveness: 20, Health: 1001, Defence: 33, Evasion: 10,
+		Resistance: 25,
+	}
+
+	tests := []struct {
+		name    string
+		curve   Curve
+		level   int
+		attack  int
+		health  int
+		defence int
+	}{
+		{name: "level 1", curve: Curve{Type: GrowthLinear, Rate: 0.5, MaxLevel: 60}, level: 1,
+			attack: 100, health: 1001, defence: 33},
+		{name: "flat", curve: Flat, level: 100, attack: 100, health: 1001, defence: 33},
+		{name: "doubled", curve: Curve{Type: GrowthLinear, Rate: 0.5, MaxLevel: 60}, level: 3,
+			attack: 200, health: 2002, defence: 66},
+		// 1.5: 150, 1501.5 & 49.5
+		{name: "half rounds away from zero", curve: Curve{Type: GrowthLinear, Rate: 0.25, MaxLevel: 60}, level: 3,
+			attack: 150, health: 1502, defence: 50},
+		// 1.25: 125, 1251.25 & 41.25
+		{name: "rounds down", curve: Curve{Type: GrowthLinear, Rate: 0.25, MaxLevel: 60}, level: 2,
+			attack: 125, health: 1251, defence: 41},
+		// 1.75: 175, 1751.75 & 57.75
+		{name: "rounds up", curve: Curve{Type: GrowthLinear, Rate: 0.25, MaxLevel: 60}, level: 4,
+			attack: 175, health: 1752, defence: 58},
+		{name: "piecewise", curve: Curve{Type: GrowthPiecewise, MaxLevel: 60, Points: []Point{
+			{Level: 11, Multiplier: 2},
+		}}, level: 6, attack: 150, health: 1502, defence: 50},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stats := test.curve.Apply(base, test.level)
+
+			if stats.Attack != test.attack || stats.Health != test.health ||
+				stats.Defence != test.defence {
+				t.Errorf("attack, health & defence = %d, %d & %d, want %d, %d & %d",
+					stats.Attack, stats.Health, stats.Defence, test.attack,
+					test.health, test.defence)
+			}
+
+			// Percentage stats do not grow
+			grown := base
+			grown.Attack, grown.Health, grown.Defence = stats.Attack, stats.Health, stats.Defence
+			if stats != grown {
+				t.Errorf("stats = %+v, want only attack, health & defence to grow", stats)
+			}
+		})
+	}
+}
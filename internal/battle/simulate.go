@@ -0,0 +1,579 @@
+// simulate.go contains headless team-vs-team battles, so that heroes
+// can be balanced before they are published.
+package battle
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/axkeyz/gacha-api/internal/gacha"
+)
+
+// MaxRounds is the most rounds a battle lasts before it is a draw.
+const MaxRounds = 100
+
+// MaxSimulatedBattles is the most battles (matchups × battles) a
+// single simulation may run.
+const MaxSimulatedBattles = 200000
+
+// Unit is a hero in a team, with the stats it fights with.
+type Unit struct {
+	HeroID  int     `json:",omitempty"`
+	Name    string  `json:",omitempty"`
+	Element int     `json:",omitempty"`
+	Stats   Stats   `json:",omitempty"`
+	Skills  []Skill `json:",omitempty"`
+}
+
+// Skill is a skill of a Unit. Active skills are used in turn, and
+// passive skills are not simulated. Actions are carried out in
+// execution order; a skill without actions deals its damage once.
+type Skill struct {
+	ID         int        `json:",omitempty"`
+	IsActive   bool       `json:",omitempty"`
+	Multiplier Multiplier `json:",omitempty"`
+	Actions    []Action   `json:",omitempty"`
+}
+
+// Action is a single typed effect of a Skill (see ActionTypes),
+// carried out with a Chance (in percent).
+type Action struct {
+	Name   string       `json:",omitempty"`
+	Type   string       `json:",omitempty"`
+	Order  int          `json:",omitempty"`
+	Chance int          `json:",omitempty"`
+	Params ActionParams `json:",omitempty"`
+}
+
+// basicSkill is the skill of units without an active skill.
+var basicSkill = Skill{Multiplier: Multiplier{Power: 1, Attack: 1}}
+
+// basicAction is the action of skills without actions.
+var basicAction = Action{
+	Type:   ActionDamage,
+	Chance: 100,
+	Params: ActionParams{Multiplier: 1, Hits: 1},
+}
+
+// ElementPair is an attacking & a defending element.
+type ElementPair struct {
+	Attacker int
+	Defender int
+}
+
+// Matrix is the element advantage matrix. Pairs that are not in the
+// matrix are Neutral.
+type Matrix map[ElementPair]Advantage
+
+// Team is a named team of units, in slot order.
+type Team struct {
+	Name  string `json:",omitempty"`
+	Units []Unit `json:",omitempty"`
+}
+
+//========================== SIMULATION ==========================//
+// Simulation fights every pair of Teams against each other Battles
+// times, and reports the win rates of each matchup and hero.
+//
+// Turns are speed-free: each round, the units in each slot act in
+// slot order, and the team that acts first alternates every battle.
+// Units use their active skills in turn against the living enemy
+// with the least health.
+//
+// Each battle fights with its own Stream, derived from Seed, the
+// matchup & the battle's number, so a simulation gives the same
+// report for the same seed however many workers it runs on.
+//================================================================//
+type Simulation struct {
+	Teams   []Team `json:",omitempty"`
+	Matrix  Matrix `json:"-"`
+	Battles int    `json:",omitempty"`
+	Seed    int64  `json:",omitempty"`
+}
+
+// SimulationReport is the outcome of a Simulation.
+type SimulationReport struct {
+	Battles  int        `json:",omitempty"`
+	Seed     int64      `json:",omitempty"`
+	Matchups []Matchup  `json:",omitempty"`
+	Heroes   []HeroRate `json:",omitempty"`
+}
+
+// Matchup is the outcome of the battles between two teams (by their
+// index in the simulation).
+type Matchup struct {
+	Home     int     `json:",omitempty"`
+	Away     int     `json:",omitempty"`
+	HomeWins int     `json:",omitempty"`
+	AwayWins int     `json:",omitempty"`
+	Draws    int     `json:",omitempty"`
+	HomeRate float64 `json:",omitempty"`
+	AwayRate float64 `json:",omitempty"`
+	Rounds   float64 `json:",omitempty"`
+}
+
+// HeroRate is the win rate of the battles a hero fought in, and the
+// mean damage it dealt in each.
+type HeroRate struct {
+	HeroID  int     `json:",omitempty"`
+	Name    string  `json:",omitempty"`
+	Battles int     `json:",omitempty"`
+	Wins    int     `json:",omitempty"`
+	WinRate float64 `json:",omitempty"`
+	Damage  float64 `json:",omitempty"`
+}
+
+// Outcome is the outcome of a single battle. Winner is the index of
+// the winning team (0 or 1), or -1 for a draw. Damage is the damage
+// dealt by each unit, by team & slot.
+type Outcome struct {
+	Winner int
+	Rounds int          `json:",omitempty"`
+	Damage [2][]float64 `json:",omitempty"`
+}
+
+// fighter is the state of a Unit during a battle.
+type fighter struct {
+	unit    *Unit
+	health  float64
+	effects []effect
+	stunned int
+	evaded  bool
+	turn    int
+}
+
+// effect is a buff (or a debuff, with a negative amount) that
+// changes a stat of a fighter for its next turns.
+type effect struct {
+	stat   string
+	amount float64
+	turns  int
+}
+
+// Simulation.Check returns an error if the simulation is invalid.
+func (sim *Simulation) Check() error {
+	matchups := len(sim.Teams) * (len(sim.Teams) - 1) / 2
+
+	if matchups == 0 {
+		return errors.New("Simulation needs at least two teams")
+	} else if sim.Battles <= 0 {
+		return errors.New("Battles must be positive")
+	} else if sim.Battles > MaxSimulatedBattles/matchups {
+		return errors.New("Simulation has too many battles")
+	}
+
+	for _, team := range sim.Teams {
+		if len(team.Units) == 0 {
+			return errors.New("Teams cannot be empty")
+		}
+		for _, unit := range team.Units {
+			if unit.Stats.Health <= 0 {
+				return errors.New("Heroes must have health")
+			}
+		}
+	}
+
+	return nil
+}
+
+// Simulation.Run runs the simulation, spread over one worker per
+// CPU.
+func (sim *Simulation) Run() (SimulationReport, error) {
+	report := SimulationReport{Battles: sim.Battles, Seed: sim.Seed}
+
+	if err := sim.Check(); err != nil {
+		return report, err
+	}
+
+	for home := range sim.Teams {
+		for away := home + 1; away < len(sim.Teams); away++ {
+			report.Matchups = append(report.Matchups,
+				Matchup{Home: home, Away: away})
+		}
+	}
+
+	outcomes := make([][]Outcome, len(report.Matchups))
+	for i := range outcomes {
+		outcomes[i] = make([]Outcome, sim.Battles)
+	}
+
+	type job struct{ matchup, battle int }
+	next := make(chan job)
+
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range next {
+				matchup := report.Matchups[j.matchup]
+				outcomes[j.matchup][j.battle] = sim.Fight(
+					sim.Teams[matchup.Home], sim.Teams[matchup.Away],
+					sim.stream(j.matchup, j.battle), j.battle%2,
+				)
+			}
+		}()
+	}
+
+	for i := range outcomes {
+		for b := range outcomes[i] {
+			next <- job{i, b}
+		}
+	}
+	close(next)
+	wg.Wait()
+
+	// Combine the outcomes in order, so the report is deterministic
+	heroes := make(map[int]*HeroRate)
+	for i := range report.Matchups {
+		matchup := &report.Matchups[i]
+		teams := [2]Team{sim.Teams[matchup.Home], sim.Teams[matchup.Away]}
+		rounds := 0
+
+		for _, outcome := range outcomes[i] {
+			rounds += outcome.Rounds
+
+			switch outcome.Winner {
+			case 0:
+				matchup.HomeWins++
+			case 1:
+				matchup.AwayWins++
+			default:
+				matchup.Draws++
+			}
+
+			for side, team := range teams {
+				for slot, unit := range team.Units {
+					rate, ok := heroes[unit.HeroID]
+					if !ok {
+						rate = &HeroRate{HeroID: unit.HeroID, Name: unit.Name}
+						heroes[unit.HeroID] = rate
+					}
+					rate.Battles++
+					rate.Damage += outcome.Damage[side][slot]
+					if outcome.Winner == side {
+						rate.Wins++
+					}
+				}
+			}
+		}
+
+		matchup.HomeRate = float64(matchup.HomeWins) / float64(sim.Battles)
+		matchup.AwayRate = float64(matchup.AwayWins) / float64(sim.Battles)
+		matchup.Rounds = float64(rounds) / float64(sim.Battles)
+	}
+
+	for _, rate := range heroes {
+		rate.WinRate = float64(rate.Wins) / float64(rate.Battles)
+		rate.Damage /= float64(rate.Battles)
+		report.Heroes = append(report.Heroes, *rate)
+	}
+	sort.Slice(report.Heroes, func(i, j int) bool {
+		if report.Heroes[i].WinRate != report.Heroes[j].WinRate {
+			return report.Heroes[i].WinRate > report.Heroes[j].WinRate
+		}
+		return report.Heroes[i].HeroID < report.Heroes[j].HeroID
+	})
+
+	return report, nil
+}
+
+// Simulation.Fight fights a single battle between two teams, drawing
+// from src. The team given by first acts first each round.
+func (sim *Simulation) Fight(home, away Team, src gacha.Source, first int) Outcome {
+	outcome := Outcome{Winner: -1}
+	teams := [2][]*fighter{newFighters(home), newFighters(away)}
+	outcome.Damage = [2][]float64{
+		make([]float64, len(home.Units)), make([]float64, len(away.Units)),
+	}
+
+	slots := len(home.Units)
+	if len(away.Units) > slots {
+		slots = len(away.Units)
+	}
+
+	for outcome.Rounds < MaxRounds {
+		outcome.Rounds++
+
+		for slot := 0; slot < slots; slot++ {
+			for _, side := range [2]int{first, 1 - first} {
+				if slot >= len(teams[side]) {
+					continue
+				}
+
+				actor := teams[side][slot]
+				if actor.health <= 0 {
+					continue
+				} else if actor.stunned > 0 {
+					actor.stunned--
+					continue
+				}
+
+				outcome.Damage[side][slot] += sim.act(
+					actor, teams[side], teams[1-side], src,
+				)
+
+				if !alive(teams[1-side]) {
+					outcome.Winner = side
+					return outcome
+				}
+			}
+		}
+	}
+
+	return outcome
+}
+
+// Simulation.act carries out the next active skill of a fighter,
+// and returns the damage it dealt.
+func (sim *Simulation) act(
+	actor *fighter, allies, enemies []*fighter, src gacha.Source,
+) float64 {
+	skill := actor.nextSkill()
+	target := weakest(enemies)
+	dealt := 0.0
+
+	actions := skill.Actions
+	if len(actions) == 0 {
+		actions = []Action{basicAction}
+	}
+
+	for _, action := range actions {
+		if target == nil {
+			break
+		} else if gacha.Intn(src, 100) >= action.Chance {
+			continue
+		}
+
+		params := action.Params
+		switch action.Type {
+		case ActionDamage:
+			for hit := 0; hit < params.Hits && target != nil; hit++ {
+				dealt += sim.strike(actor, target, skill, params.Multiplier, src)
+				if target.health <= 0 {
+					target = weakest(enemies)
+				}
+			}
+		case ActionHeal:
+			amount := float64(actor.unit.Stats.Health) * params.Amount / 100
+			for _, ally := range healed(actor, allies, params.Target) {
+				ally.health = math.Min(
+					ally.health+amount, float64(ally.unit.Stats.Health),
+				)
+			}
+		case ActionBuff:
+			for _, ally := range allies {
+				if ally.health > 0 {
+					ally.effects = append(ally.effects,
+						effect{params.Stat, params.Amount, params.Turns})
+				}
+			}
+		case ActionDebuff:
+			if !resisted(actor, target, src) {
+				target.effects = append(target.effects,
+					effect{params.Stat, -params.Amount, params.Turns})
+			}
+		case ActionCleanse:
+			weakest(allies).cleanse(params.Count)
+		case ActionStun:
+			if !resisted(actor, target, src) && params.Turns > target.stunned {
+				target.stunned = params.Turns
+			}
+		}
+	}
+
+	actor.tick()
+
+	return dealt
+}
+
+// Simulation.strike deals the damage of a skill (scaled by scale) to
+// a target, and returns the damage dealt.
+func (sim *Simulation) strike(
+	actor, target *fighter, skill Skill, scale float64, src gacha.Source,
+) float64 {
+	advantage, ok := sim.Matrix[ElementPair{
+		Attacker: actor.unit.Element, Defender: target.unit.Element,
+	}]
+	if !ok {
+		advantage = Neutral
+	}
+
+	report := Damage(actor.stats(), target.target(), skill.Multiplier,
+		advantage)
+
+	// Missed attacks are evaded
+	target.evaded = float64(gacha.Intn(src, 10000)) >= report.HitChance*100
+	if target.evaded {
+		return 0
+	}
+
+	hit := report.Normal
+	if float64(gacha.Intn(src, 10000)) < report.CritChance*100 {
+		hit = report.Crit
+	}
+
+	amount := hit.Min + (hit.Max-hit.Min)*float64(gacha.Intn(src, 10001))/10000
+	amount = math.Min(amount*scale, target.health)
+	target.health -= amount
+
+	return amount
+}
+
+// Simulation.stream returns the Stream of a single battle.
+func (sim *Simulation) stream(matchup, battle int) *gacha.Stream {
+	seed := make([]byte, 24)
+	binary.BigEndian.PutUint64(seed[:8], uint64(sim.Seed))
+	binary.BigEndian.PutUint64(seed[8:16], uint64(matchup))
+	binary.BigEndian.PutUint64(seed[16:], uint64(battle))
+
+	return &gacha.Stream{Seed: seed}
+}
+
+// newFighters returns the fighters of a team at full health.
+func newFighters(team Team) []*fighter {
+	fighters := make([]*fighter, len(team.Units))
+	for i := range team.Units {
+		fighters[i] = &fighter{
+			unit:   &team.Units[i],
+			health: float64(team.Units[i].Stats.Health),
+		}
+	}
+
+	return fighters
+}
+
+// fighter.nextSkill returns the active skill the fighter uses this
+// turn.
+func (f *fighter) nextSkill() Skill {
+	var active []Skill
+	for _, skill := range f.unit.Skills {
+		if skill.IsActive {
+			active = append(active, skill)
+		}
+	}
+
+	f.turn++
+	if len(active) == 0 {
+		return basicSkill
+	}
+
+	return active[(f.turn-1)%len(active)]
+}
+
+// fighter.target returns the fighter as the Target of a skill.
+func (f *fighter) target() Target {
+	debuffed := false
+	for _, e := range f.effects {
+		debuffed = debuffed || e.amount < 0
+	}
+
+	return Target{
+		Stats:         f.stats(),
+		HealthPercent: 100 * f.health / float64(f.unit.Stats.Health),
+		Debuffed:      debuffed,
+		Evaded:        f.evaded,
+	}
+}
+
+// fighter.stats returns the stats of the fighter with its effects.
+// Effects change attack, defence & crit damage by a percentage, and
+// change the other (percentage) stats by points.
+func (f *fighter) stats() Stats {
+	stats := f.unit.Stats
+	change := make(map[string]float64)
+	for _, e := range f.effects {
+		change[e.stat] += e.amount
+	}
+
+	stats.Attack = scaled(stats.Attack, change["attack"])
+	stats.Defence = scaled(stats.Defence, change["defence"])
+	stats.CritDamage = scaled(stats.CritDamage, change["crit_damage"])
+	stats.CritChance += int(change["crit_chance"])
+	stats.HitChance += int(change["hit_chance"])
+	stats.Effectiveness += int(change["effectiveness"])
+	stats.Evasion += int(change["evasion"])
+	stats.Resistance += int(change["resistance"])
+
+	return stats
+}
+
+// fighter.tick counts down the fighter's effects after its turn, and
+// removes those that have run out.
+func (f *fighter) tick() {
+	var effects []effect
+	for _, e := range f.effects {
+		if e.turns--; e.turns > 0 {
+			effects = append(effects, e)
+		}
+	}
+	f.effects = effects
+}
+
+// fighter.cleanse removes up to count of the fighter's debuffs,
+// oldest first.
+func (f *fighter) cleanse(count int) {
+	var effects []effect
+	for _, e := range f.effects {
+		if e.amount < 0 && count > 0 {
+			count--
+			continue
+		}
+		effects = append(effects, e)
+	}
+	f.effects = effects
+}
+
+// healed returns the fighters that a heal of the actor reaches: the
+// actor, the weakest ally, or every living ally.
+func healed(actor *fighter, allies []*fighter, target string) []*fighter {
+	switch target {
+	case "self":
+		return []*fighter{actor}
+	case "team":
+		var living []*fighter
+		for _, ally := range allies {
+			if ally.health > 0 {
+				living = append(living, ally)
+			}
+		}
+		return living
+	}
+
+	return []*fighter{weakest(allies)}
+}
+
+// scaled changes a stat by a percentage, down to no less than 0.
+func scaled(stat int, percent float64) int {
+	return int(math.Round(float64(stat) * math.Max(1+percent/100, 0)))
+}
+
+// resisted returns true if the target resists an effect of the
+// actor. Effects are resisted with a chance of the target's
+// resistance less the actor's effectiveness.
+func resisted(actor, target *fighter, src gacha.Source) bool {
+	chance := target.stats().Resistance - actor.stats().Effectiveness
+	return gacha.Intn(src, 100) < chance
+}
+
+// weakest returns the living fighter with the least health, or nil
+// if none are alive. Ties go to the earliest slot.
+func weakest(fighters []*fighter) *fighter {
+	var weakest *fighter
+	for _, f := range fighters {
+		if f.health > 0 && (weakest == nil || f.health < weakest.health) {
+			weakest = f
+		}
+	}
+
+	return weakest
+}
+
+// alive returns true if any fighter is alive.
+func alive(fighters []*fighter) bool {
+	return weakest(fighters) != nil
+}
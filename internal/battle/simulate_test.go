@@ -0,0 +1,142 @@
+package battle
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/axkeyz/gacha-api/internal/gacha"
+)
+
+// team returns a team of one unit with the given attack & health,
+// that always hits.
+func team(heroID, attack, health int) Team {
+	return Team{Units: []Unit{{
+		HeroID: heroID,
+		Stats:  Stats{Attack: attack, Health: health, HitChance: 100},
+	}}}
+}
+
+func TestSimulationCheck(t *testing.T) {
+	valid := []Team{team(1, 10, 100), team(2, 10, 100)}
+
+	tests := []struct {
+		name  string
+		sim   Simulation
+		fails bool
+	}{
+		{name: "valid", sim: Simulation{Teams: valid, Battles: 10}},
+		{name: "most battles", sim: Simulation{Teams: valid, Battles: MaxSimulatedBattles}},
+		{name: "no teams", sim: Simulation{Battles: 10}, fails: true},
+		{name: "one team", sim: Simulation{Teams: valid[:1], Battles: 10}, fails: true},
+		{name: "no battles", sim: Simulation{Teams: valid}, fails: true},
+		{name: "negative battles", sim: Simulation{Teams: valid, Battles: -1}, fails: true},
+		{name: "too many battles", sim: Simulation{Teams: valid, Battles: MaxSimulatedBattles + 1}, fails: true},
+		{name: "too many matchups", sim: Simulation{
+			Teams:   []Team{valid[0], valid[1], valid[0]},
+			Battles: MaxSimulatedBattles / 2,
+		}, fails: true},
+		{name: "empty team", sim: Simulation{Teams: []Team{valid[0], {}}, Battles: 10}, fails: true},
+		{name: "no health", sim: Simulation{Teams: []Team{valid[0], team(3, 10, 0)}, Battles: 10}, fails: true},
+		{name: "negative health", sim: Simulation{Teams: []Team{valid[0], team(3, 10, -5)}, Battles: 10}, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.sim.Check(); test.fails && err == nil {
+				t.Error("expected an error")
+			} else if !test.fails && err != nil {
+				t.Error(err)
+			}
+
+			// Invalid simulations are not run
+			if test.fails {
+				if _, err := test.sim.Run(); err == nil {
+					t.Error("expected Run to fail")
+				}
+			}
+		})
+	}
+}
+
+func TestFight(t *testing.T) {
+	stun := team(3, 0, 100)
+	stun.Units[0].Skills = []Skill{{IsActive: true, Actions: []Action{{
+		Type: ActionStun, Chance: 100, Params: ActionParams{Turns: 5},
+	}}}}
+
+	tests := []struct {
+		name   string
+		home   Team
+		away   Team
+		first  int
+		winner int
+		rounds int
+		damage [2][]float64
+	}{
+		{name: "one hit", home: team(1, 1000, 100), away: team(2, 1000, 10),
+			winner: 0, rounds: 1, damage: [2][]float64{{10}, {0}}},
+		{name: "away acts first", home: team(1, 1000, 10), away: team(2, 1000, 100),
+			first: 1, winner: 1, rounds: 1, damage: [2][]float64{{0}, {10}}},
+		{name: "no damage is a draw", home: team(1, 0, 100), away: team(2, 0, 100),
+			winner: -1, rounds: MaxRounds, damage: [2][]float64{{0}, {0}}},
+		{name: "stunned forever", home: stun, away: team(2, 1000, 100),
+			winner: -1, rounds: MaxRounds, damage: [2][]float64{{0}, {0}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var sim Simulation
+			src := &gacha.Stream{Seed: []byte(test.name)}
+
+			outcome := sim.Fight(test.home, test.away, src, test.first)
+			if outcome.Winner != test.winner || outcome.Rounds != test.rounds {
+				t.Errorf("winner %d after %d rounds, want %d after %d",
+					outcome.Winner, outcome.Rounds, test.winner, test.rounds)
+			}
+			if !reflect.DeepEqual(outcome.Damage, test.damage) {
+				t.Errorf("damage = %v, want %v", outcome.Damage, test.damage)
+			}
+		})
+	}
+}
+
+func TestSimulationRun(t *testing.T) {
+	strong, weak := team(1, 1000, 1000), team(2, 1, 100)
+	sim := Simulation{
+		Teams:   []Team{strong, weak, team(3, 50, 500)},
+		Battles: 50,
+		Seed:    42,
+	}
+
+	report, err := sim.Run()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Matchups) != 3 {
+		t.Fatalf("%d matchups, want 3", len(report.Matchups))
+	}
+	first := report.Matchups[0]
+	if first.Home != 0 || first.Away != 1 || first.HomeWins != sim.Battles ||
+		first.HomeRate != 1 || first.AwayRate != 0 {
+		t.Errorf("strong vs weak = %+v, want every battle won by home", first)
+	}
+
+	if len(report.Heroes) != 3 || report.Heroes[0].HeroID != 1 {
+		t.Errorf("heroes = %+v, want the strong hero first", report.Heroes)
+	}
+	for _, hero := range report.Heroes {
+		if hero.Battles != 2*sim.Battles {
+			t.Errorf("hero %d fought %d battles, want %d", hero.HeroID,
+				hero.Battles, 2*sim.Battles)
+		}
+	}
+
+	// The same seed gives the same report
+	again, err := sim.Run()
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(report, again) {
+		t.Errorf("reports of the same seed differ:\n%+v\n%+v", report, again)
+	}
+}
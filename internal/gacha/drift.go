@@ -0,0 +1,137 @@
+// drift.go contains the statistical tests that compare the observed
+// outcomes of a loot table with its configured rates.
+package gacha
+
+import (
+	"math"
+)
+
+// minExpected is the smallest expected count a cell may have in a
+// chi-square test. Smaller cells are pooled together.
+const minExpected = 5
+
+// LootTable.Chances returns the chance of a pull picking each tier
+// (in the order of table.Tiers), given the pulls since the last top
+// tier hero. The table must pass LootTable.Check.
+func (table *LootTable) Chances(pulls int) []float64 {
+	chances := make([]float64, len(table.Tiers))
+
+	top, total, others := table.top(), 0, 0
+	for i, tier := range table.Tiers {
+		total += tier.Rate
+		if i != top {
+			others += tier.Rate
+		}
+	}
+
+	topRate := table.Pity.Rate(table.Tiers[top].Rate, pulls+1)
+	if topRate > total || others == 0 {
+		topRate = total
+	}
+
+	topChance := float64(topRate) / float64(total)
+	for i, tier := range table.Tiers {
+		if i == top {
+			chances[i] = topChance
+		} else {
+			chances[i] = (1 - topChance) * float64(tier.Rate) / float64(others)
+		}
+	}
+
+	return chances
+}
+
+// ChiSquare runs Pearson's chi-square goodness of fit test of the
+// observed counts against the expected counts. Cells expected less
+// than 5 times are pooled, and if fewer than 2 cells remain there is
+// nothing to test (df is 0 and p is 1).
+func ChiSquare(observed []int, expected []float64) (stat float64, df int, p float64) {
+	var pooledObserved, pooledExpected float64
+	cells := 0
+
+	for i := range observed {
+		if expected[i] < minExpected {
+			pooledObserved += float64(observed[i])
+			pooledExpected += expected[i]
+			continue
+		}
+
+		diff := float64(observed[i]) - expected[i]
+		stat += diff * diff / expected[i]
+		cells++
+	}
+
+	if pooledExpected >= minExpected {
+		diff := pooledObserved - pooledExpected
+		stat += diff * diff / pooledExpected
+		cells++
+	}
+
+	if cells < 2 {
+		return 0, 0, 1
+	}
+
+	df = cells - 1
+	return stat, df, gammaQ(float64(df)/2, stat/2)
+}
+
+// gammaQ returns the regularised upper incomplete gamma function
+// Q(a, x), which is the p-value of a chi-square statistic 2x with 2a
+// degrees of freedom.
+func gammaQ(a float64, x float64) float64 {
+	if x <= 0 {
+		return 1
+	} else if x < a+1 {
+		return 1 - gammaSeries(a, x)
+	}
+	return gammaFraction(a, x)
+}
+
+// gammaSeries returns P(a, x) by its series, for x < a + 1.
+func gammaSeries(a float64, x float64) float64 {
+	lgamma, _ := math.Lgamma(a)
+
+	term := 1 / a
+	sum := term
+	for n := 1; n < 1000; n++ {
+		term *= x / (a + float64(n))
+		sum += term
+		if math.Abs(term) < math.Abs(sum)*1e-15 {
+			break
+		}
+	}
+
+	return sum * math.Exp(-x+a*math.Log(x)-lgamma)
+}
+
+// gammaFraction returns Q(a, x) by its continued fraction (modified
+// Lentz's method), for x >= a + 1.
+func gammaFraction(a float64, x float64) float64 {
+	const tiny = 1e-300
+	lgamma, _ := math.Lgamma(a)
+
+	b := x + 1 - a
+	c := 1 / tiny
+	d := 1 / b
+	h := d
+	for i := 1; i < 1000; i++ {
+		an := -float64(i) * (float64(i) - a)
+		b += 2
+
+		if d = an*d + b; math.Abs(d) < tiny {
+			d = tiny
+		}
+		if c = b + an/c; math.Abs(c) < tiny {
+			c = tiny
+		}
+
+		d = 1 / d
+		delta := d * c
+		h *= delta
+		if math.Abs(delta-1) < 1e-15 {
+			break
+		}
+	}
+
+	return math.Exp(-x+a*math.Log(x)-lgamma) * h
+}
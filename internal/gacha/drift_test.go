@@ -0,0 +1,143 @@
+package gacha
+
+import (
+	"math"
+	"testing"
+)
+
+// chiSquareP returns the p-value of a chi-square statistic by its
+// closed form, for 1 or an even number of degrees of freedom.
+func chiSquareP(stat float64, df int) float64 {
+	if df == 1 {
+		return math.Erfc(math.Sqrt(stat / 2))
+	}
+
+	// Q(k, x) = e^-x * sum x^i / i! for i < k
+	x, term, sum := stat/2, 1.0, 1.0
+	for i := 1; i < df/2; i++ {
+		term *= x / float64(i)
+		sum += term
+	}
+	return math.Exp(-x) * sum
+}
+
+func TestGammaQ(t *testing.T) {
+	tests := []struct {
+		name string
+		stat float64
+		df   int
+		p    float64
+	}{
+		// Critical values from chi-square tables
+		{name: "df 1 at 5%", stat: 3.841459, df: 1, p: 0.05},
+		{name: "df 1 at 1%", stat: 6.634897, df: 1, p: 0.01},
+		{name: "df 2 at 5%", stat: 5.991465, df: 2, p: 0.05},
+		{name: "df 3 at 5%", stat: 7.814728, df: 3, p: 0.05},
+		{name: "df 4 at 5%", stat: 9.487729, df: 4, p: 0.05},
+		{name: "df 10 at 50%", stat: 9.341818, df: 10, p: 0.5},
+		{name: "df 10 at 5%", stat: 18.307038, df: 10, p: 0.05},
+		{name: "df 30 at 95%", stat: 18.492661, df: 30, p: 0.95},
+		{name: "df 100 at 5%", stat: 124.342113, df: 100, p: 0.05},
+		{name: "df 100 at 0.1%", stat: 149.449252, df: 100, p: 0.001},
+
+		// Closed forms, by the series (x < a + 1)
+		{name: "df 1 by series", stat: 1, df: 1, p: chiSquareP(1, 1)},
+		{name: "df 2 by series", stat: 2, df: 2, p: chiSquareP(2, 2)},
+		{name: "df 6 by series", stat: 5, df: 6, p: chiSquareP(5, 6)},
+
+		// Either side of the crossover at x = a + 1
+		{name: "df 4 below crossover", stat: 5.999999, df: 4, p: chiSquareP(5.999999, 4)},
+		{name: "df 4 at crossover", stat: 6, df: 4, p: chiSquareP(6, 4)},
+		{name: "df 4 above crossover", stat: 6.000001, df: 4, p: chiSquareP(6.000001, 4)},
+		{name: "df 20 below crossover", stat: 21.99, df: 20, p: chiSquareP(21.99, 20)},
+		{name: "df 20 above crossover", stat: 22.01, df: 20, p: chiSquareP(22.01, 20)},
+
+		// Closed forms, by the continued fraction (x >= a + 1)
+		{name: "df 1 by fraction", stat: 10, df: 1, p: chiSquareP(10, 1)},
+		{name: "df 2 by fraction", stat: 40, df: 2, p: chiSquareP(40, 2)},
+		{name: "df 8 far in the tail", stat: 200, df: 8, p: chiSquareP(200, 8)},
+
+		{name: "no statistic", stat: 0, df: 5, p: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p := gammaQ(float64(test.df)/2, test.stat/2)
+			if math.Abs(p-test.p) > 1e-6*math.Max(test.p, 1e-3) {
+				t.Errorf("p = %.10g, want %.10g", p, test.p)
+			}
+		})
+	}
+}
+
+func TestChiSquare(t *testing.T) {
+	tests := []struct {
+		name     string
+		observed []int
+		expected []float64
+		stat     float64
+		df       int
+	}{
+		{name: "exact fit", observed: []int{50, 30, 20}, expected: []float64{50, 30, 20}, stat: 0, df: 2},
+		{name: "two cells", observed: []int{60, 40}, expected: []float64{50, 50}, stat: 4, df: 1},
+		{name: "three cells", observed: []int{940, 48, 12}, expected: []float64{940, 50, 10}, stat: 0.48, df: 2},
+		{name: "small cells pooled", observed: []int{40, 60, 2, 3}, expected: []float64{50, 50, 2.5, 2.5}, stat: 4, df: 2},
+		{name: "small pool dropped", observed: []int{40, 60, 3}, expected: []float64{50, 50, 1}, stat: 4, df: 1},
+		{name: "zero expected", observed: []int{50, 50, 3}, expected: []float64{50, 50, 0}, stat: 0, df: 1},
+		{name: "all expected zero", observed: []int{0, 0}, expected: []float64{0, 0}},
+		{name: "single category", observed: []int{100}, expected: []float64{100}},
+		{name: "single category off", observed: []int{80}, expected: []float64{100}},
+		{name: "one cell after pooling", observed: []int{100, 1, 2}, expected: []float64{100, 1, 2}},
+		{name: "no categories", observed: []int{}, expected: []float64{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stat, df, p := ChiSquare(test.observed, test.expected)
+			if math.Abs(stat-test.stat) > 1e-9 || df != test.df {
+				t.Errorf("stat = %v with df %d, want %v with df %d", stat, df,
+					test.stat, test.df)
+			}
+
+			want := 1.0
+			if test.df > 0 {
+				want = gammaQ(float64(test.df)/2, test.stat/2)
+			}
+			if math.IsNaN(p) || math.Abs(p-want) > 1e-12 {
+				t.Errorf("p = %v, want %v", p, want)
+			}
+		})
+	}
+}
+
+func TestChances(t *testing.T) {
+	table := pityTable()
+
+	tests := []struct {
+		name    string
+		pulls   int
+		chances []float64
+	}{
+		{name: "no pity", pulls: 0, chances: []float64{0.94, 0.05, 0.01}},
+		{name: "first soft pity pull", pulls: 73, chances: []float64{0.94 * 0.93 / 0.99, 0.05 * 0.93 / 0.99, 0.07}},
+		{name: "hard pity", pulls: 89, chances: []float64{0, 0, 1}},
+		{name: "past hard pity", pulls: 200, chances: []float64{0, 0, 1}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			chances := table.Chances(test.pulls)
+
+			total := 0.0
+			for i, chance := range chances {
+				total += chance
+				if math.Abs(chance-test.chances[i]) > 1e-9 {
+					t.Errorf("tier %d chance = %v, want %v", i, chance, test.chances[i])
+				}
+			}
+			if math.Abs(total-1) > 1e-9 {
+				t.Errorf("chances total %v", total)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+// loot.go contains the loot (drop) tables that summons are picked
+// from. A pull first picks a rarity tier by its rate, and then a
+// hero within that tier by its weight.
+package gacha
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math"
+)
+
+// RateScale is a rate of 100%. Rates are stored in millionths so
+// that a table's rates can be summed exactly.
+const RateScale = 1000000
+
+//========================== LOOT TABLE ==========================//
+// LootTable is the drop table of a single banner.
+//
+// The tier with the highest rarity is the top tier, which is the
+// tier that Pity applies to.
+//================================================================//
+type LootTable struct {
+	Tiers []Tier `json:",omitempty"`
+	Pity  Pity   `json:",omitempty"`
+}
+
+// Tier is a rarity tier of a LootTable, and the heroes that can be
+// pulled when the tier is picked.
+type Tier struct {
+	Rarity int     `json:",omitempty"`
+	Rate   int     `json:",omitempty"`
+	Heroes []Entry `json:",omitempty"`
+}
+
+// Entry is a hero within a Tier. Featured heroes are the rate-up
+// heroes of the banner.
+type Entry struct {
+	HeroID   int  `json:",omitempty"`
+	Weight   int  `json:",omitempty"`
+	Featured bool `json:",omitempty"`
+}
+
+// Result is the outcome of a single pull. PityCount is the number of
+// pulls since the last top tier hero, before this pull.
+type Result struct {
+	HeroID    int  `json:",omitempty"`
+	Rarity    int  `json:",omitempty"`
+	Featured  bool `json:",omitempty"`
+	IsTop     bool `json:",omitempty"`
+	PityCount int  `json:",omitempty"`
+}
+
+// RateFromPercent converts a percentage (such as 0.75 for 0.75%)
+// to a rate in millionths.
+func RateFromPercent(percent float64) int {
+	return int(math.Round(percent * RateScale / 100))
+}
+
+// LootTable.Check returns an error if no hero can be pulled from the
+// table, or if any tier has a rate but no heroes.
+func (table *LootTable) Check() error {
+	total := 0
+
+	for _, tier := range table.Tiers {
+		if tier.Rate < 0 {
+			return errors.New("Tier rates cannot be negative")
+		} else if tier.Rate > 0 && tier.weight(false, false) == 0 {
+			return errors.New("Tier has a rate but no heroes")
+		}
+		total += tier.Rate
+	}
+
+	if total == 0 {
+		return errors.New("Loot table has no rates")
+	}
+
+	return table.Pity.Check()
+}
+
+// LootTable.Hash returns the hex SHA-256 hash of the table, which
+// changes whenever any of its rates, heroes or pity settings do.
+func (table *LootTable) Hash() string {
+	data, _ := json.Marshal(table)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// LootTable.Pull picks a single hero from the table, applying the
+// table's pity to state and updating it for the next pull.
+func (table *LootTable) Pull(src Source, state *PityState) (Result, error) {
+	if err := table.Check(); err != nil {
+		return Result{}, err
+	}
+
+	top := table.top()
+	result := Result{PityCount: state.Pulls}
+
+	// Roll for the top tier at its pity-adjusted rate, otherwise
+	// pick one of the other tiers by their own rates
+	total, others := 0, 0
+	for i, tier := range table.Tiers {
+		total += tier.Rate
+		if i != top {
+			others += tier.Rate
+		}
+	}
+
+	topRate := table.Pity.Rate(table.Tiers[top].Rate, state.Pulls+1)
+	if topRate > total {
+		topRate = total
+	}
+
+	if others == 0 || Intn(src, total) < topRate {
+		tier := table.Tiers[top]
+		result.HeroID, result.Featured = table.Pity.pickTop(src, &tier, state)
+		result.Rarity, result.IsTop = tier.Rarity, true
+		state.Pulls = 0
+	} else {
+		tier := table.pickOther(src, top, others)
+		result.HeroID, result.Featured = tier.pick(src, false, false)
+		result.Rarity = tier.Rarity
+		state.Pulls++
+	}
+
+	return result, nil
+}
+
+// LootTable.top returns the index of the top tier: the tier with the
+// highest rarity that has a rate.
+func (table *LootTable) top() int {
+	top := -1
+	for i, tier := range table.Tiers {
+		if tier.Rate > 0 && (top == -1 || tier.Rarity > table.Tiers[top].Rarity) {
+			top = i
+		}
+	}
+	return top
+}
+
+// LootTable.pickOther picks a tier other than the top tier by its
+// rate. others is the total rate of those tiers.
+func (table *LootTable) pickOther(src Source, top int, others int) Tier {
+	roll := Intn(src, others)
+	for i, tier := range table.Tiers {
+		if i == top {
+			continue
+		}
+		if roll < tier.Rate {
+			return tier
+		}
+		roll -= tier.Rate
+	}
+
+	return table.Tiers[top]
+}
+
+// Tier.weight returns the total weight of the heroes in a tier. If
+// filter is set, only heroes whose Featured is featured are counted.
+func (tier *Tier) weight(filter bool, featured bool) int {
+	total := 0
+	for _, hero := range tier.Heroes {
+		if !filter || hero.Featured == featured {
+			total += hero.Weight
+		}
+	}
+	return total
+}
+
+// Tier.pick picks a hero within a tier by its weight, with the same
+// filter as Tier.weight.
+func (tier *Tier) pick(src Source, filter bool, featured bool) (int, bool) {
+	roll := Intn(src, tier.weight(filter, featured))
+	for _, hero := range tier.Heroes {
+		if filter && hero.Featured != featured {
+			continue
+		}
+		if roll < hero.Weight {
+			return hero.HeroID, hero.Featured
+		}
+		roll -= hero.Weight
+	}
+
+	return 0, false
+}
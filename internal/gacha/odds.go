@@ -0,0 +1,146 @@
+// odds.go contains the validation of loot tables and the odds that
+// are disclosed to players.
+package gacha
+
+import (
+	"errors"
+)
+
+// maxOddsPulls bounds the pulls that Odds follows when a table has
+// no hard pity.
+const maxOddsPulls = 100000
+
+//============================= ODDS =============================//
+// Odds are the chances of a loot table as a percentage, for
+// disclosure to players.
+//
+// Tiers & heroes have the chance of a single pull without pity.
+// Within the top tier, featured & other heroes are split by the
+// table's featured rate. TopRate is the long run (consolidated) rate
+// of the top tier with pity, which is 100 / TopPulls. FeaturedShare
+// is the long run share of top tier heroes that are featured, with
+// the guarantee after a lost 50/50.
+//================================================================//
+type Odds struct {
+	Tiers         []TierOdds `json:",omitempty"`
+	TopRate       float64    `json:",omitempty"`
+	TopPulls      float64    `json:",omitempty"`
+	FeaturedShare float64    `json:",omitempty"`
+}
+
+// TierOdds are the odds of a single Tier.
+type TierOdds struct {
+	Rarity int        `json:",omitempty"`
+	Rate   float64    `json:",omitempty"`
+	IsTop  bool       `json:",omitempty"`
+	Heroes []HeroOdds `json:",omitempty"`
+}
+
+// HeroOdds are the odds of a single hero in a Tier.
+type HeroOdds struct {
+	HeroID   int     `json:",omitempty"`
+	Featured bool    `json:",omitempty"`
+	Rate     float64 `json:",omitempty"`
+}
+
+// LootTable.Validate returns an error unless the table is complete
+// & consistent: its rates add up to exactly 100%, every tier with a
+// rate has heroes, and every tier with heroes has a rate.
+func (table *LootTable) Validate() error {
+	if err := table.Check(); err != nil {
+		return err
+	}
+
+	total := 0
+	rarities := map[int]bool{}
+	for _, tier := range table.Tiers {
+		if rarities[tier.Rarity] {
+			return errors.New("Loot table rarity is repeated")
+		} else if tier.Rate == 0 && len(tier.Heroes) > 0 {
+			return errors.New("Tier has heroes but no rate")
+		}
+
+		rarities[tier.Rarity] = true
+		total += tier.Rate
+	}
+
+	if total != RateScale {
+		return errors.New("Loot table rates must add up to 100 percent")
+	}
+
+	return nil
+}
+
+// LootTable.Odds returns the odds of the table. The table must pass
+// LootTable.Check.
+func (table *LootTable) Odds() Odds {
+	var odds Odds
+
+	top, total := table.top(), 0
+	for _, tier := range table.Tiers {
+		total += tier.Rate
+	}
+
+	for i, tier := range table.Tiers {
+		tierOdds := TierOdds{
+			Rarity: tier.Rarity,
+			Rate:   percent(tier.Rate, total),
+			IsTop:  i == top,
+		}
+
+		featured := tier.weight(true, true)
+		offBanner := tier.weight(true, false)
+		split := i == top && table.Pity.FeaturedRate != 0 && featured != 0 &&
+			offBanner != 0
+
+		for _, hero := range tier.Heroes {
+			share := float64(hero.Weight) / float64(tier.weight(false, false))
+			if split {
+				featuredRate := float64(table.Pity.FeaturedRate) / RateScale
+				if hero.Featured {
+					share = featuredRate * float64(hero.Weight) / float64(featured)
+				} else {
+					share = (1 - featuredRate) * float64(hero.Weight) / float64(offBanner)
+				}
+			}
+
+			tierOdds.Heroes = append(tierOdds.Heroes, HeroOdds{
+				HeroID:   hero.HeroID,
+				Featured: hero.Featured,
+				Rate:     tierOdds.Rate * share,
+			})
+		}
+
+		odds.Tiers = append(odds.Tiers, tierOdds)
+
+		if split {
+			featuredRate := float64(table.Pity.FeaturedRate) / RateScale
+			odds.FeaturedShare = 1 / (2 - featuredRate)
+		} else if i == top && featured != 0 && offBanner == 0 {
+			odds.FeaturedShare = 1
+		} else if i == top && featured != 0 {
+			odds.FeaturedShare = float64(featured) / float64(featured+offBanner)
+		}
+	}
+
+	// Expected pulls per top tier hero is the sum of the chances of
+	// having no top tier hero after each number of pulls
+	missed := 1.0
+	for pull := 1; pull <= maxOddsPulls && missed > 1e-12; pull++ {
+		odds.TopPulls += missed
+
+		rate := table.Pity.Rate(table.Tiers[top].Rate, pull)
+		if rate > total || total == table.Tiers[top].Rate {
+			rate = total
+		}
+		missed *= 1 - float64(rate)/float64(total)
+	}
+	odds.TopRate = 100 / odds.TopPulls
+
+	return odds
+}
+
+// percent returns rate as a percentage of total.
+func percent(rate int, total int) float64 {
+	return float64(rate) * 100 / float64(total)
+}
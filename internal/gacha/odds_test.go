@@ -0,0 +1,171 @@
+package gacha
+
+import (
+	"math"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		table func(*LootTable)
+		fails bool
+	}{
+		{name: "valid", table: func(table *LootTable) {}},
+		{name: "empty tier", table: func(table *LootTable) {
+			table.Tiers = append(table.Tiers, Tier{Rarity: 2})
+		}},
+		{name: "under 100%", table: func(table *LootTable) { table.Tiers[0].Rate-- }, fails: true},
+		{name: "over 100%", table: func(table *LootTable) { table.Tiers[0].Rate++ }, fails: true},
+		{name: "half", table: func(table *LootTable) {
+			for i := range table.Tiers {
+				table.Tiers[i].Rate /= 2
+			}
+		}, fails: true},
+		{name: "empty", table: func(table *LootTable) { table.Tiers = nil }, fails: true},
+		{name: "no rates", table: func(table *LootTable) {
+			for i := range table.Tiers {
+				table.Tiers[i].Rate = 0
+			}
+		}, fails: true},
+		{name: "negative rate", table: func(table *LootTable) {
+			table.Tiers[0].Rate += table.Tiers[1].Rate * 2
+			table.Tiers[1].Rate = -table.Tiers[1].Rate
+		}, fails: true},
+		{name: "rate without heroes", table: func(table *LootTable) { table.Tiers[1].Heroes = nil }, fails: true},
+		{name: "heroes without rate", table: func(table *LootTable) {
+			table.Tiers = append(table.Tiers, Tier{Rarity: 2, Heroes: []Entry{{HeroID: 9, Weight: 1}}})
+		}, fails: true},
+		{name: "repeated rarity", table: func(table *LootTable) {
+			table.Tiers[1].Rarity = table.Tiers[0].Rarity
+		}, fails: true},
+		{name: "invalid pity", table: func(table *LootTable) { table.Pity.FeaturedRate = RateScale + 1 }, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			table := pityTable()
+			test.table(&table)
+
+			if err := table.Validate(); test.fails && err == nil {
+				t.Error("expected an error")
+			} else if !test.fails && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestOddsFeaturedShare(t *testing.T) {
+	tests := []struct {
+		name         string
+		featuredRate int
+		heroes       []Entry
+		share        float64
+		featured     float64
+		offBanner    float64
+	}{
+		{name: "50/50", featuredRate: 500000, share: 2.0 / 3, featured: 0.5, offBanner: 0.5},
+		{name: "75/25", featuredRate: 750000, share: 1 / 1.25, featured: 0.75, offBanner: 0.25},
+		{name: "25/75", featuredRate: 250000, share: 1 / 1.75, featured: 0.25, offBanner: 0.75},
+		{name: "always featured", featuredRate: RateScale, share: 1, featured: 1, offBanner: 0},
+		{name: "no 50/50", featuredRate: 0, heroes: []Entry{
+			{HeroID: 5, Weight: 1, Featured: true},
+			{HeroID: 6, Weight: 3},
+		}, share: 0.25, featured: 0.25, offBanner: 0.75},
+		{name: "featured only", featuredRate: 500000, heroes: []Entry{
+			{HeroID: 5, Weight: 1, Featured: true},
+		}, share: 1, featured: 1},
+		{name: "off-banner only", featuredRate: 500000, heroes: []Entry{
+			{HeroID: 6, Weight: 1},
+		}, share: 0, offBanner: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			table := pityTable()
+			table.Pity.FeaturedRate = test.featuredRate
+			if test.heroes != nil {
+				table.Tiers[2].Heroes = test.heroes
+			}
+
+			odds := table.Odds()
+			if math.Abs(odds.FeaturedShare-test.share) > 1e-12 {
+				t.Errorf("featured share = %v, want %v", odds.FeaturedShare, test.share)
+			}
+
+			// Heroes of the 1% top tier split its rate
+			var featured, offBanner float64
+			for _, hero := range odds.Tiers[2].Heroes {
+				if hero.Featured {
+					featured += hero.Rate
+				} else {
+					offBanner += hero.Rate
+				}
+			}
+			if math.Abs(featured-test.featured) > 1e-12 ||
+				math.Abs(offBanner-test.offBanner) > 1e-12 {
+				t.Errorf("featured %v%% & off-banner %v%%, want %v%% & %v%%",
+					featured, offBanner, test.featured, test.offBanner)
+			}
+		})
+	}
+}
+
+func TestOdds(t *testing.T) {
+	tests := []struct {
+		name     string
+		table    func(*LootTable)
+		topPulls float64
+	}{
+		{name: "no pity", table: func(table *LootTable) { table.Pity = Pity{} }, topPulls: 100},
+		{name: "hard pity only", table: func(table *LootTable) {
+			table.Pity = Pity{Hard: 90}
+		}, topPulls: (1 - math.Pow(0.99, 90)) / 0.01},
+		{name: "hard pity every pull", table: func(table *LootTable) {
+			table.Pity = Pity{Hard: 1}
+		}, topPulls: 1},
+		{name: "top tier only", table: func(table *LootTable) {
+			table.Tiers = table.Tiers[2:]
+			table.Tiers[0].Rate = RateScale
+		}, topPulls: 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			table := pityTable()
+			test.table(&table)
+
+			odds := table.Odds()
+			if math.Abs(odds.TopPulls-test.topPulls) > 1e-6 {
+				t.Errorf("top pulls = %v, want %v", odds.TopPulls, test.topPulls)
+			}
+			if math.Abs(odds.TopRate*odds.TopPulls-100) > 1e-9 {
+				t.Errorf("top rate = %v, want 100 / %v", odds.TopRate, odds.TopPulls)
+			}
+		})
+	}
+
+	// Soft pity makes the top tier more likely than hard pity alone
+	table := pityTable()
+	odds := table.Odds()
+	if odds.TopPulls >= (1-math.Pow(0.99, 90))/0.01 || odds.TopPulls <= 1 {
+		t.Errorf("top pulls with soft pity = %v", odds.TopPulls)
+	}
+
+	rates := []float64{94, 5, 1}
+	for i, tier := range odds.Tiers {
+		total := 0.0
+		for _, hero := range tier.Heroes {
+			total += hero.Rate
+		}
+
+		if math.Abs(tier.Rate-rates[i]) > 1e-12 || math.Abs(total-tier.Rate) > 1e-12 {
+			t.Errorf("tier %d rate = %v%% with heroes of %v%%, want %v%%",
+				tier.Rarity, tier.Rate, total, rates[i])
+		}
+		if tier.IsTop != (i == 2) {
+			t.Errorf("tier %d is top = %v", tier.Rarity, tier.IsTop)
+		}
+	}
+}
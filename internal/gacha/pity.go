@@ -0,0 +1,88 @@
+// pity.go contains the pity mechanics of a loot table: soft pity,
+// hard pity and the guaranteed featured hero after a lost 50/50.
+package gacha
+
+import (
+	"errors"
+)
+
+//============================= PITY =============================//
+// Pity raises the chance of pulling the top tier the longer a
+// player goes without one.
+//
+// From pull SoftStart onwards (counted since the last top tier
+// hero), each pull adds SoftStep to the top tier's rate. Pull Hard
+// always pulls the top tier. A SoftStart or Hard of 0 disables that
+// part of pity.
+//
+// FeaturedRate is the chance that a top tier pull is a featured
+// hero. A player who pulls a top tier hero that is not featured
+// ("loses the 50/50") is guaranteed a featured hero on their next
+// top tier pull. A FeaturedRate of 0 picks top tier heroes by their
+// weights alone.
+//================================================================//
+type Pity struct {
+	SoftStart    int `json:",omitempty"`
+	SoftStep     int `json:",omitempty"`
+	Hard         int `json:",omitempty"`
+	FeaturedRate int `json:",omitempty"`
+}
+
+// PityState is a player's pity progress on a banner type.
+type PityState struct {
+	Pulls      int  `json:",omitempty"`
+	Guaranteed bool `json:",omitempty"`
+}
+
+// Pity.Check returns an error if the pity settings are invalid.
+func (pity *Pity) Check() error {
+	if pity.SoftStart < 0 || pity.SoftStep < 0 || pity.Hard < 0 {
+		return errors.New("Pity settings cannot be negative")
+	} else if pity.FeaturedRate < 0 || pity.FeaturedRate > RateScale {
+		return errors.New("Featured rate must be between 0 and 100 percent")
+	} else if pity.SoftStart != 0 && pity.Hard != 0 &&
+		pity.SoftStart > pity.Hard {
+		return errors.New("Soft pity must start before hard pity")
+	}
+
+	return nil
+}
+
+// Pity.Rate returns the top tier's rate on the given pull number
+// (counted since the last top tier hero, starting at 1).
+func (pity *Pity) Rate(base int, pull int) int {
+	if pity.Hard != 0 && pull >= pity.Hard {
+		return RateScale
+	}
+
+	rate := base
+	if pity.SoftStart != 0 && pull >= pity.SoftStart {
+		rate += (pull - pity.SoftStart + 1) * pity.SoftStep
+	}
+
+	if rate > RateScale {
+		return RateScale
+	}
+	return rate
+}
+
+// Pity.pickTop picks a hero from the top tier, applying the 50/50
+// rule and updating the player's guarantee.
+func (pity *Pity) pickTop(src Source, tier *Tier, state *PityState) (int, bool) {
+	featured := tier.weight(true, true)
+	offBanner := tier.weight(true, false)
+
+	// Without both featured and other heroes there is no 50/50
+	if pity.FeaturedRate == 0 || featured == 0 || offBanner == 0 {
+		return tier.pick(src, false, false)
+	}
+
+	if state.Guaranteed || Intn(src, RateScale) < pity.FeaturedRate {
+		state.Guaranteed = false
+		return tier.pick(src, true, true)
+	}
+
+	// Lost the 50/50, the next top tier hero is featured
+	state.Guaranteed = true
+	return tier.pick(src, true, false)
+}
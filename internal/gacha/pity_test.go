@@ -0,0 +1,201 @@
+package gacha
+
+import "testing"
+
+// pityTable returns a table with a 1% top tier of a featured & an
+// off-banner hero, and hard pity at pull 90.
+func pityTable() LootTable {
+	return LootTable{
+		Tiers: []Tier{
+			{Rarity: 3, Rate: 940000, Heroes: []Entry{{HeroID: 1, Weight: 1}}},
+			{Rarity: 4, Rate: 50000, Heroes: []Entry{{HeroID: 2, Weight: 1}}},
+			{Rarity: 5, Rate: 10000, Heroes: []Entry{
+				{HeroID: 5, Weight: 1, Featured: true},
+				{HeroID: 6, Weight: 1},
+			}},
+		},
+		Pity: Pity{SoftStart: 74, SoftStep: 60000, Hard: 90, FeaturedRate: 500000},
+	}
+}
+
+func TestPityCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		pity  Pity
+		fails bool
+	}{
+		{name: "none", pity: Pity{}},
+		{name: "soft & hard", pity: Pity{SoftStart: 74, SoftStep: 60000, Hard: 90}},
+		{name: "soft only", pity: Pity{SoftStart: 74, SoftStep: 60000}},
+		{name: "soft at hard", pity: Pity{SoftStart: 90, Hard: 90}},
+		{name: "full featured rate", pity: Pity{FeaturedRate: RateScale}},
+		{name: "negative soft start", pity: Pity{SoftStart: -1}, fails: true},
+		{name: "negative soft step", pity: Pity{SoftStep: -1}, fails: true},
+		{name: "negative hard", pity: Pity{Hard: -1}, fails: true},
+		{name: "negative featured rate", pity: Pity{FeaturedRate: -1}, fails: true},
+		{name: "featured rate over 100%", pity: Pity{FeaturedRate: RateScale + 1}, fails: true},
+		{name: "soft after hard", pity: Pity{SoftStart: 91, Hard: 90}, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.pity.Check(); test.fails && err == nil {
+				t.Error("expected an error")
+			} else if !test.fails && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestPityRate(t *testing.T) {
+	pity := pityTable().Pity
+
+	tests := []struct {
+		name string
+		pity Pity
+		pull int
+		want int
+	}{
+		{name: "first pull", pity: pity, pull: 1, want: 10000},
+		{name: "before soft pity", pity: pity, pull: 73, want: 10000},
+		{name: "soft pity starts", pity: pity, pull: 74, want: 70000},
+		{name: "soft pity ramps", pity: pity, pull: 80, want: 430000},
+		{name: "soft pity caps", pity: Pity{SoftStart: 2, SoftStep: RateScale}, pull: 5, want: RateScale},
+		{name: "hard pity", pity: pity, pull: 90, want: RateScale},
+		{name: "past hard pity", pity: pity, pull: 200, want: RateScale},
+		{name: "no pity", pity: Pity{}, pull: 1000, want: 10000},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.pity.Rate(10000, test.pull); got != test.want {
+				t.Errorf("Rate = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestPull(t *testing.T) {
+	// Rolls of the highest number lose every roll: the top tier,
+	// the 50/50 & the first tier & hero
+	const lose = RateScale - 1
+
+	tests := []struct {
+		name  string
+		table LootTable
+		state PityState
+		rolls []uint64
+		want  Result
+		after PityState
+	}{
+		{name: "other tier", table: pityTable(), state: PityState{Pulls: 10},
+			rolls: []uint64{lose},
+			want:  Result{HeroID: 1, Rarity: 3, PityCount: 10},
+			after: PityState{Pulls: 11}},
+		{name: "top tier won 50/50", table: pityTable(),
+			rolls: []uint64{0, 0, 0},
+			want:  Result{HeroID: 5, Rarity: 5, Featured: true, IsTop: true},
+			after: PityState{}},
+		{name: "hard pity lost 50/50", table: pityTable(), state: PityState{Pulls: 89},
+			rolls: []uint64{lose},
+			want:  Result{HeroID: 6, Rarity: 5, IsTop: true, PityCount: 89},
+			after: PityState{Guaranteed: true}},
+		{name: "guaranteed featured", table: pityTable(),
+			state: PityState{Pulls: 89, Guaranteed: true},
+			rolls: []uint64{lose},
+			want:  Result{HeroID: 5, Rarity: 5, Featured: true, IsTop: true, PityCount: 89},
+			after: PityState{}},
+		{name: "soft pity", table: pityTable(), state: PityState{Pulls: 79},
+			rolls: []uint64{429999, 0, 0},
+			want:  Result{HeroID: 5, Rarity: 5, Featured: true, IsTop: true, PityCount: 79},
+			after: PityState{}},
+		{name: "no 50/50 without a featured rate", table: func() LootTable {
+			table := pityTable()
+			table.Pity.FeaturedRate = 0
+			return table
+		}(), state: PityState{Guaranteed: true}, rolls: []uint64{0, 1},
+			want:  Result{HeroID: 6, Rarity: 5, IsTop: true},
+			after: PityState{Guaranteed: true}},
+		{name: "only a top tier", table: LootTable{Tiers: []Tier{
+			{Rarity: 5, Rate: RateScale, Heroes: []Entry{{HeroID: 9, Weight: 3}}},
+		}}, state: PityState{Pulls: 4}, rolls: []uint64{lose},
+			want:  Result{HeroID: 9, Rarity: 5, IsTop: true, PityCount: 4},
+			after: PityState{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			state := test.state
+			result, err := test.table.Pull(&sequence{numbers: test.rolls}, &state)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if result != test.want {
+				t.Errorf("result = %+v, want %+v", result, test.want)
+			}
+			if state != test.after {
+				t.Errorf("state = %+v, want %+v", state, test.after)
+			}
+		})
+	}
+}
+
+func TestPullInvalidTable(t *testing.T) {
+	tests := []struct {
+		name  string
+		table LootTable
+	}{
+		{name: "empty", table: LootTable{}},
+		{name: "no rates", table: LootTable{Tiers: []Tier{
+			{Rarity: 5, Heroes: []Entry{{HeroID: 1, Weight: 1}}},
+		}}},
+		{name: "rate without heroes", table: LootTable{Tiers: []Tier{
+			{Rarity: 5, Rate: RateScale},
+		}}},
+		{name: "rate without weight", table: LootTable{Tiers: []Tier{
+			{Rarity: 5, Rate: RateScale, Heroes: []Entry{{HeroID: 1}}},
+		}}},
+		{name: "negative rate", table: LootTable{Tiers: []Tier{
+			{Rarity: 4, Rate: -1, Heroes: []Entry{{HeroID: 1, Weight: 1}}},
+			{Rarity: 5, Rate: RateScale, Heroes: []Entry{{HeroID: 2, Weight: 1}}},
+		}}},
+		{name: "invalid pity", table: func() LootTable {
+			table := pityTable()
+			table.Pity.SoftStart = 100
+			return table
+		}()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var state PityState
+			if _, err := test.table.Pull(&sequence{numbers: []uint64{0}}, &state); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestPullHardPityGuarantee(t *testing.T) {
+	table := pityTable()
+	stream := Stream{Seed: []byte("pity")}
+	var state PityState
+
+	// No run of pulls can go past hard pity without a top tier hero
+	since := 0
+	for i := 0; i < 5000; i++ {
+		result, err := table.Pull(&stream, &state)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		since++
+		if result.IsTop {
+			since = 0
+		} else if since >= table.Pity.Hard {
+			t.Fatalf("pull %d went %d pulls without a top tier hero", i, since)
+		}
+	}
+}
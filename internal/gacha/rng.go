@@ -0,0 +1,88 @@
+// rng.go contains the random number sources used to pick summons.
+package gacha
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+// SeedSize is the size in bytes of a Stream seed.
+const SeedSize = 32
+
+// Source is a source of uniformly distributed random numbers.
+type Source interface {
+	Uint64() uint64
+}
+
+// CryptoSource is a Source backed by crypto/rand.
+type CryptoSource struct{}
+
+// CryptoSource.Uint64 returns a random uint64. It panics if the
+// system's secure random number generator fails.
+func (CryptoSource) Uint64() uint64 {
+	var b [8]byte
+
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+
+	return binary.BigEndian.Uint64(b[:])
+}
+
+//============================ STREAM ============================//
+// Stream is a deterministic Source for auditable summons.
+//
+// The number at draw Index is the first 8 bytes of
+// HMAC-SHA256(Seed, Index), so any draw can be re-derived from the
+// seed and its index alone. The seed is kept secret while in use,
+// and players are shown its Commitment instead. Once the seed is
+// revealed, anyone can check it against the commitment and replay
+// every draw made with it.
+//================================================================//
+type Stream struct {
+	Seed  []byte
+	Index int64
+}
+
+// NewSeed returns a new random Stream seed.
+func NewSeed() ([]byte, error) {
+	seed := make([]byte, SeedSize)
+	_, err := rand.Read(seed)
+	return seed, err
+}
+
+// Commitment returns the hex SHA-256 hash of a seed, which can be
+// published before the seed is used.
+func Commitment(seed []byte) string {
+	sum := sha256.Sum256(seed)
+	return hex.EncodeToString(sum[:])
+}
+
+// Stream.Uint64 returns the number at the current draw index, and
+// moves on to the next index.
+func (stream *Stream) Uint64() uint64 {
+	var index [8]byte
+	binary.BigEndian.PutUint64(index[:], uint64(stream.Index))
+
+	mac := hmac.New(sha256.New, stream.Seed)
+	mac.Write(index[:])
+	stream.Index++
+
+	return binary.BigEndian.Uint64(mac.Sum(nil)[:8])
+}
+
+// Intn returns a uniformly distributed number in [0, n) from src,
+// without modulo bias. n must be positive.
+func Intn(src Source, n int) int {
+	bound := uint64(n)
+	limit := ^uint64(0) - (^uint64(0) % bound)
+
+	for {
+		if v := src.Uint64(); v < limit {
+			return int(v % bound)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package gacha
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"testing"
+)
+
+// sequence is a Source that returns its numbers in order, and then
+// repeats the last one.
+type sequence struct {
+	numbers []uint64
+	next    int
+}
+
+func (seq *sequence) Uint64() uint64 {
+	n := seq.numbers[seq.next]
+	if seq.next < len(seq.numbers)-1 {
+		seq.next++
+	}
+	return n
+}
+
+// draw returns the number at index of a stream, derived without
+// Stream.
+func draw(seed []byte, index uint64) uint64 {
+	var message [8]byte
+	binary.BigEndian.PutUint64(message[:], index)
+
+	mac := hmac.New(sha256.New, seed)
+	mac.Write(message[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil)[:8])
+}
+
+func TestStream(t *testing.T) {
+	long := bytes.Repeat([]byte{0xAB}, 100)
+
+	tests := []struct {
+		name  string
+		seed  []byte
+		index int64
+	}{
+		{name: "seed", seed: bytes.Repeat([]byte{7}, SeedSize)},
+		{name: "later index", seed: bytes.Repeat([]byte{7}, SeedSize), index: 1 << 40},
+		{name: "nil seed", seed: nil},
+		{name: "truncated seed", seed: []byte{7, 7, 7}},
+		{name: "seed longer than a block", seed: long},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stream := Stream{Seed: test.seed, Index: test.index}
+			for i := 0; i < 5; i++ {
+				want := draw(test.seed, uint64(test.index)+uint64(i))
+				if got := stream.Uint64(); got != want {
+					t.Fatalf("draw %d = %x, want %x", i, got, want)
+				}
+			}
+
+			if stream.Index != test.index+5 {
+				t.Errorf("index = %d, want %d", stream.Index, test.index+5)
+			}
+		})
+	}
+}
+
+func TestStreamReplay(t *testing.T) {
+	seed, err := NewSeed()
+	if err != nil {
+		t.Fatal(err)
+	} else if len(seed) != SeedSize {
+		t.Fatalf("seed is %d bytes, want %d", len(seed), SeedSize)
+	}
+
+	first := Stream{Seed: seed}
+	var draws []uint64
+	for i := 0; i < 10; i++ {
+		draws = append(draws, first.Uint64())
+	}
+
+	// Any draw can be replayed from its index alone
+	for i, want := range draws {
+		replay := Stream{Seed: seed, Index: int64(i)}
+		if got := replay.Uint64(); got != want {
+			t.Errorf("replayed draw %d = %x, want %x", i, got, want)
+		}
+	}
+
+	other := Stream{Seed: append([]byte{}, seed...)}
+	other.Seed[0] ^= 1
+	if other.Uint64() == draws[0] {
+		t.Error("seeds that differ by a bit drew the same number")
+	}
+}
+
+func TestCommitment(t *testing.T) {
+	tests := []struct {
+		name string
+		seed []byte
+		want string
+	}{
+		{name: "empty", seed: nil,
+			want: "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		{name: "abc", seed: []byte("abc"),
+			want: "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := Commitment(test.seed); got != test.want {
+				t.Errorf("Commitment = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIntn(t *testing.T) {
+	const max = ^uint64(0)
+
+	tests := []struct {
+		name    string
+		numbers []uint64
+		n       int
+		want    int
+	}{
+		{name: "zero", numbers: []uint64{0}, n: 10, want: 0},
+		{name: "modulo", numbers: []uint64{123}, n: 10, want: 3},
+		{name: "one", numbers: []uint64{max - 1}, n: 1, want: 0},
+		// max % 3 == 0, so only max itself is past the limit
+		{name: "rejects biased", numbers: []uint64{max, 4}, n: 3, want: 1},
+		{name: "rejects every biased", numbers: []uint64{max, max, max, 5}, n: 3, want: 2},
+		{name: "largest unbiased", numbers: []uint64{max - 1}, n: 3, want: 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := &sequence{numbers: test.numbers}
+			if got := Intn(src, test.n); got != test.want {
+				t.Errorf("Intn = %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestIntnRange(t *testing.T) {
+	stream := Stream{Seed: []byte("range")}
+	for _, n := range []int{1, 2, 3, 7, 100, RateScale} {
+		for i := 0; i < 1000; i++ {
+			if v := Intn(&stream, n); v < 0 || v >= n {
+				t.Fatalf("Intn(%d) = %d", n, v)
+			}
+		}
+	}
+}
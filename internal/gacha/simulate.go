@@ -0,0 +1,233 @@
+// simulate.go contains Monte Carlo simulations of loot tables, so
+// that rates can be tuned before a banner goes live.
+package gacha
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// MaxSimulatedPulls is the most pulls (players × pulls) a single
+// simulation may run.
+const MaxSimulatedPulls = 10000000
+
+//========================== SIMULATION ==========================//
+// Simulation pulls Pulls heroes for each of Players virtual players
+// from a loot table, with pity, and reports the distributions of
+// the outcomes.
+//
+// Each player pulls from their own Stream, derived from Seed & the
+// player's number, so a simulation gives the same report for the
+// same seed however many workers it runs on.
+//
+// CostSingle & CostMulti are the banner's costs. Pulls are paid for
+// as 10 pulls where possible, then as single pulls.
+//================================================================//
+type Simulation struct {
+	Players    int   `json:",omitempty"`
+	Pulls      int   `json:",omitempty"`
+	Seed       int64 `json:",omitempty"`
+	CostSingle int   `json:",omitempty"`
+	CostMulti  int   `json:",omitempty"`
+}
+
+// SimulationReport is the outcome of a Simulation.
+//
+// FirstTop is the number of pulls players needed for their first top
+// tier hero, of the players that pulled one (NoTop did not).
+// FeaturedRate is the share of top tier heroes that were featured.
+// CostPerCopy is the currency spent on each featured copy, counted
+// since the player's previous featured copy.
+type SimulationReport struct {
+	Simulation   Simulation   `json:",omitempty"`
+	TopHeroes    int          `json:",omitempty"`
+	Featured     int          `json:",omitempty"`
+	FeaturedRate float64      `json:",omitempty"`
+	NoTop        int          `json:",omitempty"`
+	FirstTop     Distribution `json:",omitempty"`
+	CostPerCopy  Distribution `json:",omitempty"`
+}
+
+// Distribution summarises a set of samples. Histogram counts the
+// samples of each value, in order of value.
+type Distribution struct {
+	Samples   int      `json:",omitempty"`
+	Mean      float64  `json:",omitempty"`
+	Min       int      `json:",omitempty"`
+	Max       int      `json:",omitempty"`
+	P50       int      `json:",omitempty"`
+	P90       int      `json:",omitempty"`
+	P99       int      `json:",omitempty"`
+	Histogram []Bucket `json:",omitempty"`
+}
+
+// Bucket is the number of samples of a single value.
+type Bucket struct {
+	Value int `json:",omitempty"`
+	Count int `json:",omitempty"`
+}
+
+// simulatedPlayer is the outcome of a single virtual player.
+type simulatedPlayer struct {
+	firstTop int
+	top      int
+	featured int
+	copies   []int
+}
+
+// Simulation.Check returns an error if the simulation is invalid.
+func (sim *Simulation) Check() error {
+	if sim.Players <= 0 || sim.Pulls <= 0 {
+		return errors.New("Players and pulls must be positive")
+	} else if sim.Players > MaxSimulatedPulls/sim.Pulls {
+		return errors.New("Simulation has too many pulls")
+	} else if sim.CostSingle < 0 || sim.CostMulti < 0 {
+		return errors.New("Costs cannot be negative")
+	}
+
+	return nil
+}
+
+// Simulation.Run runs the simulation on table, spread over one
+// worker per CPU.
+func (sim *Simulation) Run(table LootTable) (SimulationReport, error) {
+	report := SimulationReport{Simulation: *sim}
+
+	if err := sim.Check(); err != nil {
+		return report, err
+	} else if err = table.Check(); err != nil {
+		return report, err
+	}
+
+	players := make([]simulatedPlayer, sim.Players)
+	next := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < runtime.NumCPU(); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				players[i] = sim.player(&table, i)
+			}
+		}()
+	}
+
+	for i := range players {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	// Combine the players in order, so the report is deterministic
+	var firstTop, copies []int
+	costPerPull := float64(sim.cost()) / float64(sim.Pulls)
+
+	for _, player := range players {
+		report.TopHeroes += player.top
+		report.Featured += player.featured
+
+		if player.firstTop == 0 {
+			report.NoTop++
+		} else {
+			firstTop = append(firstTop, player.firstTop)
+		}
+
+		for _, pulls := range player.copies {
+			copies = append(copies, int(math.Round(float64(pulls)*costPerPull)))
+		}
+	}
+
+	if report.TopHeroes > 0 {
+		report.FeaturedRate = float64(report.Featured) / float64(report.TopHeroes)
+	}
+	report.FirstTop = newDistribution(firstTop)
+	report.CostPerCopy = newDistribution(copies)
+
+	return report, nil
+}
+
+// Simulation.player pulls every hero of a single virtual player.
+func (sim *Simulation) player(table *LootTable, number int) simulatedPlayer {
+	var player simulatedPlayer
+	var state PityState
+
+	seed := make([]byte, 16)
+	binary.BigEndian.PutUint64(seed[:8], uint64(sim.Seed))
+	binary.BigEndian.PutUint64(seed[8:], uint64(number))
+	stream := &Stream{Seed: seed}
+
+	sinceCopy := 0
+	for pull := 1; pull <= sim.Pulls; pull++ {
+		// Table was checked, so Pull cannot fail
+		result, _ := table.Pull(stream, &state)
+		sinceCopy++
+
+		if !result.IsTop {
+			continue
+		}
+
+		player.top++
+		if player.firstTop == 0 {
+			player.firstTop = pull
+		}
+
+		if result.Featured {
+			player.featured++
+			player.copies = append(player.copies, sinceCopy)
+			sinceCopy = 0
+		}
+	}
+
+	return player
+}
+
+// Simulation.cost returns the currency each player spends.
+func (sim *Simulation) cost() int {
+	return sim.Pulls/10*sim.CostMulti + sim.Pulls%10*sim.CostSingle
+}
+
+// newDistribution summarises samples.
+func newDistribution(samples []int) Distribution {
+	dist := Distribution{Samples: len(samples)}
+	if len(samples) == 0 {
+		return dist
+	}
+
+	sorted := append([]int(nil), samples...)
+	sort.Ints(sorted)
+
+	total := 0
+	for _, sample := range sorted {
+		total += sample
+
+		last := len(dist.Histogram) - 1
+		if last >= 0 && dist.Histogram[last].Value == sample {
+			dist.Histogram[last].Count++
+		} else {
+			dist.Histogram = append(dist.Histogram, Bucket{Value: sample, Count: 1})
+		}
+	}
+
+	dist.Mean = float64(total) / float64(len(sorted))
+	dist.Min, dist.Max = sorted[0], sorted[len(sorted)-1]
+	dist.P50 = percentile(sorted, 50)
+	dist.P90 = percentile(sorted, 90)
+	dist.P99 = percentile(sorted, 99)
+
+	return dist
+}
+
+// percentile returns the pth percentile of sorted samples, by the
+// nearest rank.
+func percentile(sorted []int, p int) int {
+	rank := int(math.Ceil(float64(p) / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
@@ -0,0 +1,150 @@
+package gacha
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSimulationCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		sim   Simulation
+		fails bool
+	}{
+		{name: "valid", sim: Simulation{Players: 100, Pulls: 90, CostSingle: 160, CostMulti: 1600}},
+		{name: "most pulls", sim: Simulation{Players: MaxSimulatedPulls / 100, Pulls: 100}},
+		{name: "free", sim: Simulation{Players: 1, Pulls: 1}},
+		{name: "no players", sim: Simulation{Pulls: 90}, fails: true},
+		{name: "no pulls", sim: Simulation{Players: 100}, fails: true},
+		{name: "negative pulls", sim: Simulation{Players: 100, Pulls: -1}, fails: true},
+		{name: "too many pulls", sim: Simulation{Players: MaxSimulatedPulls/100 + 1, Pulls: 100}, fails: true},
+		{name: "negative single cost", sim: Simulation{Players: 1, Pulls: 1, CostSingle: -1}, fails: true},
+		{name: "negative multi cost", sim: Simulation{Players: 1, Pulls: 1, CostMulti: -1}, fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.sim.Check(); test.fails && err == nil {
+				t.Error("expected an error")
+			} else if !test.fails && err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestSimulationRun(t *testing.T) {
+	table := pityTable()
+	sim := Simulation{Players: 200, Pulls: 180, Seed: 7, CostSingle: 160, CostMulti: 1600}
+
+	report, err := sim.Run(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Hard pity at 90 gives every player a top tier hero
+	if report.NoTop != 0 || report.FirstTop.Samples != sim.Players ||
+		report.FirstTop.Max > table.Pity.Hard {
+		t.Errorf("first top tier = %+v with %d players without one",
+			report.FirstTop, report.NoTop)
+	}
+	if report.Featured == 0 || report.Featured > report.TopHeroes ||
+		report.CostPerCopy.Samples != report.Featured {
+		t.Errorf("%d featured of %d top tier heroes, %d costs",
+			report.Featured, report.TopHeroes, report.CostPerCopy.Samples)
+	}
+
+	// The same seed gives the same report
+	again, err := sim.Run(table)
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(report, again) {
+		t.Errorf("reports of the same seed differ:\n%+v\n%+v", report, again)
+	}
+
+	// Another seed does not
+	other := sim
+	other.Seed = 8
+	if otherReport, err := other.Run(table); err != nil {
+		t.Fatal(err)
+	} else if reflect.DeepEqual(report.FirstTop, otherReport.FirstTop) {
+		t.Error("reports of different seeds are the same")
+	}
+}
+
+func TestSimulationPlayers(t *testing.T) {
+	table := pityTable()
+	small := Simulation{Players: 10, Pulls: 200, Seed: 42}
+	large := Simulation{Players: 50, Pulls: 200, Seed: 42}
+
+	// Each player pulls the same heroes however many players there are
+	for i := 0; i < small.Players; i++ {
+		if a, b := small.player(&table, i), large.player(&table, i); !reflect.DeepEqual(a, b) {
+			t.Errorf("player %d = %+v with %d players, %+v with %d", i, a,
+				small.Players, b, large.Players)
+		}
+	}
+
+	// Players are not all the same
+	if reflect.DeepEqual(large.player(&table, 0), large.player(&table, 1)) &&
+		reflect.DeepEqual(large.player(&table, 0), large.player(&table, 2)) {
+		t.Error("players pulled the same heroes")
+	}
+
+	// The report adds up its players
+	report, err := large.Run(table)
+	if err != nil {
+		t.Fatal(err)
+	}
+	top, featured := 0, 0
+	for i := 0; i < large.Players; i++ {
+		player := large.player(&table, i)
+		top += player.top
+		featured += player.featured
+	}
+	if report.TopHeroes != top || report.Featured != featured {
+		t.Errorf("report has %d top & %d featured, players %d & %d",
+			report.TopHeroes, report.Featured, top, featured)
+	}
+}
+
+func TestSimulationRunInvalidTable(t *testing.T) {
+	sim := Simulation{Players: 1, Pulls: 1}
+	if _, err := sim.Run(LootTable{}); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestSimulationCost(t *testing.T) {
+	tests := []struct {
+		pulls int
+		cost  int
+	}{
+		{pulls: 1, cost: 160},
+		{pulls: 9, cost: 1440},
+		{pulls: 10, cost: 1500},
+		{pulls: 25, cost: 3800},
+	}
+
+	for _, test := range tests {
+		sim := Simulation{Pulls: test.pulls, CostSingle: 160, CostMulti: 1500}
+		if cost := sim.cost(); cost != test.cost {
+			t.Errorf("%d pulls cost %d, want %d", test.pulls, cost, test.cost)
+		}
+	}
+}
+
+func TestNewDistribution(t *testing.T) {
+	dist := newDistribution([]int{3, 1, 2, 2, 10})
+	want := Distribution{
+		Samples: 5, Mean: 3.6, Min: 1, Max: 10, P50: 2, P90: 10, P99: 10,
+		Histogram: []Bucket{{1, 1}, {2, 2}, {3, 1}, {10, 1}},
+	}
+	if !reflect.DeepEqual(dist, want) {
+		t.Errorf("distribution = %+v, want %+v", dist, want)
+	}
+
+	if empty := newDistribution(nil); !reflect.DeepEqual(empty, Distribution{}) {
+		t.Errorf("empty distribution = %+v", empty)
+	}
+}
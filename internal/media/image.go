@@ -0,0 +1,164 @@
+// image.go contains the validation of uploaded art, and the
+// thumbnails generated from it.
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/draw"
+	"image/png"
+
+	// Register the formats that art can be uploaded in
+	_ "image/gif"
+	_ "image/jpeg"
+)
+
+// Limits of uploaded art
+const (
+	MaxImageBytes = 10 << 20
+	MinImageSize  = 16
+	MaxImageSize  = 4096
+	ThumbnailSize = 256
+)
+
+// ImageTypes are the mime types of the image formats that art can
+// be uploaded in, by format.
+var ImageTypes = map[string]string{
+	"png":  "image/png",
+	"jpeg": "image/jpeg",
+	"gif":  "image/gif",
+}
+
+// imageExtensions are the file extensions of the image formats.
+var imageExtensions = map[string]string{
+	"png":  ".png",
+	"jpeg": ".jpg",
+	"gif":  ".gif",
+}
+
+//============================ IMAGE =============================//
+// Image is a validated image: its format, mime type, extension &
+// dimensions (in pixels). Only the first frame of a GIF is used for
+// its thumbnail.
+//================================================================//
+type Image struct {
+	Format    string
+	MimeType  string
+	Extension string
+	Width     int
+	Height    int
+	image     image.Image
+}
+
+// DecodeImage validates & decodes an uploaded image. The dimensions
+// are checked before the image is decoded, so that oversized images
+// are rejected without being loaded.
+func DecodeImage(data []byte) (Image, error) {
+	var img Image
+
+	if len(data) > MaxImageBytes {
+		return img, errors.New("Images cannot be larger than 10MB")
+	}
+
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return img, errors.New("Images must be PNG, JPEG or GIF")
+	}
+
+	img = Image{
+		Format:    format,
+		MimeType:  ImageTypes[format],
+		Extension: imageExtensions[format],
+		Width:     config.Width,
+		Height:    config.Height,
+	}
+
+	if img.Width < MinImageSize || img.Height < MinImageSize ||
+		img.Width > MaxImageSize || img.Height > MaxImageSize {
+		return img, errors.New("Images must be 16 to 4096 pixels wide and high")
+	}
+
+	if img.image, _, err = image.Decode(bytes.NewReader(data)); err != nil {
+		return img, errors.New("Image could not be decoded")
+	}
+
+	return img, nil
+}
+
+// Image.Thumbnail returns a PNG thumbnail of the image that fits in
+// ThumbnailSize × ThumbnailSize, keeping its aspect ratio. Images
+// are shrunk by averaging the pixels that make up each pixel of the
+// thumbnail, and are never enlarged.
+func (img *Image) Thumbnail() ([]byte, error) {
+	if img.image == nil {
+		return nil, errors.New("Image has not been decoded")
+	}
+
+	width, height := img.Width, img.Height
+	if width > ThumbnailSize || height > ThumbnailSize {
+		if width >= height {
+			height = max(1, height*ThumbnailSize/width)
+			width = ThumbnailSize
+		} else {
+			width = max(1, width*ThumbnailSize/height)
+			height = ThumbnailSize
+		}
+	}
+
+	// Work on premultiplied RGBA pixels of the whole image. The first
+	// frame of a GIF can be smaller than the image, at an offset
+	source := image.NewRGBA(image.Rect(0, 0, img.Width, img.Height))
+	bounds := img.image.Bounds()
+	draw.Draw(source, bounds, img.image, bounds.Min, draw.Src)
+
+	thumb := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		// Thumbnails are never larger, so every box has a pixel
+		y0, y1 := y*img.Height/height, (y+1)*img.Height/height
+
+		for x := 0; x < width; x++ {
+			x0, x1 := x*img.Width/width, (x+1)*img.Width/width
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := source.Pix[sy*source.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(row[sx*4+c])
+					}
+				}
+			}
+
+			count := (y1 - y0) * (x1 - x0)
+			pixel := thumb.Pix[y*thumb.Stride+x*4:]
+			for c := 0; c < 4; c++ {
+				pixel[c] = uint8(sum[c] / count)
+			}
+		}
+	}
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, thumb); err != nil {
+		return nil, err
+	}
+
+	return encoded.Bytes(), nil
+}
+
+// Hash returns the SHA-256 hash of a file as hex, which names the
+// file in storage so that identical uploads are stored once.
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// max returns the larger of two ints.
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
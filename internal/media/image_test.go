@@ -0,0 +1,152 @@
+package media
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// encodePNG returns a width × height PNG of a single colour.
+func encodePNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xFF
+	}
+
+	var encoded bytes.Buffer
+	if err := png.Encode(&encoded, img); err != nil {
+		t.Fatal(err)
+	}
+	return encoded.Bytes()
+}
+
+// encodeGIF returns a GIF with a width × height logical screen, whose
+// only frame is frame.
+func encodeGIF(t *testing.T, width, height int, frame image.Rectangle) []byte {
+	t.Helper()
+
+	paletted := image.NewPaletted(frame, palette.Plan9)
+	for i := range paletted.Pix {
+		paletted.Pix[i] = 1
+	}
+
+	var encoded bytes.Buffer
+	if err := gif.EncodeAll(&encoded, &gif.GIF{
+		Image:  []*image.Paletted{paletted},
+		Delay:  []int{0},
+		Config: image.Config{ColorModel: color.Palette(palette.Plan9), Width: width, Height: height},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return encoded.Bytes()
+}
+
+func TestDecodeImage(t *testing.T) {
+	var jpg bytes.Buffer
+	if err := jpeg.Encode(&jpg, image.NewRGBA(image.Rect(0, 0, 64, 32)), nil); err != nil {
+		t.Fatal(err)
+	}
+	valid := encodePNG(t, 40, 20)
+
+	tests := []struct {
+		name   string
+		data   []byte
+		format string
+		width  int
+		height int
+		fails  bool
+	}{
+		{name: "png", data: valid, format: "png", width: 40, height: 20},
+		{name: "jpeg", data: jpg.Bytes(), format: "jpeg", width: 64, height: 32},
+		{name: "gif", data: encodeGIF(t, 30, 30, image.Rect(0, 0, 30, 30)), format: "gif", width: 30, height: 30},
+		{name: "empty", data: nil, fails: true},
+		{name: "not an image", data: []byte("definitely not an image"), fails: true},
+		{name: "truncated header", data: valid[:12], fails: true},
+		{name: "truncated pixels", data: valid[:len(valid)-20], fails: true},
+		{name: "too small", data: encodePNG(t, 8, 40), fails: true},
+		{name: "too large", data: encodePNG(t, MaxImageSize+1, 16), fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := DecodeImage(test.data)
+			if test.fails {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if img.Format != test.format || img.MimeType != ImageTypes[test.format] {
+				t.Errorf("format = %s (%s), want %s", img.Format, img.MimeType, test.format)
+			}
+			if img.Width != test.width || img.Height != test.height {
+				t.Errorf("size = %d×%d, want %d×%d", img.Width, img.Height, test.width, test.height)
+			}
+		})
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   []byte
+		width  int
+		height int
+	}{
+		{name: "wide", data: encodePNG(t, 1000, 500), width: 256, height: 128},
+		{name: "tall", data: encodePNG(t, 300, 600), width: 128, height: 256},
+		{name: "small is not enlarged", data: encodePNG(t, 100, 50), width: 100, height: 50},
+		{name: "thin", data: encodePNG(t, 4000, 16), width: 256, height: 1},
+		{name: "gif frame smaller than screen", data: encodeGIF(t, 300, 300, image.Rect(0, 0, 20, 20)), width: 256, height: 256},
+		{name: "gif frame at an offset", data: encodeGIF(t, 300, 300, image.Rect(100, 150, 120, 170)), width: 256, height: 256},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			img, err := DecodeImage(test.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			thumb, err := img.Thumbnail()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			config, err := png.DecodeConfig(bytes.NewReader(thumb))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if config.Width != test.width || config.Height != test.height {
+				t.Errorf("thumbnail = %d×%d, want %d×%d", config.Width, config.Height, test.width, test.height)
+			}
+		})
+	}
+}
+
+func TestThumbnailNotDecoded(t *testing.T) {
+	var img Image
+	if _, err := img.Thumbnail(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestHash(t *testing.T) {
+	const empty = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	if hash := Hash(nil); hash != empty {
+		t.Errorf("Hash(nil) = %s, want %s", hash, empty)
+	}
+	if Hash([]byte("a")) == Hash([]byte("b")) {
+		t.Error("different files have the same hash")
+	}
+}
@@ -0,0 +1,272 @@
+// sound.go contains the validation of uploaded sound, and the
+// metadata (duration, sample rate & channels) read from its headers.
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// MaxSoundBytes is the largest sound file that can be uploaded.
+const MaxSoundBytes = 50 << 20
+
+// SoundTypes are the mime types of the sound formats that can be
+// uploaded, by format.
+var SoundTypes = map[string]string{
+	"wav": "audio/wav",
+	"ogg": "audio/ogg",
+	"mp3": "audio/mpeg",
+}
+
+// ErrUnsupportedSound is returned for sound that is not WAV (PCM),
+// OGG (Vorbis or Opus) or MP3.
+var ErrUnsupportedSound = errors.New("Sounds must be WAV, OGG or MP3")
+
+//============================ SOUND =============================//
+// Sound is the metadata of a validated sound file, read from its
+// headers without decoding its audio. Duration is in seconds.
+//================================================================//
+type Sound struct {
+	Format     string
+	MimeType   string
+	Extension  string
+	Duration   float64
+	SampleRate int
+	Channels   int
+}
+
+// DecodeSound validates an uploaded sound file by its contents, and
+// reads its metadata.
+func DecodeSound(data []byte) (Sound, error) {
+	var sound Sound
+	var err error
+
+	if len(data) > MaxSoundBytes {
+		return sound, errors.New("Sounds cannot be larger than 50MB")
+	}
+
+	switch {
+	case len(data) >= 12 && string(data[:4]) == "RIFF" &&
+		string(data[8:12]) == "WAVE":
+		sound, err = decodeWAV(data)
+		sound.Format = "wav"
+	case len(data) >= 4 && string(data[:4]) == "OggS":
+		sound, err = decodeOGG(data)
+		sound.Format = "ogg"
+	case len(data) >= 3 && (string(data[:3]) == "ID3" ||
+		(data[0] == 0xFF && data[1]&0xE0 == 0xE0)):
+		sound, err = decodeMP3(data)
+		sound.Format = "mp3"
+	default:
+		return sound, ErrUnsupportedSound
+	}
+
+	if err != nil {
+		return sound, err
+	} else if sound.SampleRate <= 0 || sound.Channels <= 0 {
+		return sound, errors.New("Sound has no sample rate or channels")
+	}
+
+	sound.MimeType = SoundTypes[sound.Format]
+	sound.Extension = "." + sound.Format
+	return sound, nil
+}
+
+// decodeWAV reads the fmt & data chunks of a WAV file. Only PCM &
+// floating point WAV files are supported.
+func decodeWAV(data []byte) (Sound, error) {
+	var sound Sound
+	var byteRate, dataSize uint32
+	var hasFormat bool
+
+	for offset := 12; offset+8 <= len(data); {
+		id := string(data[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		body := data[offset+8:]
+
+		switch id {
+		case "fmt ":
+			if size < 16 || len(body) < 16 {
+				return sound, errors.New("WAV format chunk is too short")
+			}
+
+			// 1 is PCM, 3 is floating point & 0xFFFE is extensible
+			format := binary.LittleEndian.Uint16(body[0:2])
+			if format != 1 && format != 3 && format != 0xFFFE {
+				return sound, ErrUnsupportedSound
+			}
+
+			sound.Channels = int(binary.LittleEndian.Uint16(body[2:4]))
+			sound.SampleRate = int(binary.LittleEndian.Uint32(body[4:8]))
+			byteRate = binary.LittleEndian.Uint32(body[8:12])
+			hasFormat = true
+		case "data":
+			// The size can be larger than the file if it was cut short
+			dataSize = uint32(size)
+			if size > len(body) {
+				dataSize = uint32(len(body))
+			}
+		}
+
+		// Chunks are padded to an even size
+		offset += 8 + size + size%2
+	}
+
+	if !hasFormat {
+		return sound, errors.New("WAV file has no format chunk")
+	} else if byteRate > 0 {
+		sound.Duration = float64(dataSize) / float64(byteRate)
+	}
+
+	return sound, nil
+}
+
+// decodeOGG reads the identification header of the first stream of
+// an OGG file, and its duration from the granule position of its
+// last page. Vorbis & Opus streams are supported.
+func decodeOGG(data []byte) (Sound, error) {
+	var sound Sound
+
+	// The first page holds the identification header only
+	if len(data) < 27 {
+		return sound, errors.New("OGG file is too short")
+	}
+	segments := int(data[26])
+	start := 27 + segments
+	if len(data) < start {
+		return sound, errors.New("OGG file is too short")
+	}
+	packet := data[start:]
+
+	var preSkip, granuleRate int64
+	switch {
+	case len(packet) >= 16 && string(packet[:7]) == "\x01vorbis":
+		sound.Channels = int(packet[11])
+		sound.SampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+		granuleRate = int64(sound.SampleRate)
+	case len(packet) >= 16 && string(packet[:8]) == "OpusHead":
+		sound.Channels = int(packet[9])
+		preSkip = int64(binary.LittleEndian.Uint16(packet[10:12]))
+		sound.SampleRate = int(binary.LittleEndian.Uint32(packet[12:16]))
+		// Opus is always decoded at 48kHz
+		granuleRate = 48000
+		if sound.SampleRate == 0 {
+			sound.SampleRate = 48000
+		}
+	default:
+		return sound, ErrUnsupportedSound
+	}
+
+	// Find the granule position of the last page
+	last := bytes.LastIndex(data, []byte("OggS"))
+	for last >= 0 && last+14 > len(data) {
+		last = bytes.LastIndex(data[:last], []byte("OggS"))
+	}
+	if last >= 0 && granuleRate > 0 {
+		granule := int64(binary.LittleEndian.Uint64(data[last+6 : last+14]))
+		if granule > preSkip {
+			sound.Duration = float64(granule-preSkip) / float64(granuleRate)
+		}
+	}
+
+	return sound, nil
+}
+
+// MP3 bitrates (kbps) by bitrate index, for MPEG-1 layer III & for
+// MPEG-2/2.5 layer III.
+var mp3Bitrates = [2][16]int{
+	{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+}
+
+// MP3 sample rates by sample rate index, for MPEG-1.
+var mp3SampleRates = [3]int{44100, 48000, 32000}
+
+// decodeMP3 reads the first frame header of an MP3 file, after any
+// ID3v2 tag. The duration is read from the frame count of a Xing or
+// Info header when there is one (VBR), or is estimated from the
+// bitrate (CBR). Only layer III is supported.
+func decodeMP3(data []byte) (Sound, error) {
+	var sound Sound
+
+	offset := 0
+	if len(data) >= 10 && string(data[:3]) == "ID3" {
+		// The tag size is syncsafe: 7 bits per byte
+		size := int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 |
+			int(data[9])
+		offset = 10 + size
+		if data[5]&0x10 != 0 {
+			// Footer
+			offset += 10
+		}
+	}
+
+	// Find the first frame
+	for ; offset+4 <= len(data); offset++ {
+		if data[offset] == 0xFF && data[offset+1]&0xE0 == 0xE0 {
+			break
+		}
+	}
+	if offset+4 > len(data) {
+		return sound, errors.New("MP3 file has no frames")
+	}
+
+	header := binary.BigEndian.Uint32(data[offset : offset+4])
+	version := (header >> 19) & 3 // 0 is 2.5, 2 is 2 & 3 is 1
+	layer := (header >> 17) & 3   // 1 is layer III
+	bitrateIndex := (header >> 12) & 15
+	rateIndex := (header >> 10) & 3
+	mode := (header >> 6) & 3 // 3 is mono
+
+	if version == 1 || layer != 1 || rateIndex == 3 || bitrateIndex == 0 ||
+		bitrateIndex == 15 {
+		return sound, ErrUnsupportedSound
+	}
+
+	sound.SampleRate = mp3SampleRates[rateIndex]
+	bitrate := mp3Bitrates[0][bitrateIndex]
+	samples, sideInfo := 1152, 32
+	if version != 3 {
+		// MPEG-2 halves, and MPEG-2.5 quarters, the sample rate
+		sound.SampleRate /= 2
+		if version == 0 {
+			sound.SampleRate /= 2
+		}
+		bitrate = mp3Bitrates[1][bitrateIndex]
+		samples, sideInfo = 576, 17
+	}
+
+	sound.Channels = 2
+	if mode == 3 {
+		sound.Channels = 1
+		if version == 3 {
+			sideInfo = 17
+		} else {
+			sideInfo = 9
+		}
+	}
+
+	// VBR files start with a Xing or Info frame with the frame count
+	xing := offset + 4 + sideInfo
+	if xing+12 <= len(data) {
+		tag := string(data[xing : xing+4])
+		flags := binary.BigEndian.Uint32(data[xing+4 : xing+8])
+		if (tag == "Xing" || tag == "Info") && flags&1 != 0 {
+			frames := binary.BigEndian.Uint32(data[xing+8 : xing+12])
+			sound.Duration = float64(frames) * float64(samples) /
+				float64(sound.SampleRate)
+			return sound, nil
+		}
+	}
+
+	// Without one, estimate the duration from the bitrate, ignoring
+	// an ID3v1 tag at the end
+	audio := len(data) - offset
+	if len(data) >= 128 && string(data[len(data)-128:len(data)-125]) == "TAG" {
+		audio -= 128
+	}
+	sound.Duration = float64(audio) * 8 / float64(bitrate*1000)
+
+	return sound, nil
+}
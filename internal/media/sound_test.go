@@ -0,0 +1,165 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// encodeWAV returns a WAV file with a fmt chunk of the given format,
+// and a data chunk of size bytes of which only written are included.
+func encodeWAV(format uint16, channels, rate, byteRate, size, written int) []byte {
+	var wav bytes.Buffer
+	wav.WriteString("RIFF")
+	binary.Write(&wav, binary.LittleEndian, uint32(36+size))
+	wav.WriteString("WAVEfmt ")
+	for _, field := range []interface{}{uint32(16), format, uint16(channels),
+		uint32(rate), uint32(byteRate), uint16(2), uint16(16)} {
+		binary.Write(&wav, binary.LittleEndian, field)
+	}
+	wav.WriteString("data")
+	binary.Write(&wav, binary.LittleEndian, uint32(size))
+	wav.Write(make([]byte, written))
+	return wav.Bytes()
+}
+
+// encodeOGGPage returns an OGG page with the given granule position,
+// holding a single packet.
+func encodeOGGPage(granule uint64, packet []byte) []byte {
+	page := make([]byte, 27, 28+len(packet))
+	copy(page, "OggS")
+	binary.LittleEndian.PutUint64(page[6:14], granule)
+	page[26] = 1
+	page = append(page, byte(len(packet)))
+	return append(page, packet...)
+}
+
+// vorbisHeader & opusHeader return the identification headers of a
+// Vorbis & an Opus stream.
+func vorbisHeader(channels, rate int) []byte {
+	packet := make([]byte, 16)
+	copy(packet, "\x01vorbis")
+	packet[11] = byte(channels)
+	binary.LittleEndian.PutUint32(packet[12:16], uint32(rate))
+	return packet
+}
+
+func opusHeader(channels, preSkip, rate int) []byte {
+	packet := make([]byte, 16)
+	copy(packet, "OpusHead")
+	packet[8] = 1
+	packet[9] = byte(channels)
+	binary.LittleEndian.PutUint16(packet[10:12], uint16(preSkip))
+	binary.LittleEndian.PutUint32(packet[12:16], uint32(rate))
+	return packet
+}
+
+// concat joins byte slices.
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestDecodeSound(t *testing.T) {
+	wav := encodeWAV(1, 1, 8000, 8000, 4000, 4000)
+	vorbis := concat(encodeOGGPage(0, vorbisHeader(2, 44100)),
+		encodeOGGPage(88200, []byte("audio")))
+
+	// MPEG-1 layer III, 128kbps, 44.1kHz, stereo
+	mp3 := []byte{0xFF, 0xFB, 0x90, 0x00}
+	// MPEG-2 layer III, 64kbps, 22.05kHz, mono
+	mp3Mono := []byte{0xFF, 0xF3, 0x80, 0xC0}
+	xing := concat(mp3Mono, make([]byte, 9), []byte("Xing"),
+		[]byte{0, 0, 0, 1}, []byte{0, 0, 0, 100}, make([]byte, 100))
+	id3 := concat([]byte("ID3\x04\x00\x00\x00\x00\x01\x48"), make([]byte, 200))
+	id3v1 := concat([]byte("TAG"), make([]byte, 125))
+
+	// A LIST chunk of odd size, which is padded
+	list := concat(wav[:12], []byte("LIST\x03\x00\x00\x00abc\x00"), wav[12:])
+	shortFormat := append([]byte(nil), wav...)
+	shortFormat[16] = 12
+
+	tests := []struct {
+		name       string
+		data       []byte
+		format     string
+		duration   float64
+		sampleRate int
+		channels   int
+		fails      bool
+	}{
+		{name: "wav", data: wav, format: "wav", duration: 0.5, sampleRate: 8000, channels: 1},
+		{name: "wav float", data: encodeWAV(3, 2, 48000, 384000, 96000, 96000), format: "wav", duration: 0.25, sampleRate: 48000, channels: 2},
+		{name: "wav extensible", data: encodeWAV(0xFFFE, 2, 48000, 192000, 0, 0), format: "wav", sampleRate: 48000, channels: 2},
+		{name: "wav padded chunk", data: list, format: "wav", duration: 0.5, sampleRate: 8000, channels: 1},
+		{name: "wav truncated data", data: encodeWAV(1, 1, 8000, 8000, 8000, 2000), format: "wav", duration: 0.25, sampleRate: 8000, channels: 1},
+		{name: "wav no byte rate", data: encodeWAV(1, 1, 8000, 0, 4000, 4000), format: "wav", sampleRate: 8000, channels: 1},
+		{name: "wav adpcm", data: encodeWAV(2, 1, 8000, 8000, 4000, 4000), fails: true},
+		{name: "wav short format", data: shortFormat, fails: true},
+		{name: "wav truncated format", data: wav[:30], fails: true},
+		{name: "wav no format", data: concat([]byte("RIFF\x00\x00\x00\x00WAVEdata\x04\x00\x00\x00"), make([]byte, 4)), fails: true},
+		{name: "wav no channels", data: encodeWAV(1, 0, 8000, 8000, 4000, 4000), fails: true},
+		{name: "wav truncated header", data: wav[:10], fails: true},
+
+		{name: "vorbis", data: vorbis, format: "ogg", duration: 2, sampleRate: 44100, channels: 2},
+		{name: "opus", data: concat(encodeOGGPage(0, opusHeader(1, 312, 16000)), encodeOGGPage(144312, nil)),
+			format: "ogg", duration: 3, sampleRate: 16000, channels: 1},
+		{name: "opus no rate", data: encodeOGGPage(0, opusHeader(2, 0, 0)), format: "ogg", sampleRate: 48000, channels: 2},
+		{name: "ogg last page truncated", data: concat(vorbis, []byte("OggS\x00\x00")),
+			format: "ogg", duration: 2, sampleRate: 44100, channels: 2},
+		{name: "ogg truncated page", data: vorbis[:20], fails: true},
+		{name: "ogg truncated segments", data: concat(vorbis[:26], []byte{255}, make([]byte, 10)), fails: true},
+		{name: "ogg truncated header", data: vorbis[:38], fails: true},
+		{name: "ogg theora", data: encodeOGGPage(0, []byte("\x80theora\x00\x00\x00\x00\x00\x00\x00\x00\x00")), fails: true},
+		{name: "ogg no channels", data: encodeOGGPage(0, vorbisHeader(0, 44100)), fails: true},
+
+		{name: "mp3", data: concat(mp3, make([]byte, 15996)), format: "mp3", duration: 1, sampleRate: 44100, channels: 2},
+		{name: "mp3 id3v1", data: concat(mp3, make([]byte, 15996), id3v1), format: "mp3", duration: 1, sampleRate: 44100, channels: 2},
+		{name: "mp3 id3v2", data: concat(id3, mp3, make([]byte, 15996)), format: "mp3", duration: 1, sampleRate: 44100, channels: 2},
+		{name: "mp3 xing", data: xing, format: "mp3", duration: 100 * 576 / 22050.0, sampleRate: 22050, channels: 1},
+		{name: "mp3 layer II", data: concat([]byte{0xFF, 0xFD, 0x90, 0x00}, make([]byte, 100)), fails: true},
+		{name: "mp3 reserved version", data: concat([]byte{0xFF, 0xEB, 0x90, 0x00}, make([]byte, 100)), fails: true},
+		{name: "mp3 reserved sample rate", data: concat([]byte{0xFF, 0xFB, 0x9C, 0x00}, make([]byte, 100)), fails: true},
+		{name: "mp3 free bitrate", data: concat([]byte{0xFF, 0xFB, 0x00, 0x00}, make([]byte, 100)), fails: true},
+		{name: "mp3 bad bitrate", data: concat([]byte{0xFF, 0xFB, 0xF0, 0x00}, make([]byte, 100)), fails: true},
+		{name: "mp3 id3v2 only", data: id3, fails: true},
+		{name: "mp3 truncated frame", data: mp3[:3], fails: true},
+
+		{name: "empty", data: nil, fails: true},
+		{name: "not a sound", data: []byte("definitely not a sound"), fails: true},
+		{name: "too large", data: concat(wav, make([]byte, MaxSoundBytes)), fails: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sound, err := DecodeSound(test.data)
+			if test.fails {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			if sound.Format != test.format || sound.MimeType != SoundTypes[test.format] ||
+				sound.Extension != "."+test.format {
+				t.Errorf("format = %s (%s, %s), want %s", sound.Format,
+					sound.MimeType, sound.Extension, test.format)
+			}
+			if math.Abs(sound.Duration-test.duration) > 1e-9 {
+				t.Errorf("duration = %v, want %v", sound.Duration, test.duration)
+			}
+			if sound.SampleRate != test.sampleRate || sound.Channels != test.channels {
+				t.Errorf("%dHz × %d channels, want %dHz × %d channels", sound.SampleRate,
+					sound.Channels, test.sampleRate, test.channels)
+			}
+		})
+	}
+}
+
+func TestDecodeSoundUnsupported(t *testing.T) {
+	if _, err := DecodeSound([]byte("fLaC\x00\x00\x00\x22")); err != ErrUnsupportedSound {
+		t.Errorf("error = %v, want %v", err, ErrUnsupportedSound)
+	}
+}
@@ -0,0 +1,323 @@
+// action.go contains the actions of hero skills: what each action
+// does (its type & params), and the actions each skill carries out.
+package methods
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/axkeyz/gacha-api/config"
+	"github.com/axkeyz/gacha-api/internal/battle"
+)
+
+//========================== HERO ACTION =========================//
+// HeroAction is a named action that skills can carry out. Its Type
+// is one of battle.ActionTypes, and its Params are validated against
+// the schema of the type when saved.
+//
+// This is directly mapped to the hero_action_possible table.
+//================================================================//
+type HeroAction struct {
+	ID          int             `query:"id" json:",omitempty"`
+	Name        string          `query:"name" json:",omitempty"`
+	Type        string          `query:"type" json:",omitempty"`
+	Params      json.RawMessage `json:",omitempty"`
+	Description string          `json:",omitempty"`
+	CreatedAt   string          `json:",omitempty"`
+	UpdatedAt   string          `json:",omitempty"`
+}
+
+// HeroAction.Create creates a new HeroAction.
+func (action *HeroAction) Create() error {
+	if err := action.validate(); err != nil {
+		return err
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	return db.QueryRow(`INSERT INTO hero_action_possible (name, type,
+	params, description) VALUES ($1, $2, $3, NULLIF($4, '')) RETURNING id,
+	created_at, updated_at`, action.Name, action.Type, string(action.Params),
+		action.Description,
+	).Scan(&action.ID, &action.CreatedAt, &action.UpdatedAt)
+}
+
+// HeroAction.Read returns the actions that fit the filter.
+func (filter *HeroAction) Read() ([]HeroAction, error) {
+	var actions []HeroAction
+	var action HeroAction
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, name, type, params,
+	COALESCE(description, ''), created_at, updated_at FROM
+	hero_action_possible WHERE (id = $1 OR $1 = 0) AND
+	(lower(name) LIKE lower('%' || $2 || '%')) AND (type = $3 OR $3 = '')
+	ORDER BY name`, filter.ID, filter.Name, filter.Type)
+	if err != nil {
+		return actions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var params []byte
+		if err = rows.Scan(&action.ID, &action.Name, &action.Type, &params,
+			&action.Description, &action.CreatedAt,
+			&action.UpdatedAt); err != nil {
+			return actions, err
+		}
+		action.Params = params
+
+		actions = append(actions, action)
+	}
+
+	return actions, nil
+}
+
+// HeroAction.Update updates a HeroAction given its ID.
+func (action *HeroAction) Update() error {
+	if err := action.validate(); err != nil {
+		return err
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	err := db.QueryRow(`UPDATE hero_action_possible SET name = $1,
+	type = $2, params = $3, description = NULLIF($4, ''), updated_at =
+	CURRENT_TIMESTAMP WHERE id = $5 RETURNING created_at, updated_at`,
+		action.Name, action.Type, string(action.Params), action.Description,
+		action.ID,
+	).Scan(&action.CreatedAt, &action.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return errors.New("Hero action not found")
+	}
+
+	return err
+}
+
+// HeroAction.Delete deletes a HeroAction given its ID. Actions that
+// skills still carry out cannot be deleted.
+func (action *HeroAction) Delete() error {
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM hero_action_possible WHERE id = $1`,
+		action.ID)
+	if err != nil {
+		return errors.New("Hero action is in use and cannot be deleted")
+	} else if count, _ := result.RowsAffected(); count == 0 {
+		return errors.New("Hero action not found")
+	}
+
+	return nil
+}
+
+// HeroAction.validate checks the required fields of a HeroAction,
+// and validates its params against the schema of its type.
+func (action *HeroAction) validate() error {
+	if action.Name == "" || len(action.Name) > 25 {
+		return errors.New("Hero action name must be 1 to 25 characters")
+	}
+
+	if len(action.Params) == 0 {
+		action.Params = json.RawMessage(`{}`)
+	}
+
+	_, err := battle.DecodeAction(action.Type, action.Params)
+	return err
+}
+
+//========================= SKILL ACTION =========================//
+// SkillAction is an action that a hero's skill carries out, in
+// ExecutionOrder, with a Chance (in percent).
+//
+// This is directly mapped to the hero_action_allowed table.
+//================================================================//
+type SkillAction struct {
+	ID             int        `json:",omitempty"`
+	HeroSkillID    int        `json:",omitempty"`
+	HeroActionID   int        `json:",omitempty"`
+	HeroAction     HeroAction `json:",omitempty"`
+	ExecutionOrder int        `json:",omitempty"`
+	Chance         int        `json:",omitempty"`
+}
+
+// ReadSkillActions returns the actions of a hero's skill, in
+// execution order.
+func ReadSkillActions(heroID, skillID int) ([]SkillAction, error) {
+	var actions []SkillAction
+	var action SkillAction
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT hero_action_allowed.id,
+	hero_action_allowed.hero_skill_id, hero_action_allowed.hero_action_id,
+	hero_action_possible.name, hero_action_possible.type,
+	hero_action_possible.params, hero_action_allowed.execution_order,
+	hero_action_allowed.chance FROM hero_action_allowed
+	INNER JOIN hero_skill ON hero_skill.id = hero_action_allowed.hero_skill_id
+	INNER JOIN hero_action_possible ON
+	hero_action_possible.id = hero_action_allowed.hero_action_id
+	WHERE hero_skill.id = $1 AND hero_skill.hero_id = $2
+	ORDER BY hero_action_allowed.execution_order, hero_action_allowed.id`,
+		skillID, heroID)
+	if err != nil {
+		return actions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var params []byte
+		if err = rows.Scan(&action.ID, &action.HeroSkillID,
+			&action.HeroActionID, &action.HeroAction.Name,
+			&action.HeroAction.Type, &params, &action.ExecutionOrder,
+			&action.Chance); err != nil {
+			return actions, err
+		}
+		action.HeroAction.ID = action.HeroActionID
+		action.HeroAction.Params = params
+
+		actions = append(actions, action)
+	}
+
+	return actions, nil
+}
+
+// SaveSkillActions replaces the actions of a hero's skill. Actions
+// of live heroes can only be changed by publishing a revision.
+func SaveSkillActions(heroID, skillID int, actions []SkillAction) error {
+	if err := validateSkillActions(actions); err != nil {
+		return err
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = checkHeroDraft(tx, heroID); err != nil {
+		return err
+	}
+
+	var exists bool
+	if err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM hero_skill WHERE
+	id = $1 AND hero_id = $2)`, skillID, heroID).Scan(&exists); err != nil {
+		return err
+	} else if !exists {
+		return errors.New("Hero skill not found")
+	}
+
+	if err = saveSkillActions(tx, skillID, actions); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// validateSkillActions checks the actions of a skill.
+func validateSkillActions(actions []SkillAction) error {
+	for _, action := range actions {
+		if action.HeroActionID == 0 {
+			return errors.New("Skill actions need a hero action")
+		} else if action.Chance < 0 || action.Chance > 100 {
+			return errors.New("Skill action chance must be between 0 and 100")
+		}
+	}
+
+	return nil
+}
+
+// saveSkillActions replaces the actions of a skill.
+func saveSkillActions(tx *sql.Tx, skillID int, actions []SkillAction) error {
+	if _, err := tx.Exec(`DELETE FROM hero_action_allowed WHERE
+	hero_skill_id = $1`, skillID); err != nil {
+		return err
+	}
+
+	for _, action := range actions {
+		if _, err := tx.Exec(`INSERT INTO hero_action_allowed
+		(execution_order, hero_skill_id, hero_action_id, chance) VALUES
+		($1, $2, $3, $4)`, action.ExecutionOrder, skillID,
+			action.HeroActionID, action.Chance); err != nil {
+			return errors.New("Hero action " +
+				strconv.Itoa(action.HeroActionID) + " not found")
+		}
+	}
+
+	return nil
+}
+
+// Hero.readSkillActions loads the actions of the skills of a Hero,
+// in execution order.
+func (hero *Hero) readSkillActions(q querier) error {
+	skills := map[int]*HeroSkill{}
+	for i := range hero.Skills {
+		hero.Skills[i].Actions = nil
+		skills[hero.Skills[i].ID] = &hero.Skills[i]
+	}
+
+	rows, err := q.Query(`SELECT hero_action_allowed.id,
+	hero_action_allowed.hero_skill_id, hero_action_allowed.hero_action_id,
+	hero_action_possible.name, hero_action_possible.type,
+	hero_action_possible.params, hero_action_allowed.execution_order,
+	hero_action_allowed.chance FROM hero_action_allowed
+	INNER JOIN hero_skill ON hero_skill.id = hero_action_allowed.hero_skill_id
+	INNER JOIN hero_action_possible ON
+	hero_action_possible.id = hero_action_allowed.hero_action_id
+	WHERE hero_skill.hero_id = $1 ORDER BY hero_action_allowed.hero_skill_id,
+	hero_action_allowed.execution_order, hero_action_allowed.id`, hero.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var action SkillAction
+		var params []byte
+
+		if err = rows.Scan(&action.ID, &action.HeroSkillID,
+			&action.HeroActionID, &action.HeroAction.Name,
+			&action.HeroAction.Type, &params, &action.ExecutionOrder,
+			&action.Chance); err != nil {
+			return err
+		}
+		action.HeroAction.ID = action.HeroActionID
+		action.HeroAction.Params = params
+
+		if skill, ok := skills[action.HeroSkillID]; ok {
+			skill.Actions = append(skill.Actions, action)
+		}
+	}
+
+	return rows.Err()
+}
+
+// deleteSkillActions deletes the actions of the skills of a hero
+// that are not kept.
+func deleteSkillActions(tx *sql.Tx, heroID int, kept []string) error {
+	remove := `DELETE FROM hero_action_allowed WHERE hero_skill_id IN
+	(SELECT id FROM hero_skill WHERE hero_id = $1`
+	if len(kept) > 0 {
+		remove += ` AND id NOT IN (` + strings.Join(kept, ", ") + `)`
+	}
+
+	_, err := tx.Exec(remove+`)`, heroID)
+	return err
+}
@@ -0,0 +1,386 @@
+// art.go contains the art assets uploaded by staff, and their links
+// to heroes, skills & currencies.
+package methods
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+
+	"github.com/axkeyz/gacha-api/config"
+	"github.com/axkeyz/gacha-api/internal/media"
+)
+
+// Purposes of linked art
+const (
+	ArtIcon     = "icon"
+	ArtPortrait = "portrait"
+	ArtSplash   = "splash"
+)
+
+//=========================== ART ASSET ==========================//
+// ArtAsset is an uploaded image. Images are stored (with a PNG
+// thumbnail) under their SHA-256 hash, so uploading the same image
+// twice returns the first upload. Uploads & deletes of the same
+// image are serialised by its hash.
+//
+// This is directly mapped to the art_asset table.
+//================================================================//
+type ArtAsset struct {
+	ID           int       `query:"id" json:",omitempty"`
+	Hash         string    `query:"hash" json:",omitempty"`
+	FileName     string    `json:",omitempty"`
+	Thumbnail    string    `json:",omitempty"`
+	OriginalName string    `query:"name" json:",omitempty"`
+	MimeType     string    `query:"mime_type" json:",omitempty"`
+	Size         int       `json:",omitempty"`
+	Width        int       `json:",omitempty"`
+	Height       int       `json:",omitempty"`
+	URL          string    `json:",omitempty"`
+	ThumbnailURL string    `json:",omitempty"`
+	UploadedBy   int       `json:",omitempty"`
+	CreatedAt    string    `json:",omitempty"`
+	Links        []ArtLink `json:",omitempty"`
+}
+
+// UploadArt validates & stores an uploaded image with its thumbnail,
+// and returns its ArtAsset.
+func UploadArt(name string, data []byte, staffID int) (ArtAsset, error) {
+	asset := ArtAsset{
+		Hash:         media.Hash(data),
+		OriginalName: name,
+		Size:         len(data),
+		UploadedBy:   staffID,
+	}
+
+	img, err := media.DecodeImage(data)
+	if err != nil {
+		return asset, err
+	}
+
+	asset.MimeType, asset.Width, asset.Height = img.MimeType, img.Width,
+		img.Height
+	asset.FileName = "art/" + asset.Hash + img.Extension
+	asset.Thumbnail = "art/" + asset.Hash + "_thumb.png"
+
+	thumbnail, err := img.Thumbnail()
+	if err != nil {
+		return asset, err
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return asset, err
+	}
+	defer tx.Rollback()
+
+	if err = lockArtFile(tx, asset.Hash); err != nil {
+		return asset, err
+	}
+
+	// Return the first upload of the same image
+	existing := ArtAsset{Hash: asset.Hash}
+	if assets, err := existing.Read(); err != nil {
+		return asset, err
+	} else if len(assets) > 0 {
+		return assets[0], nil
+	}
+
+	if err = tx.QueryRow(`INSERT INTO art_asset (hash, file_name,
+	thumbnail, original_name, mime_type, size, width, height, uploaded_by)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING id, created_at`,
+		asset.Hash, asset.FileName, asset.Thumbnail, asset.OriginalName,
+		asset.MimeType, asset.Size, asset.Width, asset.Height,
+		asset.UploadedBy,
+	).Scan(&asset.ID, &asset.CreatedAt); err != nil {
+		return asset, err
+	}
+
+	// The files are only saved once their asset is, and are removed
+	// again if the asset cannot be committed
+	store := config.SetupStorage()
+	if err = store.Save(asset.FileName, data); err == nil {
+		err = store.Save(asset.Thumbnail, thumbnail)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		store.Delete(asset.FileName)
+		store.Delete(asset.Thumbnail)
+		return asset, err
+	}
+
+	asset.setURLs()
+	return asset, nil
+}
+
+// ArtAsset.Read returns the art assets that fit the filter, newest
+// first, with their links.
+func (filter *ArtAsset) Read() ([]ArtAsset, error) {
+	var assets []ArtAsset
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, hash, file_name, thumbnail,
+	original_name, mime_type, size, width, height, uploaded_by, created_at
+	FROM art_asset WHERE (id = $1 OR $1 = 0) AND (hash = $2 OR $2 = '') AND
+	(lower(original_name) LIKE lower('%' || $3 || '%')) AND
+	(mime_type = $4 OR $4 = '') ORDER BY id DESC`, filter.ID, filter.Hash,
+		filter.OriginalName, filter.MimeType)
+	if err != nil {
+		return assets, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var asset ArtAsset
+		if err = rows.Scan(&asset.ID, &asset.Hash, &asset.FileName,
+			&asset.Thumbnail, &asset.OriginalName, &asset.MimeType,
+			&asset.Size, &asset.Width, &asset.Height, &asset.UploadedBy,
+			&asset.CreatedAt); err != nil {
+			return assets, err
+		}
+
+		asset.setURLs()
+		assets = append(assets, asset)
+	}
+
+	for i := range assets {
+		link := ArtLink{ArtAssetID: assets[i].ID}
+		if assets[i].Links, err = link.Read(); err != nil {
+			return assets, err
+		}
+	}
+
+	return assets, nil
+}
+
+// ArtAsset.Delete deletes an ArtAsset & its files given its ID. Art
+// that is still linked cannot be deleted.
+func (asset *ArtAsset) Delete() error {
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = tx.QueryRow(`SELECT hash FROM art_asset WHERE id = $1`,
+		asset.ID).Scan(&asset.Hash); err == sql.ErrNoRows {
+		return errors.New("Art asset not found")
+	} else if err != nil {
+		return err
+	} else if err = lockArtFile(tx, asset.Hash); err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`DELETE FROM art_asset WHERE id = $1 RETURNING
+	file_name, thumbnail`, asset.ID).Scan(&asset.FileName, &asset.Thumbnail)
+	if err == sql.ErrNoRows {
+		return errors.New("Art asset not found")
+	} else if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+		return errors.New("Art asset is linked and cannot be deleted")
+	} else if err != nil {
+		return err
+	}
+
+	// The files are deleted while the hash is locked, so that an
+	// upload of the same image cannot find them before they are gone
+	store := config.SetupStorage()
+	if err = store.Delete(asset.FileName); err != nil {
+		return err
+	} else if err = store.Delete(asset.Thumbnail); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// lockArtFile serialises uploads & deletes of the image with the
+// given hash until tx ends.
+func lockArtFile(tx *sql.Tx, hash string) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`,
+		"art/"+hash)
+	return err
+}
+
+// ArtAsset.setURLs sets the URLs the art is served at.
+func (asset *ArtAsset) setURLs() {
+	store := config.SetupStorage()
+	asset.URL = store.URL(asset.FileName)
+	asset.ThumbnailURL = store.URL(asset.Thumbnail)
+}
+
+//=========================== ART LINK ===========================//
+// ArtLink links an ArtAsset to one hero, skill or currency, for a
+// Purpose. Heroes have icons, portraits & splash art, while skills &
+// currencies only have icons, which must be square. Linking an icon
+// to a skill or currency also sets its icon or url to the icon's
+// URL. A hero, skill or currency has at most one link per purpose.
+//
+// This is directly mapped to the art_link table.
+//================================================================//
+type ArtLink struct {
+	ID          int    `query:"id" json:",omitempty"`
+	ArtAssetID  int    `json:",omitempty"`
+	HeroID      int    `query:"hero_id" json:",omitempty"`
+	HeroSkillID int    `query:"hero_skill_id" json:",omitempty"`
+	CurrencyID  int    `query:"currency_id" json:",omitempty"`
+	Purpose     string `query:"purpose" json:",omitempty"`
+	CreatedAt   string `json:",omitempty"`
+}
+
+// ArtLink.Save creates or replaces the art of a hero, skill or
+// currency for the link's purpose.
+func (link *ArtLink) Save() error {
+	targets := 0
+	for _, id := range []int{link.HeroID, link.HeroSkillID, link.CurrencyID} {
+		if id != 0 {
+			targets++
+		}
+	}
+
+	if targets != 1 {
+		return errors.New("Art must be linked to one hero, skill or currency")
+	}
+
+	switch link.Purpose {
+	case ArtIcon:
+	case ArtPortrait, ArtSplash:
+		if link.HeroID == 0 {
+			return errors.New("Only heroes have portraits and splash art")
+		}
+	default:
+		return errors.New("Art purpose must be icon, portrait or splash")
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var fileName string
+	var width, height int
+	err = tx.QueryRow(`SELECT file_name, width, height FROM art_asset
+	WHERE id = $1`, link.ArtAssetID).Scan(&fileName, &width, &height)
+	if err == sql.ErrNoRows {
+		return errors.New("Art asset not found")
+	} else if err != nil {
+		return err
+	} else if link.Purpose == ArtIcon && width != height {
+		return errors.New("Icons must be square")
+	}
+
+	url := config.SetupStorage().URL(fileName)
+	conflict := "hero_id"
+
+	if link.HeroSkillID != 0 {
+		conflict = "hero_skill_id"
+
+		// Skills of live heroes change by publishing a revision
+		var heroID int
+		if err = tx.QueryRow(`SELECT hero_id FROM hero_skill WHERE id = $1`,
+			link.HeroSkillID).Scan(&heroID); err == sql.ErrNoRows {
+			return errors.New("Hero skill not found")
+		} else if err != nil {
+			return err
+		} else if err = checkHeroDraft(tx, heroID); err != nil {
+			return err
+		}
+
+		if _, err = tx.Exec(`UPDATE hero_skill SET icon = $1 WHERE id = $2`,
+			url, link.HeroSkillID); err != nil {
+			return errors.New("Icon is already used by another skill")
+		}
+	} else if link.CurrencyID != 0 {
+		conflict = "currency_id"
+
+		result, err := tx.Exec(`UPDATE currency SET url = $1,
+		updated_at = CURRENT_TIMESTAMP WHERE id = $2`, url, link.CurrencyID)
+		if err != nil {
+			return errors.New("Icon is already used by another currency")
+		} else if count, _ := result.RowsAffected(); count == 0 {
+			return errors.New("Currency not found")
+		}
+	}
+
+	if err = tx.QueryRow(`INSERT INTO art_link (art_asset_id, hero_id,
+	hero_skill_id, currency_id, purpose) VALUES ($1, NULLIF($2, 0),
+	NULLIF($3, 0), NULLIF($4, 0), $5) ON CONFLICT (`+conflict+`, purpose)
+	DO UPDATE SET art_asset_id = $1, created_at = CURRENT_TIMESTAMP
+	RETURNING id, created_at`, link.ArtAssetID, link.HeroID,
+		link.HeroSkillID, link.CurrencyID, link.Purpose,
+	).Scan(&link.ID, &link.CreatedAt); err != nil {
+		return errors.New("Hero not found")
+	}
+
+	return tx.Commit()
+}
+
+// ArtLink.Read returns the art links that fit the filter.
+func (filter *ArtLink) Read() ([]ArtLink, error) {
+	var links []ArtLink
+	var link ArtLink
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, art_asset_id, COALESCE(hero_id, 0),
+	COALESCE(hero_skill_id, 0), COALESCE(currency_id, 0), purpose,
+	created_at FROM art_link WHERE (art_asset_id = $1 OR $1 = 0) AND
+	(hero_id = $2 OR $2 = 0) AND (hero_skill_id = $3 OR $3 = 0) AND
+	(currency_id = $4 OR $4 = 0) AND (purpose = $5 OR $5 = '')
+	ORDER BY id`, filter.ArtAssetID, filter.HeroID, filter.HeroSkillID,
+		filter.CurrencyID, filter.Purpose)
+	if err != nil {
+		return links, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&link.ID, &link.ArtAssetID, &link.HeroID,
+			&link.HeroSkillID, &link.CurrencyID, &link.Purpose,
+			&link.CreatedAt); err != nil {
+			return links, err
+		}
+
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+// ArtLink.Delete deletes an ArtLink given its ID & asset. The icon
+// or url of an unlinked skill or currency is left as it was.
+func (link *ArtLink) Delete() error {
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM art_link WHERE id = $1 AND
+	art_asset_id = $2`, link.ID, link.ArtAssetID)
+	if err != nil {
+		return err
+	} else if count, _ := result.RowsAffected(); count == 0 {
+		return errors.New("Art link not found")
+	}
+
+	return nil
+}
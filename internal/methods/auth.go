@@ -41,6 +41,25 @@ func (auth *Auth) Staff(token *JWTToken) (error) {
 	return nil
 }
 
+// AUTH METHODS - Player
+// (auth *Auth).Player authenticates a player using the Auth struct
+// and saves the details in the JWTToken (token) pointer. Disabled
+// players cannot authenticate.
+func (auth *Auth) Player(token *JWTToken) error {
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	q := `SELECT id, username, COALESCE(email::text, '') FROM player
+	WHERE (lower(username) = lower($1) OR lower(email) = lower($1)) AND
+	password = crypt($2, password) AND disabled_at IS NULL`
+
+	// Check if player exists
+	return db.QueryRow(q, auth.Username, auth.Password).Scan(
+		&token.ID, &token.Name, &token.Email,
+	)
+}
+
 // UpdateStaffLogin updates the last_login timestamp of a staff user on
 // the staff table to the current timestamp.
 func (auth *Auth) UpdateStaffLastLogin() {
@@ -99,6 +118,25 @@ func (token *JWTToken) CreateStaffToken(auth Auth) (string, error) {
 	}
 }
 
+// TOKENS - player methods
+// CreatePlayerToken generates a new player token, when given an Auth
+// model, in the same way as CreateStaffToken.
+func (token *JWTToken) CreatePlayerToken(auth Auth) (string, error) {
+	// Setup defaults for a player JWT token
+	token.Staff = false
+	token.ExpiresAt = time.Now().Add(time.Hour * 72).Unix()
+
+	if err := auth.Player(token); err != nil {
+		// Authenticating the player failed
+		log.Println(err)
+		return "", err
+	}
+
+	// Create token & generate encoded token
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, token)
+	return t.SignedString([]byte(os.Getenv("APP_SECRET")))
+}
+
 // CurrentAuthStaff packs the currently authenticated staff member's
 // JWT token into its readable form.
 func CurrentAuthStaff(user interface{}) JWTToken {
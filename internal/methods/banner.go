@@ -0,0 +1,600 @@
+// banner.go contains CRUD functions for hero banners, and switches
+// scheduled banners on & off.
+package methods
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/axkeyz/gacha-api/config"
+	"github.com/axkeyz/gacha-api/internal/gacha"
+)
+
+// Banner types. Only featured banners are limited to one per slot
+// at a time.
+const (
+	BannerFeatured = "featured"
+	BannerStandard = "standard"
+)
+
+var ErrBannerOverlap = errors.New("Banner overlaps another featured banner in its slot")
+
+//========================== HERO BANNER =========================//
+// HeroBanner is a summonable banner that features one or more
+// heroes, each with a weight.
+//
+// A banner is active (summonable) while it is enabled and the
+// current time is between RunStart & RunEnd. Either may be empty
+// for a banner that has no start or end. Enabled featured banners
+// cannot run at the same time in the same Slot.
+//
+// Each pull costs CostSingle (or CostMulti for a 10-pull) of the
+// currency CostCurrencyID. Rates are the banner's loot table: the
+// percent chance of each rarity tier.
+//
+// Pity applies to the banner's top rarity: from pull PitySoftStart
+// each pull adds PitySoftStep percent, and pull PityHard always
+// pulls it. FeaturedRate is the percent chance that a top rarity
+// hero is featured (see gacha.Pity). Pulls may also earn Spark
+// points (see HeroBannerSpark).
+//
+// This is directly mapped to the hero_banner & hero_banner_hero
+// tables.
+//================================================================//
+type HeroBanner struct {
+	ID             int              `query:"id" json:",omitempty"`
+	Name           string           `query:"name" json:",omitempty"`
+	BannerType     string           `query:"banner_type" json:",omitempty"`
+	Slot           int              `json:",omitempty"`
+	IsEnabled      bool             `json:",omitempty"`
+	IsActive       bool             `query:"is_active" json:",omitempty"`
+	RunStart       string           `json:",omitempty"`
+	RunEnd         string           `json:",omitempty"`
+	CostCurrencyID int              `json:",omitempty"`
+	CostSingle     int              `json:",omitempty"`
+	CostMulti      int              `json:",omitempty"`
+	PitySoftStart  int              `json:",omitempty"`
+	PitySoftStep   float64          `json:",omitempty"`
+	PityHard       int              `json:",omitempty"`
+	FeaturedRate   float64          `json:",omitempty"`
+	Spark          HeroBannerSpark  `json:",omitempty"`
+	Heroes         []HeroBannerHero `json:",omitempty"`
+	Rates          []HeroBannerRate `json:",omitempty"`
+	CreatedAt      string           `json:",omitempty"`
+	UpdatedAt      string           `json:",omitempty"`
+	Pagination
+}
+
+// HeroBannerHero is a hero on a banner. Heroes that are not
+// featured are the banner's off-banner pool.
+type HeroBannerHero struct {
+	HeroID     int  `json:",omitempty"`
+	Hero       Hero `json:",omitempty"`
+	Weight     int  `json:",omitempty"`
+	IsFeatured bool `json:",omitempty"`
+}
+
+// HeroBannerRate is the percent chance of pulling a rarity tier on
+// a banner.
+type HeroBannerRate struct {
+	Rarity int     `json:",omitempty"`
+	Rate   float64 `json:",omitempty"`
+}
+
+// querier is a database or database transaction that banner items
+// can be read from.
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// bannerRunning is the SQL condition under which a banner is active.
+const bannerRunning = `is_enabled AND COALESCE(run_start <=
+	CURRENT_TIMESTAMP, true) AND COALESCE(run_end > CURRENT_TIMESTAMP, true)`
+
+// HeroBanner.Create creates a new HeroBanner and its featured
+// heroes in the database.
+func (banner *HeroBanner) Create() error {
+	if err := banner.validate(); err != nil {
+		return err
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = banner.checkOverlap(tx); err != nil {
+		return err
+	}
+
+	if err = tx.QueryRow(`INSERT INTO hero_banner (name, banner_type, slot,
+	is_enabled, run_start, run_end, cost_currency_id, cost_single,
+	cost_multi, pity_soft_start, pity_soft_step, pity_hard, featured_rate,
+	spark_currency_id, spark_per_pull, spark_cost, spark_on_end,
+	spark_convert_currency_id, spark_convert_rate) VALUES ($1, $2, $3, $4,
+	NULLIF($5, '')::timestamp, NULLIF($6, '')::timestamp, $7, $8, $9, $10,
+	$11, $12, $13, NULLIF($14, 0), $15, $16, $17, NULLIF($18, 0), $19)
+	RETURNING id`, banner.Name, banner.BannerType, banner.Slot,
+		banner.IsEnabled, banner.RunStart, banner.RunEnd,
+		banner.CostCurrencyID, banner.CostSingle, banner.CostMulti,
+		banner.PitySoftStart, banner.PitySoftStep, banner.PityHard,
+		banner.FeaturedRate, banner.Spark.CurrencyID, banner.Spark.PerPull,
+		banner.Spark.Cost, banner.Spark.OnEnd, banner.Spark.ConvertCurrencyID,
+		banner.Spark.ConvertRate,
+	).Scan(&banner.ID); err != nil {
+		return err
+	}
+
+	if err = banner.saveHeroes(tx); err != nil {
+		return err
+	} else if err = banner.saveRates(tx); err != nil {
+		return err
+	}
+
+	if err = banner.publish(tx); err != nil {
+		return err
+	}
+
+	if err = banner.schedule(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// HeroBanner.Read returns all HeroBanners (with their featured
+// heroes) that fit the given filter *HeroBanner.
+func (filter *HeroBanner) Read() ([]HeroBanner, error) {
+	var banners []HeroBanner
+	var banner HeroBanner
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	// Setup query
+	main := `SELECT id, name, banner_type, slot, is_enabled,
+	COALESCE(is_active, false), COALESCE(run_start::text, ''),
+	COALESCE(run_end::text, ''), cost_currency_id, cost_single, cost_multi,
+	pity_soft_start, pity_soft_step, pity_hard, featured_rate,
+	COALESCE(spark_currency_id, 0), spark_per_pull, spark_cost, spark_on_end,
+	COALESCE(spark_convert_currency_id, 0), spark_convert_rate,
+	COALESCE(spark_settled_at::text, ''), created_at, updated_at
+	FROM hero_banner`
+	where, args := filter.Filter()
+	sort := filter.Pagination.Query()
+
+	rows, err := db.Query(main+where+sort, args...)
+	if err != nil {
+		return banners, err
+	}
+
+	for rows.Next() {
+		// Save data to pointer
+		err = rows.Scan(&banner.ID, &banner.Name, &banner.BannerType,
+			&banner.Slot, &banner.IsEnabled, &banner.IsActive,
+			&banner.RunStart, &banner.RunEnd, &banner.CostCurrencyID,
+			&banner.CostSingle, &banner.CostMulti, &banner.PitySoftStart,
+			&banner.PitySoftStep, &banner.PityHard, &banner.FeaturedRate,
+			&banner.Spark.CurrencyID, &banner.Spark.PerPull,
+			&banner.Spark.Cost, &banner.Spark.OnEnd,
+			&banner.Spark.ConvertCurrencyID, &banner.Spark.ConvertRate,
+			&banner.Spark.SettledAt, &banner.CreatedAt, &banner.UpdatedAt)
+
+		if err != nil {
+			// Display error if rows.Scan causes an error
+			rows.Close()
+			return banners, err
+		}
+
+		banners = append(banners, banner)
+	}
+	rows.Close()
+
+	// Get the featured heroes & rates of each banner
+	for i := range banners {
+		if err = banners[i].readHeroes(db); err != nil {
+			return banners, err
+		} else if err = banners[i].readRates(db); err != nil {
+			return banners, err
+		}
+	}
+
+	return banners, nil
+}
+
+// HeroBanner.Update updates a HeroBanner given its ID, replacing
+// all of its featured heroes.
+func (banner *HeroBanner) Update() error {
+	if banner.ID == 0 {
+		return errors.New("Banner ID cannot be empty")
+	} else if err := banner.validate(); err != nil {
+		return err
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = banner.checkOverlap(tx); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`UPDATE hero_banner SET name = $1, banner_type = $2,
+		slot = $3, is_enabled = $4, run_start = NULLIF($5, '')::timestamp,
+		run_end = NULLIF($6, '')::timestamp, cost_currency_id = $7,
+		cost_single = $8, cost_multi = $9, pity_soft_start = $10,
+		pity_soft_step = $11, pity_hard = $12, featured_rate = $13,
+		spark_currency_id = NULLIF($14, 0), spark_per_pull = $15,
+		spark_cost = $16, spark_on_end = $17,
+		spark_convert_currency_id = NULLIF($18, 0), spark_convert_rate = $19,
+		updated_at = CURRENT_TIMESTAMP WHERE id = $20`, banner.Name,
+		banner.BannerType, banner.Slot, banner.IsEnabled, banner.RunStart,
+		banner.RunEnd, banner.CostCurrencyID, banner.CostSingle,
+		banner.CostMulti, banner.PitySoftStart, banner.PitySoftStep,
+		banner.PityHard, banner.FeaturedRate, banner.Spark.CurrencyID,
+		banner.Spark.PerPull, banner.Spark.Cost, banner.Spark.OnEnd,
+		banner.Spark.ConvertCurrencyID, banner.Spark.ConvertRate, banner.ID,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM hero_banner_hero WHERE
+		hero_banner_id = $1`, banner.ID); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM hero_banner_rate WHERE
+		hero_banner_id = $1`, banner.ID); err != nil {
+		return err
+	}
+
+	if err = banner.saveHeroes(tx); err != nil {
+		return err
+	} else if err = banner.saveRates(tx); err != nil {
+		return err
+	}
+
+	if err = banner.publish(tx); err != nil {
+		return err
+	}
+
+	if err = banner.schedule(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// HeroBanner.Delete deletes a HeroBanner given its ID. Banners that
+// have been summoned from cannot be deleted, only disabled.
+func (banner *HeroBanner) Delete() error {
+	var summoned bool
+
+	if banner.ID == 0 {
+		return errors.New("Banner ID cannot be empty")
+	}
+
+	// Setup database & query
+	db := config.SetupDB()
+	defer db.Close()
+
+	if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM summon WHERE
+	hero_banner_id = $1)`, banner.ID).Scan(&summoned); err != nil {
+		return err
+	} else if summoned {
+		return errors.New("Banner has summons, disable it instead")
+	}
+
+	if _, err := db.Exec(`DELETE FROM hero_banner WHERE id = $1`,
+		banner.ID); err == nil {
+		// Return nothing
+		return nil
+	} else {
+		// Return error
+		return err
+	}
+}
+
+// HeroBanner.Filter generates a WHERE query string & its arguments
+// given the filter parameters.
+func (filter *HeroBanner) Filter() (string, []interface{}) {
+	var items []string
+	var args []interface{}
+
+	if filter.Name != "" {
+		args = append(args, filter.Name)
+		items = append(items, "lower(name) LIKE lower('%' || $"+
+			strconv.Itoa(len(args))+" || '%')")
+	}
+
+	if filter.ID != 0 {
+		args = append(args, filter.ID)
+		items = append(items, "id = $"+strconv.Itoa(len(args)))
+	}
+
+	if filter.BannerType != "" {
+		args = append(args, filter.BannerType)
+		items = append(items, "banner_type = $"+strconv.Itoa(len(args)))
+	}
+
+	if filter.IsActive {
+		items = append(items, "is_active = true")
+	}
+
+	if len(items) > 0 {
+		return " WHERE " + strings.Join(items, " AND "), args
+	} else {
+		return "", args
+	}
+}
+
+// HeroBanner.validate checks the required fields of a HeroBanner
+// and defaults it to a featured banner in slot 1.
+func (banner *HeroBanner) validate() error {
+	if banner.BannerType == "" {
+		banner.BannerType = BannerFeatured
+	}
+	if banner.Slot == 0 {
+		banner.Slot = 1
+	}
+
+	if banner.Name == "" {
+		return errors.New("Banner name cannot be empty")
+	} else if banner.BannerType != BannerFeatured &&
+		banner.BannerType != BannerStandard {
+		return errors.New("Banner type must be featured or standard")
+	} else if len(banner.Heroes) == 0 {
+		return errors.New("Banner needs at least one hero")
+	} else if banner.CostCurrencyID == 0 || banner.CostSingle <= 0 ||
+		banner.CostMulti <= 0 {
+		return errors.New("Banner needs a currency and positive costs")
+	}
+
+	if banner.PitySoftStart < 0 || banner.PitySoftStep < 0 ||
+		banner.PityHard < 0 {
+		return errors.New("Pity settings cannot be negative")
+	} else if banner.FeaturedRate < 0 || banner.FeaturedRate > 100 {
+		return errors.New("Featured rate must be between 0 and 100 percent")
+	}
+
+	if err := banner.Spark.validate(); err != nil {
+		return err
+	}
+
+	rarities := map[int]bool{}
+	for _, rate := range banner.Rates {
+		if rate.Rate < 0 || rate.Rate > 100 {
+			return errors.New("Rates must be between 0 and 100 percent")
+		} else if rarities[rate.Rarity] {
+			return errors.New("Banner rarity is repeated")
+		}
+		rarities[rate.Rarity] = true
+	}
+
+	seen := map[int]bool{}
+	for _, hero := range banner.Heroes {
+		if hero.Weight <= 0 {
+			return errors.New("Hero weights must be positive")
+		} else if seen[hero.HeroID] {
+			return errors.New("Banner hero is repeated")
+		}
+		seen[hero.HeroID] = true
+	}
+
+	return nil
+}
+
+// HeroBanner.checkOverlap returns ErrBannerOverlap if an enabled
+// featured banner would run at the same time as another in the
+// same slot. Banner writes are serialised until tx ends.
+func (banner *HeroBanner) checkOverlap(tx *sql.Tx) error {
+	var overlaps bool
+
+	if _, err := tx.Exec(`LOCK TABLE hero_banner IN SHARE ROW EXCLUSIVE
+		MODE`); err != nil {
+		return err
+	}
+
+	if banner.BannerType != BannerFeatured || !banner.IsEnabled {
+		return nil
+	}
+
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM hero_banner WHERE
+	banner_type = $1 AND is_enabled AND slot = $2 AND id <> $3 AND
+	tsrange(run_start, run_end) && tsrange(NULLIF($4, '')::timestamp,
+	NULLIF($5, '')::timestamp))`, BannerFeatured, banner.Slot, banner.ID,
+		banner.RunStart, banner.RunEnd,
+	).Scan(&overlaps); err != nil {
+		return err
+	} else if overlaps {
+		return ErrBannerOverlap
+	}
+
+	return nil
+}
+
+// HeroBanner.saveHeroes inserts the featured heroes of a HeroBanner.
+// Every hero needs base stats, which its summons start with.
+func (banner *HeroBanner) saveHeroes(tx *sql.Tx) error {
+	for _, hero := range banner.Heroes {
+		var hasStats bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM hero_base_stat
+		WHERE hero_id = $1)`, hero.HeroID).Scan(&hasStats); err != nil {
+			return err
+		} else if !hasStats {
+			return errors.New("Hero " + strconv.Itoa(hero.HeroID) +
+				" has no base stats")
+		}
+
+		if _, err := tx.Exec(`INSERT INTO hero_banner_hero (hero_banner_id,
+			hero_id, weight, is_featured) VALUES ($1, $2, $3, $4)`, banner.ID,
+			hero.HeroID, hero.Weight, hero.IsFeatured); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HeroBanner.saveRates inserts the rates of a HeroBanner.
+func (banner *HeroBanner) saveRates(tx *sql.Tx) error {
+	for _, rate := range banner.Rates {
+		if _, err := tx.Exec(`INSERT INTO hero_banner_rate (hero_banner_id,
+			rarity, rate) VALUES ($1, $2, $3)`, banner.ID, rate.Rarity,
+			rate.Rate); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// HeroBanner.readRates loads the rates of a HeroBanner.
+func (banner *HeroBanner) readRates(db querier) error {
+	var rate HeroBannerRate
+
+	banner.Rates = nil
+
+	rows, err := db.Query(`SELECT rarity, rate FROM hero_banner_rate WHERE
+	hero_banner_id = $1 ORDER BY rarity DESC`, banner.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&rate.Rarity, &rate.Rate); err != nil {
+			return err
+		}
+
+		banner.Rates = append(banner.Rates, rate)
+	}
+
+	return nil
+}
+
+// HeroBanner.LootTable builds the loot table of a HeroBanner: a tier
+// for each rate, holding the banner's heroes of that rarity, and the
+// banner's pity.
+func (banner *HeroBanner) LootTable() gacha.LootTable {
+	table := gacha.LootTable{
+		Pity: gacha.Pity{
+			SoftStart:    banner.PitySoftStart,
+			SoftStep:     gacha.RateFromPercent(banner.PitySoftStep),
+			Hard:         banner.PityHard,
+			FeaturedRate: gacha.RateFromPercent(banner.FeaturedRate),
+		},
+	}
+
+	for _, rate := range banner.Rates {
+		tier := gacha.Tier{
+			Rarity: rate.Rarity,
+			Rate:   gacha.RateFromPercent(rate.Rate),
+		}
+
+		for _, hero := range banner.Heroes {
+			if int(hero.Hero.Rarity) == rate.Rarity {
+				tier.Heroes = append(tier.Heroes, gacha.Entry{
+					HeroID:   hero.HeroID,
+					Weight:   hero.Weight,
+					Featured: hero.IsFeatured,
+				})
+			}
+		}
+
+		table.Tiers = append(table.Tiers, tier)
+	}
+
+	return table
+}
+
+// HeroBanner.Simulate runs a Monte Carlo simulation of the banner's
+// loot table and costs. Nothing is written to the database. A seed
+// is picked at random if sim.Seed is 0.
+func (banner *HeroBanner) Simulate(sim gacha.Simulation) (gacha.SimulationReport, error) {
+	if sim.Seed == 0 {
+		sim.Seed = int64(gacha.CryptoSource{}.Uint64() >> 1)
+	}
+	sim.CostSingle, sim.CostMulti = banner.CostSingle, banner.CostMulti
+
+	return sim.Run(banner.LootTable())
+}
+
+// HeroBanner.readHeroes loads the featured heroes of a HeroBanner.
+func (banner *HeroBanner) readHeroes(db querier) error {
+	var hero HeroBannerHero
+
+	banner.Heroes = nil
+
+	rows, err := db.Query(`SELECT hero.id, hero.name, hero.class,
+	hero.rarity, hero.element, hero_banner_hero.weight,
+	hero_banner_hero.is_featured FROM
+	hero_banner_hero INNER JOIN hero ON hero.id = hero_banner_hero.hero_id
+	WHERE hero_banner_id = $1 ORDER BY hero.id`, banner.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&hero.HeroID, &hero.Hero.Name, &hero.Hero.Class,
+			&hero.Hero.Rarity, &hero.Hero.Element, &hero.Weight,
+			&hero.IsFeatured); err != nil {
+			return err
+		}
+		hero.Hero.ID = hero.HeroID
+
+		banner.Heroes = append(banner.Heroes, hero)
+	}
+
+	return nil
+}
+
+// HeroBanner.schedule switches a single banner on or off straight
+// away, rather than waiting for ScheduleHeroBanners.
+func (banner *HeroBanner) schedule(tx *sql.Tx) error {
+	return tx.QueryRow(`UPDATE hero_banner SET is_active = (`+bannerRunning+`)
+	WHERE id = $1 RETURNING is_active`, banner.ID).Scan(&banner.IsActive)
+}
+
+// ScheduleHeroBanners switches banners on & off according to their
+// run times. It returns the IDs of the banners that were switched.
+func ScheduleHeroBanners() ([]int, error) {
+	var switched []int
+	var id int
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	rows, err := db.Query(`UPDATE hero_banner SET is_active = (` +
+		bannerRunning + `) WHERE is_active IS DISTINCT FROM (` +
+		bannerRunning + `) RETURNING id`)
+	if err != nil {
+		return switched, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&id); err != nil {
+			return switched, err
+		}
+		switched = append(switched, id)
+	}
+
+	return switched, nil
+}
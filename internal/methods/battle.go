@@ -0,0 +1,187 @@
+// battle.go loads heroes & the element matrix into headless battle
+// simulations (see the battle package).
+package methods
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/axkeyz/gacha-api/config"
+	"github.com/axkeyz/gacha-api/internal/battle"
+	"github.com/axkeyz/gacha-api/internal/gacha"
+)
+
+//====================== BATTLE SIMULATION =======================//
+// BattleSimulation fights teams of heroes (by ID) against each other
+// with their base stats, skill multipliers & skill actions, and
+// reports the win rates of each matchup & hero.
+//
+// A random seed is picked if Seed is 0; the report includes the
+// seed so that the run can be repeated.
+//================================================================//
+type BattleSimulation struct {
+	Teams   [][]int `json:",omitempty"`
+	Battles int     `json:",omitempty"`
+	Seed    int64   `json:",omitempty"`
+}
+
+// BattleSimulation.Run loads the teams and runs the simulation.
+func (request *BattleSimulation) Run() (battle.SimulationReport, error) {
+	sim := battle.Simulation{Battles: request.Battles, Seed: request.Seed}
+	if sim.Seed == 0 {
+		sim.Seed = int64(gacha.CryptoSource{}.Uint64() >> 1)
+	}
+
+	if len(request.Teams) < 2 {
+		return battle.SimulationReport{}, errors.New(
+			"Simulation needs at least two teams")
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	units := make(map[int]battle.Unit)
+	for i, heroes := range request.Teams {
+		team := battle.Team{Name: "Team " + strconv.Itoa(i+1)}
+
+		for _, heroID := range heroes {
+			unit, ok := units[heroID]
+			if !ok {
+				var err error
+				if unit, err = readUnit(db, heroID); err != nil {
+					return battle.SimulationReport{}, err
+				}
+				units[heroID] = unit
+			}
+			team.Units = append(team.Units, unit)
+		}
+
+		sim.Teams = append(sim.Teams, team)
+	}
+
+	var err error
+	if sim.Matrix, err = readMatrix(db); err != nil {
+		return battle.SimulationReport{}, err
+	}
+
+	return sim.Run()
+}
+
+// readUnit loads a hero with its base stats, and its skills with
+// their multipliers & actions (in execution order).
+func readUnit(db *sql.DB, heroID int) (battle.Unit, error) {
+	combatant, err := readCombatant(db, heroID, 0)
+	if err != nil {
+		return battle.Unit{}, err
+	}
+
+	unit := battle.Unit{
+		HeroID:  combatant.HeroID,
+		Name:    combatant.Name,
+		Element: int(combatant.Element),
+		Stats:   combatant.Stats,
+	}
+
+	rows, err := db.Query(`SELECT hero_skill.id,
+	COALESCE(hero_skill.is_active_skill, false),
+	COALESCE(power, 0), COALESCE(attack, 0), COALESCE(crit_damage, 0),
+	COALESCE(defence, 0), COALESCE(health, 0), COALESCE(percent_health, 0),
+	COALESCE(vs_debuffed, 0), COALESCE(vs_evaded, 0),
+	COALESCE(vs_high_hp, 0), COALESCE(vs_high_atk, 0) FROM hero_skill
+	LEFT JOIN hero_skill_multiplier ON
+	hero_skill_multiplier.hero_skill_id = hero_skill.id
+	WHERE hero_skill.hero_id = $1 ORDER BY hero_skill.id`, heroID)
+	if err != nil {
+		return unit, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var skill battle.Skill
+		m := &skill.Multiplier
+
+		if err = rows.Scan(&skill.ID, &skill.IsActive, &m.Power, &m.Attack,
+			&m.CritDamage, &m.Defence, &m.Health, &m.PercentHealth,
+			&m.VsDebuffed, &m.VsEvaded, &m.VsHighHP, &m.VsHighAtk,
+		); err != nil {
+			return unit, err
+		}
+		unit.Skills = append(unit.Skills, skill)
+	}
+	rows.Close()
+
+	for i := range unit.Skills {
+		if unit.Skills[i].Actions, err = readActions(
+			db, unit.Skills[i].ID,
+		); err != nil {
+			return unit, err
+		}
+	}
+
+	return unit, nil
+}
+
+// readActions loads the actions of a skill, in execution order,
+// with their params decoded.
+func readActions(db *sql.DB, skillID int) ([]battle.Action, error) {
+	var actions []battle.Action
+	var action battle.Action
+
+	rows, err := db.Query(`SELECT hero_action_possible.name,
+	hero_action_possible.type, hero_action_possible.params,
+	hero_action_allowed.execution_order, hero_action_allowed.chance
+	FROM hero_action_allowed INNER JOIN hero_action_possible ON
+	hero_action_possible.id = hero_action_allowed.hero_action_id
+	WHERE hero_action_allowed.hero_skill_id = $1
+	ORDER BY hero_action_allowed.execution_order, hero_action_allowed.id`,
+		skillID)
+	if err != nil {
+		return actions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var params []byte
+		if err = rows.Scan(&action.Name, &action.Type, &params,
+			&action.Order, &action.Chance); err != nil {
+			return actions, err
+		}
+
+		if action.Params, err = battle.DecodeAction(
+			action.Type, params,
+		); err != nil {
+			return actions, errors.New("Hero action " + action.Name +
+				": " + err.Error())
+		}
+		actions = append(actions, action)
+	}
+
+	return actions, nil
+}
+
+// readMatrix loads the element advantage matrix.
+func readMatrix(db *sql.DB) (battle.Matrix, error) {
+	matrix := make(battle.Matrix)
+
+	rows, err := db.Query(`SELECT attacker_element, defender_element,
+	damage, hit_chance FROM element_advantage`)
+	if err != nil {
+		return matrix, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pair battle.ElementPair
+		var advantage battle.Advantage
+
+		if err = rows.Scan(&pair.Attacker, &pair.Defender,
+			&advantage.Damage, &advantage.HitChance); err != nil {
+			return matrix, err
+		}
+		matrix[pair] = advantage
+	}
+
+	return matrix, nil
+}
@@ -3,6 +3,8 @@ package methods
 
 import (
 	"errors"
+	"strconv"
+	"strings"
 
 	"github.com/axkeyz/gacha-api/config"
 	"github.com/axkeyz/gacha-api/internal/utils"
@@ -13,41 +15,96 @@ import (
 //
 // This is directly related to all in-game currency & resources
 //
+// A MaxBalance of 0 means that the currency has no balance cap.
+// Currencies with SplitPaid keep separate paid (bought) and free
+// (granted) sub-balances, spent in the order set by SpendPriority.
+// Currencies read with a Locale have their description in that
+// locale (see Translation).
+//
 // This is directly mapped to the currency table.
 //===============================================================//
 type Currency struct {
-	ID          int    `json:",omitempty"`
-	Name        string `json:",omitempty"`
-	URL         string `json:",omitempty"`
-	Description string `json:",omitempty"`
-	IsActive    bool   `json:",omitempty"`
-	CreatedAt   string `json:",omitempty"`
-	UpdatedAt   string `json:",omitempty"`
+	ID            int    `query:"id" json:",omitempty"`
+	Name          string `query:"name" json:",omitempty"`
+	URL           string `json:",omitempty"`
+	Description   string `json:",omitempty"`
+	MaxBalance    int    `json:",omitempty"`
+	SplitPaid     bool   `json:",omitempty"`
+	SpendPriority string `json:",omitempty"`
+	IsActive      bool   `json:",omitempty"`
+	CreatedAt     string `json:",omitempty"`
+	UpdatedAt     string `json:",omitempty"`
+	Locale        string `query:"locale" json:",omitempty"`
+	Pagination
 }
 
 // Currency.Create creates a new Currency in the database given
 // parameters in the *Currency struct.
-func (currency *Currency) Create() {
-	if utils.HasNoEmptyParams(
+func (currency *Currency) Create() error {
+	if !utils.HasNoEmptyParams(
 		[]string{currency.Name, currency.URL, currency.Description},
 	) {
-		// Setup database
-		db := config.SetupDB()
-		defer db.Close()
+		return errors.New("Missing required parameters")
+	} else if err := currency.validate(); err != nil {
+		return err
+	}
 
-		// Setup query
-		q := `INSERT into currency (name, url, description, is_active)
-		VALUES ($1, $2, $3, $4);`
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
 
-		db.Exec(q, currency.Name, currency.URL,
-			currency.Description, currency.IsActive,
-		)
-	}
+	// Setup query
+	q := `INSERT into currency (name, url, description, is_active,
+	max_balance, split_paid, spend_priority) VALUES ($1, $2, $3, $4,
+	NULLIF($5, 0), $6, $7) RETURNING id;`
+
+	return db.QueryRow(q, currency.Name, currency.URL,
+		currency.Description, currency.IsActive, currency.MaxBalance,
+		currency.SplitPaid, currency.SpendPriority,
+	).Scan(&currency.ID)
 }
 
 // Currency.Read reads all Currency in the database given
 // parameters in the *Currency struct.
-func (currency *Currency) Read() {
+func (filter *Currency) Read() ([]Currency, error) {
+	var currencies []Currency
+	var currency Currency
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	// Setup query
+	main := `SELECT id, name, url, description, COALESCE(max_balance, 0),
+	split_paid, spend_priority, COALESCE(is_active, false), created_at,
+	updated_at FROM currency`
+	where, args := filter.Filter()
+	sort := filter.Pagination.Query()
+
+	if rows, err := db.Query(main+where+sort, args...); err != nil {
+		return currencies, err
+	} else {
+		for rows.Next() {
+			// Save data to pointer
+			err = rows.Scan(&currency.ID, &currency.Name, &currency.URL,
+				&currency.Description, &currency.MaxBalance,
+				&currency.SplitPaid, &currency.SpendPriority,
+				&currency.IsActive, &currency.CreatedAt, &currency.UpdatedAt)
+
+			if err != nil {
+				// Display error if rows.Scan causes an error
+				return currencies, err
+			}
+
+			currencies = append(currencies, currency)
+		}
+	}
+
+	if filter.Locale != "" {
+		// Replace descriptions with their translations
+		return currencies, localiseCurrencies(db, currencies, filter.Locale)
+	}
+	return currencies, nil
 }
 
 // Currency.Update updates a Currency in the database given
@@ -57,15 +114,22 @@ func (currency *Currency) Update() error {
 	if utils.HasNoEmptyParams(
 		[]string{currency.Name, currency.URL, currency.Description},
 	) {
+		if err := currency.validate(); err != nil {
+			return err
+		}
+
 		// Setup database & query
 		db := config.SetupDB()
 		defer db.Close()
 
 		if _, err := db.Exec(
-			`UPDATE currency SET name = $1, url = $2, 
-			description = $3, is_active = $4 WHERE id = $2`,
+			`UPDATE currency SET name = $1, url = $2,
+			description = $3, is_active = $4, max_balance = NULLIF($5, 0),
+			split_paid = $6, spend_priority = $7,
+			updated_at = CURRENT_TIMESTAMP WHERE id = $8`,
 			currency.Name, currency.URL, currency.Description,
-			currency.IsActive, currency.ID,
+			currency.IsActive, currency.MaxBalance, currency.SplitPaid,
+			currency.SpendPriority, currency.ID,
 		); err == nil {
 			// Return nothing
 			return nil
@@ -102,24 +166,99 @@ func (currency *Currency) Deactivate() error {
 	}
 }
 
+// Currency.validate checks the balance rules of a Currency and
+// defaults its spend priority to free-first.
+func (currency *Currency) validate() error {
+	if currency.SpendPriority == "" {
+		currency.SpendPriority = SpendFreeFirst
+	}
+
+	if currency.MaxBalance < 0 {
+		return errors.New("Max balance cannot be negative")
+	} else if currency.SpendPriority != SpendFreeFirst &&
+		currency.SpendPriority != SpendPaidFirst {
+		return errors.New("Spend priority must be free or paid")
+	}
+
+	return nil
+}
+
+// Currency.Filter generates a WHERE query string & its arguments
+// given the filter parameters.
+func (filter *Currency) Filter() (string, []interface{}) {
+	var items []string
+	var args []interface{}
+
+	if filter.Name != "" {
+		args = append(args, filter.Name)
+		items = append(items, "lower(name) LIKE lower('%' || $"+
+			strconv.Itoa(len(args))+" || '%')")
+	}
+
+	if filter.ID != 0 {
+		args = append(args, filter.ID)
+		items = append(items, "id = $"+strconv.Itoa(len(args)))
+	}
+
+	if len(items) > 0 {
+		return " WHERE " + strings.Join(items, " AND "), args
+	} else {
+		return "", args
+	}
+}
+
 //============================= Currency ===========================//
 // Player Currency is the currency owned by the player.
 //
 // This is directly related to a player's in-game currency & resources.
+// Balances should only be changed through the ledger (see ledger.go)
+// so that every change is recorded as a PlayerTransaction.
 //
 // This is directly mapped to the currency table.
 //===============================================================//
 type PlayerCurrency struct {
 	PlayerID   int      `json:",omitempty"`
 	Player     Player   `json:",omitempty"`
-	CurrencyID int      `json:",omitempty"`
+	CurrencyID int      `query:"currency_id" json:",omitempty"`
 	Currency   Currency `json:",omitempty"`
 	Amount     int      `json:",omitempty"`
+	PaidAmount int      `json:",omitempty"`
 }
 
-// PlayerCurrency.Read reads all PlayerCurrency in the database given
-// parameters in the *Currency struct.
-func (currency *PlayerCurrency) Read() {
+// PlayerCurrency.Read reads all PlayerCurrency (balances) of the
+// player filter.PlayerID, or only filter.CurrencyID, if set.
+func (filter *PlayerCurrency) Read() ([]PlayerCurrency, error) {
+	var balances []PlayerCurrency
+	var balance PlayerCurrency
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	// Setup query
+	rows, err := db.Query(`SELECT player_id, currency_id, currency.name,
+	amount, paid_amount FROM player_currency INNER JOIN currency ON
+	currency.id = player_currency.currency_id WHERE player_id = $1 AND
+	($2 = 0 OR currency_id = $2) ORDER BY currency_id`,
+		filter.PlayerID, filter.CurrencyID)
+	if err != nil {
+		return balances, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		// Save data to pointer
+		err = rows.Scan(&balance.PlayerID, &balance.CurrencyID,
+			&balance.Currency.Name, &balance.Amount, &balance.PaidAmount)
+
+		if err != nil {
+			// Display error if rows.Scan causes an error
+			return balances, err
+		}
+
+		balances = append(balances, balance)
+	}
+	return balances, nil
 }
 
 // PlayerCurrency.Update updates a PlayerCurrency in the database given
@@ -132,12 +271,24 @@ func (currency *PlayerCurrency) Update() {
 func (currency *PlayerCurrency) Delete() {
 }
 
-type PlayerTransaction struct {
-	ID         int      `json:",omitempty"`
-	PlayerID   int      `json:",omitempty"`
-	Player     Player   `json:",omitempty"`
-	CurrencyID int      `json:",omitempty"`
-	Currency   Currency `json:",omitempty"`
-	Change     int      `json:",omitempty"`
-	CreatedAt  string   `json:",omitempty"`
+//========================= CURRENCY LOT =========================//
+// PlayerCurrencyLot is a single grant of currency to a player.
+//
+// Every grant creates a lot, which may expire and may be paid for.
+// Spending consumes lots by the currency's spend priority and then
+// the lots that expire first (FIFO). Expired lots are removed from
+// the balance by ExpireCurrencyLots.
+//
+// This is directly mapped to the player_currency_lot table.
+//================================================================//
+type PlayerCurrencyLot struct {
+	ID            int    `json:",omitempty"`
+	PlayerID      int    `json:",omitempty"`
+	CurrencyID    int    `json:",omitempty"`
+	TransactionID int    `json:",omitempty"`
+	Amount        int    `json:",omitempty"`
+	Remaining     int    `json:",omitempty"`
+	IsPaid        bool   `json:",omitempty"`
+	ExpiresAt     string `json:",omitempty"`
+	CreatedAt     string `json:",omitempty"`
 }
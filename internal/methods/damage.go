@@ -0,0 +1,232 @@
+// damage.go contains the element advantage matrix and the damage
+// calculator used to balance skills.
+package methods
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/axkeyz/gacha-api/config"
+	"github.com/axkeyz/gacha-api/internal/battle"
+)
+
+//====================== ELEMENT ADVANTAGE =======================//
+// ElementAdvantage is the advantage of an attacking element over a
+// defending element (see battle.Advantage). Pairs of elements
+// without an advantage are neutral.
+//
+// This is directly mapped to the element_advantage table.
+//================================================================//
+type ElementAdvantage struct {
+	AttackerElement HeroElement `json:",omitempty"`
+	DefenderElement HeroElement `json:",omitempty"`
+	battle.Advantage
+	UpdatedAt string `json:",omitempty"`
+}
+
+// ElementAdvantage.Read returns the element advantage matrix.
+func (filter *ElementAdvantage) Read() ([]ElementAdvantage, error) {
+	var matrix []ElementAdvantage
+	var advantage ElementAdvantage
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT attacker_element, defender_element,
+	damage, hit_chance, updated_at FROM element_advantage
+	ORDER BY attacker_element, defender_element`)
+	if err != nil {
+		return matrix, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&advantage.AttackerElement,
+			&advantage.DefenderElement, &advantage.Damage,
+			&advantage.HitChance, &advantage.UpdatedAt); err != nil {
+			return matrix, err
+		}
+		matrix = append(matrix, advantage)
+	}
+
+	return matrix, nil
+}
+
+// ElementAdvantage.Save creates or replaces the advantage of an
+// attacking element over a defending element.
+func (advantage *ElementAdvantage) Save() error {
+	if advantage.Damage < 0 {
+		return errors.New("Damage multiplier cannot be negative")
+	} else if advantage.HitChance < -100 || advantage.HitChance > 100 {
+		return errors.New("Hit chance bonus must be between -100 and 100")
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	return db.QueryRow(`INSERT INTO element_advantage (attacker_element,
+	defender_element, damage, hit_chance) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (attacker_element, defender_element) DO UPDATE SET
+	damage = $3, hit_chance = $4, updated_at = CURRENT_TIMESTAMP
+	RETURNING updated_at`, advantage.AttackerElement,
+		advantage.DefenderElement, advantage.Damage, advantage.HitChance,
+	).Scan(&advantage.UpdatedAt)
+}
+
+// readAdvantage returns the advantage of an attacking element over
+// a defending element, which is neutral if there is none.
+func readAdvantage(db *sql.DB, attacker, defender HeroElement) (
+	battle.Advantage, error,
+) {
+	advantage := battle.Neutral
+
+	err := db.QueryRow(`SELECT damage, hit_chance FROM element_advantage
+	WHERE attacker_element = $1 AND defender_element = $2`,
+		attacker, defender,
+	).Scan(&advantage.Damage, &advantage.HitChance)
+	if err == sql.ErrNoRows {
+		return battle.Neutral, nil
+	}
+
+	return advantage, err
+}
+
+//======================= DAMAGE REQUEST ========================//
+// DamageRequest is a use of an attacking hero's skill against a
+// defending hero, to calculate its damage.
+//
+// Heroes use their base stats, or the stats of one of their summons
+// if a summon is given. HealthPercent is the defender's remaining
+// health (100 if not given).
+//================================================================//
+type DamageRequest struct {
+	AttackerID       int     `query:"attacker_id" json:",omitempty"`
+	AttackerSummonID int     `query:"attacker_summon_id" json:",omitempty"`
+	SkillID          int     `query:"skill_id" json:",omitempty"`
+	DefenderID       int     `query:"defender_id" json:",omitempty"`
+	DefenderSummonID int     `query:"defender_summon_id" json:",omitempty"`
+	HealthPercent    float64 `query:"health_percent" json:",omitempty"`
+	Debuffed         bool    `query:"debuffed" json:",omitempty"`
+	Evaded           bool    `query:"evaded" json:",omitempty"`
+}
+
+// DamageCalculation is the damage of a DamageRequest, with the
+// stats, multiplier & advantage it was calculated from.
+type DamageCalculation struct {
+	DamageRequest
+	Attacker   Combatant           `json:",omitempty"`
+	Defender   Combatant           `json:",omitempty"`
+	Multiplier HeroSkillMultiplier `json:",omitempty"`
+	Advantage  battle.Advantage    `json:",omitempty"`
+	Damage     battle.DamageReport `json:",omitempty"`
+}
+
+// Combatant is a hero in a damage calculation or battle, with the
+// stats it fights with.
+type Combatant struct {
+	HeroID   int          `json:",omitempty"`
+	SummonID int          `json:",omitempty"`
+	Name     string       `json:",omitempty"`
+	Element  HeroElement  `json:",omitempty"`
+	Stats    battle.Stats `json:",omitempty"`
+}
+
+// DamageRequest.Calculate calculates the damage of the attacker's
+// skill against the defender.
+func (request *DamageRequest) Calculate() (DamageCalculation, error) {
+	calculation := DamageCalculation{DamageRequest: *request}
+	if calculation.HealthPercent == 0 {
+		calculation.HealthPercent = 100
+	}
+
+	if request.SkillID == 0 {
+		return calculation, errors.New("Skill ID cannot be empty")
+	} else if calculation.HealthPercent < 0 ||
+		calculation.HealthPercent > 100 {
+		return calculation, errors.New("Health percent must be between 0 and 100")
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	var err error
+	if calculation.Attacker, err = readCombatant(
+		db, request.AttackerID, request.AttackerSummonID,
+	); err != nil {
+		return calculation, err
+	}
+	if calculation.Defender, err = readCombatant(
+		db, request.DefenderID, request.DefenderSummonID,
+	); err != nil {
+		return calculation, err
+	}
+
+	calculation.Multiplier = HeroSkillMultiplier{
+		HeroSkillID: request.SkillID,
+		HeroID:      calculation.Attacker.HeroID,
+	}
+	if err = calculation.Multiplier.read(db); err != nil {
+		return calculation, err
+	}
+
+	if calculation.Advantage, err = readAdvantage(
+		db, calculation.Attacker.Element, calculation.Defender.Element,
+	); err != nil {
+		return calculation, err
+	}
+
+	calculation.Damage = battle.Damage(
+		calculation.Attacker.Stats,
+		battle.Target{
+			Stats:         calculation.Defender.Stats,
+			HealthPercent: calculation.HealthPercent,
+			Debuffed:      request.Debuffed,
+			Evaded:        request.Evaded,
+		},
+		calculation.Multiplier.Multiplier,
+		calculation.Advantage,
+	)
+
+	return calculation, nil
+}
+
+// readCombatant loads a hero with the stats of the given summon, or
+// its base stats if there is no summon.
+func readCombatant(db *sql.DB, heroID, summonID int) (Combatant, error) {
+	combatant := Combatant{HeroID: heroID, SummonID: summonID}
+	stats := &combatant.Stats
+
+	var err error
+	if summonID != 0 {
+		err = db.QueryRow(`SELECT hero.id, hero.name, hero.element,
+		attack, crit_chance, crit_damage, hit_chance, effectiveness, health,
+		defence, evasion, resistance FROM summon
+		INNER JOIN hero ON hero.id = summon.hero_id
+		INNER JOIN summon_stats ON summon_stats.summon_id = summon.id
+		WHERE summon.id = $1 AND (summon.hero_id = $2 OR $2 = 0)`,
+			summonID, heroID,
+		).Scan(&combatant.HeroID, &combatant.Name, &combatant.Element,
+			&stats.Attack, &stats.CritChance, &stats.CritDamage,
+			&stats.HitChance, &stats.Effectiveness, &stats.Health,
+			&stats.Defence, &stats.Evasion, &stats.Resistance)
+	} else {
+		err = db.QueryRow(`SELECT hero.id, hero.name, hero.element,
+		attack, crit_chance, crit_damage, hit_chance, effectiveness, health,
+		defence, evasion, resistance FROM hero
+		INNER JOIN hero_base_stat ON hero_base_stat.hero_id = hero.id
+		WHERE hero.id = $1`, heroID,
+		).Scan(&combatant.HeroID, &combatant.Name, &combatant.Element,
+			&stats.Attack, &stats.CritChance, &stats.CritDamage,
+			&stats.HitChance, &stats.Effectiveness, &stats.Health,
+			&stats.Defence, &stats.Evasion, &stats.Resistance)
+	}
+
+	if err == sql.ErrNoRows {
+		return combatant, errors.New("Hero or summon stats not found")
+	}
+
+	return combatant, err
+}
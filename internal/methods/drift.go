@@ -0,0 +1,154 @@
+// drift.go contains the monitoring of live summon outcomes against
+// the configured rates of their banners.
+package methods
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/axkeyz/gacha-api/config"
+	"github.com/axkeyz/gacha-api/internal/gacha"
+)
+
+// Settings of the drift check: the rolling windows (in hours) that
+// are tested, the p-value below which a window raises an alert, and
+// the fewest pulls a window needs to be tested.
+var (
+	DriftWindows  = []int{1, 24, 168}
+	DriftAlpha    = 0.001
+	DriftMinPulls = 100
+)
+
+//========================= DRIFT ALERT ==========================//
+// DriftAlert is raised when the rarities pulled from a banner within
+// a rolling window are unlikely under its configured rates.
+//
+// Expected counts are summed from the chance of each pull given its
+// pity count, so they include pity. Only summons pulled from the
+// banner's current loot table are counted. PValue is the p-value of
+// a chi-square test of the observed against the expected counts.
+//================================================================//
+type DriftAlert struct {
+	HeroBannerID int             `json:",omitempty"`
+	Banner       string          `json:",omitempty"`
+	WindowHours  int             `json:",omitempty"`
+	Pulls        int             `json:",omitempty"`
+	Observed     map[int]int     `json:",omitempty"`
+	Expected     map[int]float64 `json:",omitempty"`
+	ChiSquare    float64         `json:",omitempty"`
+	DF           int             `json:",omitempty"`
+	PValue       float64         `json:",omitempty"`
+	CheckedAt    string          `json:",omitempty"`
+}
+
+// CheckSummonDrift tests every active banner over each of the drift
+// windows, and returns an alert for each window that has drifted.
+func CheckSummonDrift() ([]DriftAlert, error) {
+	var alerts []DriftAlert
+
+	filter := HeroBanner{IsActive: true}
+	banners, err := filter.Read()
+	if err != nil {
+		return alerts, err
+	}
+
+	for _, banner := range banners {
+		table := banner.LootTable()
+		if table.Check() != nil {
+			continue
+		}
+
+		for _, hours := range DriftWindows {
+			alert, drifted, err := banner.checkDrift(&table, hours)
+			if err != nil {
+				return alerts, err
+			} else if drifted {
+				alerts = append(alerts, alert)
+			}
+		}
+	}
+
+	return alerts, nil
+}
+
+// SendDriftAlerts posts alerts as JSON to a webhook URL.
+func SendDriftAlerts(url string, alerts []DriftAlert) error {
+	body, err := json.Marshal(alerts)
+	if err != nil {
+		return err
+	}
+
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return errors.New("Drift webhook returned " + resp.Status)
+	}
+
+	return nil
+}
+
+// HeroBanner.checkDrift tests the pulls of a banner within the last
+// hours against its loot table.
+func (banner *HeroBanner) checkDrift(table *gacha.LootTable,
+	hours int) (DriftAlert, bool, error) {
+	var pityCount, rarity, count int
+
+	alert := DriftAlert{
+		HeroBannerID: banner.ID,
+		Banner:       banner.Name,
+		WindowHours:  hours,
+		Observed:     map[int]int{},
+		Expected:     map[int]float64{},
+		CheckedAt:    time.Now().UTC().Format(time.RFC3339),
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT pity_count, rarity, COUNT(*) FROM summon
+	WHERE hero_banner_id = $1 AND source = $2 AND table_hash = $3 AND
+	deleted_at IS NULL AND created_at > CURRENT_TIMESTAMP - $4::interval
+	GROUP BY pity_count, rarity`, banner.ID, SummonPull, table.Hash(),
+		strconv.Itoa(hours)+" hours")
+	if err != nil {
+		return alert, false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&pityCount, &rarity, &count); err != nil {
+			return alert, false, err
+		}
+
+		alert.Pulls += count
+		alert.Observed[rarity] += count
+		for i, chance := range table.Chances(pityCount) {
+			alert.Expected[table.Tiers[i].Rarity] += chance * float64(count)
+		}
+	}
+
+	if err = rows.Err(); err != nil || alert.Pulls < DriftMinPulls {
+		return alert, false, err
+	}
+
+	// Test the tiers in table order
+	var observed []int
+	var expected []float64
+	for _, tier := range table.Tiers {
+		observed = append(observed, alert.Observed[tier.Rarity])
+		expected = append(expected, alert.Expected[tier.Rarity])
+	}
+
+	alert.ChiSquare, alert.DF, alert.PValue = gacha.ChiSquare(observed, expected)
+	return alert, alert.DF > 0 && alert.PValue < DriftAlpha, nil
+}
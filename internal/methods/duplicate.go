@@ -0,0 +1,182 @@
+// duplicate.go contains the duplicate policies, which decide what
+// happens when a player summons a hero they already own.
+package methods
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/axkeyz/gacha-api/config"
+)
+
+// Duplicate policies
+const (
+	DuplicateKeep       = "keep"
+	DuplicateLimitBreak = "limit-break"
+	DuplicateConvert    = "convert"
+)
+
+// Transaction reason of currency converted from duplicate summons
+const TransactionDuplicate = "duplicate"
+
+//======================= DUPLICATE POLICY =======================//
+// DuplicatePolicy is what happens to a summon of a hero that the
+// player already owns, by the hero's rarity.
+//
+// Duplicates are kept as a separate copy, raise the limit break of
+// the copy the player owns (up to MaxLimitBreak), or are converted
+// into Amount of CurrencyID. Limit breaks past the max are converted
+// if the policy has a currency, and kept otherwise. Conversions that
+// would take the player past the currency's balance cap are kept
+// too, rather than failing the summon. Rarities without a policy
+// keep duplicates.
+//
+// This is directly mapped to the duplicate_policy table.
+//================================================================//
+type DuplicatePolicy struct {
+	Rarity        int    `query:"rarity" json:",omitempty"`
+	Policy        string `json:",omitempty"`
+	MaxLimitBreak int    `json:",omitempty"`
+	CurrencyID    int    `json:",omitempty"`
+	Amount        int    `json:",omitempty"`
+	UpdatedAt     string `json:",omitempty"`
+}
+
+// DuplicatePolicy.Read returns the duplicate policies of every
+// rarity, or of the given rarity.
+func (filter *DuplicatePolicy) Read() ([]DuplicatePolicy, error) {
+	var policies []DuplicatePolicy
+	var policy DuplicatePolicy
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT rarity, policy, max_limit_break,
+	COALESCE(currency_id, 0), amount, updated_at FROM duplicate_policy
+	WHERE rarity = $1 OR $1 = 0 ORDER BY rarity`, filter.Rarity)
+	if err != nil {
+		return policies, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&policy.Rarity, &policy.Policy,
+			&policy.MaxLimitBreak, &policy.CurrencyID, &policy.Amount,
+			&policy.UpdatedAt); err != nil {
+			return policies, err
+		}
+		policies = append(policies, policy)
+	}
+
+	return policies, nil
+}
+
+// DuplicatePolicy.Save creates or replaces the duplicate policy of a
+// rarity.
+func (policy *DuplicatePolicy) Save() error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	return db.QueryRow(`INSERT INTO duplicate_policy (rarity, policy,
+	max_limit_break, currency_id, amount) VALUES ($1, $2, $3,
+	NULLIF($4, 0), $5) ON CONFLICT (rarity) DO UPDATE SET policy = $2,
+	max_limit_break = $3, currency_id = NULLIF($4, 0), amount = $5,
+	updated_at = CURRENT_TIMESTAMP RETURNING updated_at`, policy.Rarity,
+		policy.Policy, policy.MaxLimitBreak, policy.CurrencyID, policy.Amount,
+	).Scan(&policy.UpdatedAt)
+}
+
+// DuplicatePolicy.validate checks the required fields of a
+// DuplicatePolicy.
+func (policy *DuplicatePolicy) validate() error {
+	if policy.Rarity <= 0 {
+		return errors.New("Rarity must be positive")
+	} else if policy.Policy != DuplicateKeep &&
+		policy.Policy != DuplicateLimitBreak &&
+		policy.Policy != DuplicateConvert {
+		return errors.New("Policy must be keep, limit-break or convert")
+	} else if policy.MaxLimitBreak < 0 || policy.Amount < 0 {
+		return errors.New("Max limit break and amount cannot be negative")
+	} else if policy.Policy == DuplicateLimitBreak && policy.MaxLimitBreak == 0 {
+		return errors.New("Limit break policy needs a max limit break")
+	} else if policy.Policy == DuplicateConvert &&
+		(policy.CurrencyID == 0 || policy.Amount == 0) {
+		return errors.New("Convert policy needs a currency and amount")
+	} else if (policy.CurrencyID == 0) != (policy.Amount == 0) {
+		return errors.New("Currency and amount must be set together")
+	}
+
+	return nil
+}
+
+// Summon.applyDuplicate applies the duplicate policy of the summon's
+// rarity if the player already owns its hero, and records the policy
+// that was applied.
+func (summon *Summon) applyDuplicate(tx *sql.Tx) error {
+	var policy DuplicatePolicy
+	var owned Summon
+
+	// Get the oldest copy of the hero the player owns
+	err := tx.QueryRow(`SELECT id, limit_break FROM summon WHERE
+	player_id = $1 AND hero_id = $2 AND is_active AND deleted_at IS NULL
+	ORDER BY id LIMIT 1 FOR UPDATE`, summon.PlayerID, summon.HeroID,
+	).Scan(&owned.ID, &owned.LimitBreak)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	summon.DuplicateOfID = owned.ID
+	summon.DuplicatePolicy = DuplicateKeep
+
+	err = tx.QueryRow(`SELECT policy, max_limit_break,
+	COALESCE(currency_id, 0), amount FROM duplicate_policy WHERE
+	rarity = $1`, summon.Rarity,
+	).Scan(&policy.Policy, &policy.MaxLimitBreak, &policy.CurrencyID,
+		&policy.Amount)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	// Limit breaks past the max fall back to conversion
+	if policy.Policy == DuplicateLimitBreak {
+		if owned.LimitBreak < policy.MaxLimitBreak {
+			summon.DuplicatePolicy = DuplicateLimitBreak
+
+			_, err = tx.Exec(`UPDATE summon SET limit_break = limit_break + 1
+				WHERE id = $1`, owned.ID)
+			return err
+		} else if policy.CurrencyID == 0 {
+			return nil
+		}
+	} else if policy.Policy != DuplicateConvert {
+		return nil
+	}
+
+	currency := PlayerCurrency{
+		PlayerID:   summon.PlayerID,
+		CurrencyID: policy.CurrencyID,
+	}
+	transaction, err := currency.grant(
+		tx, policy.Amount, false, TransactionDuplicate, "",
+	)
+	if err == ErrBalanceCap {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	summon.DuplicatePolicy = DuplicateConvert
+	summon.DuplicateTransactionID = transaction.ID
+
+	return nil
+}
@@ -0,0 +1,547 @@
+// exchange.go contains CRUD functions for currency exchanges, and
+// executes exchanges through the player currency ledger.
+package methods
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/axkeyz/gacha-api/config"
+)
+
+// Transaction reason of currency debited & credited by an exchange
+const TransactionExchange = "exchange"
+
+var (
+	ErrExchangeInactive = errors.New("Exchange is not active")
+	ErrExchangeLimit    = errors.New("Exchange limit reached")
+)
+
+//=========================== EXCHANGE ===========================//
+// Exchange is a recipe that converts a bundle of input currencies
+// into a bundle of output currencies, such as 100 hero shards into
+// 1 summon ticket. Exchanges can also take duplicate heroes as
+// inputs (HeroInputs), such as a duplicate hero into 10 shards; the
+// oldest copy of each hero is always kept by the player.
+//
+// Players may execute an exchange at most LimitCount times every
+// LimitHours (or ever, if LimitHours is 0). A LimitCount of 0 means
+// that the exchange is unlimited. Exchanges can only be executed
+// while active and between RunStart & RunEnd, if set.
+//
+// This is directly mapped to the exchange, exchange_item &
+// exchange_hero tables.
+//================================================================//
+type Exchange struct {
+	ID          int            `query:"id" json:",omitempty"`
+	Name        string         `query:"name" json:",omitempty"`
+	Description string         `json:",omitempty"`
+	LimitCount  int            `json:",omitempty"`
+	LimitHours  int            `json:",omitempty"`
+	RunStart    string         `json:",omitempty"`
+	RunEnd      string         `json:",omitempty"`
+	IsActive    bool           `query:"is_active" json:",omitempty"`
+	Inputs      []ExchangeItem `json:",omitempty"`
+	HeroInputs  []ExchangeHero `json:",omitempty"`
+	Outputs     []ExchangeItem `json:",omitempty"`
+	CreatedAt   string         `json:",omitempty"`
+	UpdatedAt   string         `json:",omitempty"`
+	Pagination
+}
+
+// ExchangeItem is the amount of a single currency that is paid
+// into (input) or received from (output) an exchange.
+type ExchangeItem struct {
+	CurrencyID int      `json:",omitempty"`
+	Currency   Currency `json:",omitempty"`
+	Amount     int      `json:",omitempty"`
+}
+
+// ExchangeHero is the number of duplicate copies of a single hero
+// that are paid into an exchange.
+type ExchangeHero struct {
+	HeroID   int    `json:",omitempty"`
+	HeroName string `json:",omitempty"`
+	Amount   int    `json:",omitempty"`
+}
+
+// Exchange.Create creates a new Exchange and its items in the
+// database.
+func (exchange *Exchange) Create() error {
+	if err := exchange.validate(); err != nil {
+		return err
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = tx.QueryRow(`INSERT INTO exchange (name, description,
+	limit_count, limit_hours, run_start, run_end, is_active) VALUES
+	($1, $2, NULLIF($3, 0), NULLIF($4, 0), NULLIF($5, '')::timestamp,
+	NULLIF($6, '')::timestamp, $7) RETURNING id`, exchange.Name,
+		exchange.Description, exchange.LimitCount, exchange.LimitHours,
+		exchange.RunStart, exchange.RunEnd, exchange.IsActive,
+	).Scan(&exchange.ID); err != nil {
+		return err
+	}
+
+	if err = exchange.saveItems(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Exchange.Read returns all Exchanges (with their items) that fit
+// the given filter *Exchange.
+func (filter *Exchange) Read() ([]Exchange, error) {
+	var exchanges []Exchange
+	var exchange Exchange
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	// Setup query
+	main := `SELECT id, name, description, COALESCE(limit_count, 0),
+	COALESCE(limit_hours, 0), COALESCE(run_start::text, ''),
+	COALESCE(run_end::text, ''), is_active, created_at, updated_at
+	FROM exchange`
+	where, args := filter.Filter()
+	sort := filter.Pagination.Query()
+
+	rows, err := db.Query(main+where+sort, args...)
+	if err != nil {
+		return exchanges, err
+	}
+
+	for rows.Next() {
+		// Save data to pointer
+		err = rows.Scan(&exchange.ID, &exchange.Name, &exchange.Description,
+			&exchange.LimitCount, &exchange.LimitHours, &exchange.RunStart,
+			&exchange.RunEnd, &exchange.IsActive, &exchange.CreatedAt,
+			&exchange.UpdatedAt)
+
+		if err != nil {
+			// Display error if rows.Scan causes an error
+			rows.Close()
+			return exchanges, err
+		}
+
+		exchanges = append(exchanges, exchange)
+	}
+	rows.Close()
+
+	// Get the items of each exchange
+	for i := range exchanges {
+		if err = exchanges[i].readItems(db); err != nil {
+			return exchanges, err
+		}
+	}
+
+	return exchanges, nil
+}
+
+// Exchange.Update updates an Exchange given its ID, replacing all of
+// its items.
+func (exchange *Exchange) Update() error {
+	if exchange.ID == 0 {
+		return errors.New("Exchange ID cannot be empty")
+	} else if err := exchange.validate(); err != nil {
+		return err
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.Exec(`UPDATE exchange SET name = $1, description = $2,
+		limit_count = NULLIF($3, 0), limit_hours = NULLIF($4, 0),
+		run_start = NULLIF($5, '')::timestamp,
+		run_end = NULLIF($6, '')::timestamp, is_active = $7,
+		updated_at = CURRENT_TIMESTAMP WHERE id = $8`, exchange.Name,
+		exchange.Description, exchange.LimitCount, exchange.LimitHours,
+		exchange.RunStart, exchange.RunEnd, exchange.IsActive, exchange.ID,
+	); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`DELETE FROM exchange_item WHERE exchange_id = $1`,
+		exchange.ID); err != nil {
+		return err
+	} else if _, err = tx.Exec(`DELETE FROM exchange_hero WHERE
+		exchange_id = $1`, exchange.ID); err != nil {
+		return err
+	}
+
+	if err = exchange.saveItems(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Exchange.Filter generates a WHERE query string & its arguments
+// given the filter parameters.
+func (filter *Exchange) Filter() (string, []interface{}) {
+	var items []string
+	var args []interface{}
+
+	if filter.Name != "" {
+		args = append(args, filter.Name)
+		items = append(items, "lower(name) LIKE lower('%' || $"+
+			strconv.Itoa(len(args))+" || '%')")
+	}
+
+	if filter.ID != 0 {
+		args = append(args, filter.ID)
+		items = append(items, "id = $"+strconv.Itoa(len(args)))
+	}
+
+	if filter.IsActive {
+		items = append(items, "is_active = true")
+	}
+
+	if len(items) > 0 {
+		return " WHERE " + strings.Join(items, " AND "), args
+	} else {
+		return "", args
+	}
+}
+
+// Exchange.validate checks that an Exchange has a name and at least
+// one input & output, each with a positive amount.
+func (exchange *Exchange) validate() error {
+	if exchange.Name == "" || exchange.Description == "" {
+		return errors.New("Required params cannot be empty")
+	} else if len(exchange.Inputs)+len(exchange.HeroInputs) == 0 ||
+		len(exchange.Outputs) == 0 {
+		return errors.New("Exchange needs inputs and outputs")
+	} else if exchange.LimitCount < 0 || exchange.LimitHours < 0 {
+		return errors.New("Exchange limits cannot be negative")
+	}
+
+	for _, items := range [][]ExchangeItem{exchange.Inputs, exchange.Outputs} {
+		seen := map[int]bool{}
+		for _, item := range items {
+			if item.Amount <= 0 {
+				return errors.New("Exchange amounts must be positive")
+			} else if seen[item.CurrencyID] {
+				return errors.New("Exchange currency is repeated")
+			}
+			seen[item.CurrencyID] = true
+		}
+	}
+
+	seen := map[int]bool{}
+	for _, hero := range exchange.HeroInputs {
+		if hero.Amount <= 0 {
+			return errors.New("Exchange amounts must be positive")
+		} else if seen[hero.HeroID] {
+			return errors.New("Exchange hero is repeated")
+		}
+		seen[hero.HeroID] = true
+	}
+
+	return nil
+}
+
+// Exchange.saveItems inserts the inputs & outputs of an Exchange.
+func (exchange *Exchange) saveItems(tx *sql.Tx) error {
+	q := `INSERT INTO exchange_item (exchange_id, currency_id, is_input,
+	amount) VALUES ($1, $2, $3, $4)`
+
+	for _, item := range exchange.Inputs {
+		if _, err := tx.Exec(q, exchange.ID, item.CurrencyID, true,
+			item.Amount); err != nil {
+			return err
+		}
+	}
+
+	for _, item := range exchange.Outputs {
+		if _, err := tx.Exec(q, exchange.ID, item.CurrencyID, false,
+			item.Amount); err != nil {
+			return err
+		}
+	}
+
+	for _, hero := range exchange.HeroInputs {
+		if _, err := tx.Exec(`INSERT INTO exchange_hero (exchange_id,
+		hero_id, amount) VALUES ($1, $2, $3)`, exchange.ID, hero.HeroID,
+			hero.Amount); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Exchange.readItems loads the inputs, hero inputs & outputs of an
+// Exchange.
+func (exchange *Exchange) readItems(db *sql.DB) error {
+	var item ExchangeItem
+	var hero ExchangeHero
+	var isInput bool
+
+	exchange.Inputs, exchange.HeroInputs, exchange.Outputs = nil, nil, nil
+
+	rows, err := db.Query(`SELECT exchange_item.currency_id, currency.name,
+	exchange_item.is_input, exchange_item.amount FROM exchange_item INNER
+	JOIN currency ON currency.id = exchange_item.currency_id WHERE
+	exchange_id = $1 ORDER BY currency_id`, exchange.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&item.CurrencyID, &item.Currency.Name, &isInput,
+			&item.Amount); err != nil {
+			return err
+		}
+
+		if isInput {
+			exchange.Inputs = append(exchange.Inputs, item)
+		} else {
+			exchange.Outputs = append(exchange.Outputs, item)
+		}
+	}
+	rows.Close()
+
+	rows, err = db.Query(`SELECT exchange_hero.hero_id, hero.name,
+	exchange_hero.amount FROM exchange_hero INNER JOIN hero ON hero.id =
+	exchange_hero.hero_id WHERE exchange_id = $1 ORDER BY hero_id`,
+		exchange.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&hero.HeroID, &hero.HeroName,
+			&hero.Amount); err != nil {
+			return err
+		}
+		exchange.HeroInputs = append(exchange.HeroInputs, hero)
+	}
+
+	return nil
+}
+
+//======================= PLAYER EXCHANGE ========================//
+// PlayerExchange is a single execution of an Exchange by a player.
+//
+// Every debit & credit of an execution is recorded as a
+// PlayerTransaction that points back to the PlayerExchange, and
+// every duplicate hero paid in is a soft deleted Summon that points
+// back to it.
+//
+// This is directly mapped to the player_exchange table.
+//================================================================//
+type PlayerExchange struct {
+	ID           int                 `json:",omitempty"`
+	ExchangeID   int                 `json:",omitempty"`
+	Exchange     Exchange            `json:",omitempty"`
+	PlayerID     int                 `json:",omitempty"`
+	Quantity     int                 `json:",omitempty"`
+	Transactions []PlayerTransaction `json:",omitempty"`
+	SummonIDs    []int               `json:",omitempty"`
+	CreatedAt    string              `json:",omitempty"`
+}
+
+// PlayerExchange.Execute debits the exchange's inputs and credits
+// its outputs (each multiplied by Quantity) in a single database
+// transaction.
+func (execution *PlayerExchange) Execute() error {
+	if execution.PlayerID == 0 || execution.ExchangeID == 0 {
+		return errors.New("Player ID and Exchange ID cannot be empty")
+	} else if execution.Quantity <= 0 {
+		execution.Quantity = 1
+	}
+
+	// Get the exchange
+	filter := Exchange{ID: execution.ExchangeID}
+	exchanges, err := filter.Read()
+	if err != nil {
+		return err
+	} else if len(exchanges) == 0 {
+		return errors.New("Exchange not found")
+	}
+	execution.Exchange = exchanges[0]
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = execution.check(tx); err != nil {
+		return err
+	}
+
+	if err = tx.QueryRow(`INSERT INTO player_exchange (exchange_id,
+	player_id, quantity) VALUES ($1, $2, $3) RETURNING id, created_at`,
+		execution.ExchangeID, execution.PlayerID, execution.Quantity,
+	).Scan(&execution.ID, &execution.CreatedAt); err != nil {
+		return err
+	}
+
+	// Debit inputs, then credit outputs
+	for _, item := range execution.Exchange.Inputs {
+		currency := PlayerCurrency{
+			PlayerID:   execution.PlayerID,
+			CurrencyID: item.CurrencyID,
+		}
+
+		transaction, err := currency.spend(tx, item.Amount*execution.Quantity,
+			TransactionExchange)
+		if err != nil {
+			return err
+		}
+
+		if err = execution.link(tx, &transaction); err != nil {
+			return err
+		}
+	}
+
+	for _, hero := range execution.Exchange.HeroInputs {
+		if err = execution.consume(tx, hero); err != nil {
+			return err
+		}
+	}
+
+	for _, item := range execution.Exchange.Outputs {
+		currency := PlayerCurrency{
+			PlayerID:   execution.PlayerID,
+			CurrencyID: item.CurrencyID,
+		}
+
+		transaction, err := currency.grant(tx, item.Amount*execution.Quantity,
+			false, TransactionExchange, "")
+		if err != nil {
+			return err
+		}
+
+		if err = execution.link(tx, &transaction); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// PlayerExchange.check checks that the exchange is running and
+// that the player is within its limit. It serialises executions of
+// the same exchange by the same player until tx ends.
+func (execution *PlayerExchange) check(tx *sql.Tx) error {
+	var running bool
+	var used int
+	exchange := execution.Exchange
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1, $2)`,
+		execution.ExchangeID, execution.PlayerID); err != nil {
+		return err
+	}
+
+	if err := tx.QueryRow(`SELECT is_active AND COALESCE(run_start <=
+	CURRENT_TIMESTAMP, true) AND COALESCE(run_end > CURRENT_TIMESTAMP, true)
+	FROM exchange WHERE id = $1`, execution.ExchangeID).Scan(&running); err != nil {
+		return err
+	} else if !running {
+		return ErrExchangeInactive
+	}
+
+	if exchange.LimitCount == 0 {
+		return nil
+	}
+
+	if err := tx.QueryRow(`SELECT COALESCE(SUM(quantity), 0) FROM
+	player_exchange WHERE player_id = $1 AND exchange_id = $2 AND ($3 = 0
+	OR created_at > CURRENT_TIMESTAMP - make_interval(hours => $3))`,
+		execution.PlayerID, execution.ExchangeID, exchange.LimitHours,
+	).Scan(&used); err != nil {
+		return err
+	}
+
+	if used+execution.Quantity > exchange.LimitCount {
+		return ErrExchangeLimit
+	}
+
+	return nil
+}
+
+// PlayerExchange.link points a PlayerTransaction back to the
+// PlayerExchange that caused it.
+func (execution *PlayerExchange) link(tx *sql.Tx, transaction *PlayerTransaction) error {
+	if _, err := tx.Exec(`UPDATE player_transaction SET player_exchange_id
+		= $1 WHERE id = $2`, execution.ID, transaction.ID); err != nil {
+		return err
+	}
+
+	execution.Transactions = append(execution.Transactions, *transaction)
+	return nil
+}
+
+// PlayerExchange.consume soft deletes the duplicate copies of a hero
+// that the player pays into the exchange, newest first, and
+// unequips their rings. The oldest copy, which holds the hero's
+// limit breaks, is never paid in.
+func (execution *PlayerExchange) consume(tx *sql.Tx, hero ExchangeHero) error {
+	var copies []int
+
+	rows, err := tx.Query(`SELECT id FROM summon WHERE player_id = $1 AND
+	hero_id = $2 AND is_active AND deleted_at IS NULL ORDER BY id
+	FOR UPDATE`, execution.PlayerID, hero.HeroID)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var id int
+		if err = rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		copies = append(copies, id)
+	}
+	rows.Close()
+
+	needed := hero.Amount * execution.Quantity
+	if len(copies)-1 < needed {
+		return errors.New("Not enough duplicates of hero " + hero.HeroName)
+	}
+	paid := copies[len(copies)-needed:]
+
+	if _, err = tx.Exec(`UPDATE summon SET deleted_at = CURRENT_TIMESTAMP,
+		is_active = false, player_exchange_id = $1 WHERE id = ANY($2)`,
+		execution.ID, pq.Array(paid)); err != nil {
+		return err
+	} else if _, err = tx.Exec(`UPDATE player_ring SET summon_id = NULL
+		WHERE summon_id = ANY($1) AND deleted_at IS NULL`,
+		pq.Array(paid)); err != nil {
+		return err
+	}
+
+	execution.SummonIDs = append(execution.SummonIDs, paid...)
+	return nil
+}
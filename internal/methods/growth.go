@@ -0,0 +1,328 @@
+// growth.go contains the growth curves of heroes, levelling up
+// summons, and checking that summon stats match their curves.
+package methods
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/axkeyz/gacha-api/config"
+	"github.com/axkeyz/gacha-api/internal/battle"
+)
+
+//========================= GROWTH CURVE =========================//
+// GrowthCurve is the growth curve (see battle.Curve) of either every
+// hero of a Rarity, or of a single hero. A hero's own curve takes
+// precedence over its rarity's, and heroes without either do not
+// grow.
+//
+// This is directly mapped to the growth_curve table.
+//================================================================//
+type GrowthCurve struct {
+	ID     int        `query:"id" json:",omitempty"`
+	Rarity HeroRarity `query:"rarity" json:",omitempty"`
+	HeroID int        `query:"hero_id" json:",omitempty"`
+	battle.Curve
+	UpdatedAt string `json:",omitempty"`
+}
+
+// GrowthCurve.Read returns the growth curves that fit the filter.
+func (filter *GrowthCurve) Read() ([]GrowthCurve, error) {
+	var curves []GrowthCurve
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, COALESCE(rarity, 0),
+	COALESCE(hero_id, 0), type, rate, points, max_level, updated_at FROM
+	growth_curve WHERE (id = $1 OR $1 = 0) AND (rarity = $2 OR $2 = 0) AND
+	(hero_id = $3 OR $3 = 0) ORDER BY rarity, hero_id`, filter.ID,
+		filter.Rarity, filter.HeroID)
+	if err != nil {
+		return curves, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var curve GrowthCurve
+		var points []byte
+
+		if err = rows.Scan(&curve.ID, &curve.Rarity, &curve.HeroID,
+			&curve.Type, &curve.Rate, &points, &curve.MaxLevel,
+			&curve.UpdatedAt); err != nil {
+			return curves, err
+		} else if err = json.Unmarshal(points, &curve.Points); err != nil {
+			return curves, err
+		}
+
+		curves = append(curves, curve)
+	}
+
+	return curves, nil
+}
+
+// GrowthCurve.Save creates or replaces the growth curve of a rarity
+// or a hero.
+func (curve *GrowthCurve) Save() error {
+	if (curve.Rarity == 0) == (curve.HeroID == 0) {
+		return errors.New("Growth curves need either a rarity or a hero")
+	} else if err := curve.Check(); err != nil {
+		return err
+	}
+
+	if curve.Type != battle.GrowthPiecewise {
+		curve.Points = nil
+	}
+	points, _ := json.Marshal(curve.Points)
+	if curve.Points == nil {
+		points = []byte(`[]`)
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	conflict := "rarity"
+	if curve.HeroID != 0 {
+		conflict = "hero_id"
+	}
+
+	return db.QueryRow(`INSERT INTO growth_curve (rarity, hero_id, type,
+	rate, points, max_level) VALUES (NULLIF($1, 0), NULLIF($2, 0), $3, $4,
+	$5, $6) ON CONFLICT (`+conflict+`) DO UPDATE SET type = $3, rate = $4,
+	points = $5, max_level = $6, updated_at = CURRENT_TIMESTAMP
+	RETURNING id, updated_at`, curve.Rarity, curve.HeroID, curve.Type,
+		curve.Rate, string(points), curve.MaxLevel,
+	).Scan(&curve.ID, &curve.UpdatedAt)
+}
+
+// GrowthCurve.Delete deletes a GrowthCurve given its ID.
+func (curve *GrowthCurve) Delete() error {
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM growth_curve WHERE id = $1`,
+		curve.ID)
+	if err != nil {
+		return err
+	} else if count, _ := result.RowsAffected(); count == 0 {
+		return errors.New("Growth curve not found")
+	}
+
+	return nil
+}
+
+// readCurves loads every growth curve, by hero & by rarity.
+func readCurves(q querier) (map[int]battle.Curve, map[HeroRarity]battle.Curve, error) {
+	heroes := make(map[int]battle.Curve)
+	rarities := make(map[HeroRarity]battle.Curve)
+
+	rows, err := q.Query(`SELECT COALESCE(rarity, 0), COALESCE(hero_id, 0),
+	type, rate, points, max_level FROM growth_curve`)
+	if err != nil {
+		return heroes, rarities, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var curve GrowthCurve
+		var points []byte
+
+		if err = rows.Scan(&curve.Rarity, &curve.HeroID, &curve.Type,
+			&curve.Rate, &points, &curve.MaxLevel); err != nil {
+			return heroes, rarities, err
+		} else if err = json.Unmarshal(points, &curve.Points); err != nil {
+			return heroes, rarities, err
+		}
+
+		if curve.HeroID != 0 {
+			heroes[curve.HeroID] = curve.Curve
+		} else {
+			rarities[curve.Rarity] = curve.Curve
+		}
+	}
+
+	return heroes, rarities, nil
+}
+
+// readCurve returns the growth curve of a hero.
+func readCurve(tx *sql.Tx, heroID int, rarity HeroRarity) (battle.Curve, error) {
+	curve := battle.Flat
+	var points []byte
+
+	err := tx.QueryRow(`SELECT type, rate, points, max_level FROM
+	growth_curve WHERE hero_id = $1 OR rarity = $2
+	ORDER BY hero_id IS NULL LIMIT 1`, heroID, rarity,
+	).Scan(&curve.Type, &curve.Rate, &points, &curve.MaxLevel)
+	if err == sql.ErrNoRows {
+		return battle.Flat, nil
+	} else if err != nil {
+		return curve, err
+	}
+
+	err = json.Unmarshal(points, &curve.Points)
+	return curve, err
+}
+
+//=========================== LEVEL UP ===========================//
+// SummonLevelUp raises a player's summon to Level, and stores its
+// stats at that level on its growth curve.
+//================================================================//
+type SummonLevelUp struct {
+	PlayerID int    `json:",omitempty"`
+	SummonID int    `json:",omitempty"`
+	Level    int    `json:",omitempty"`
+	Summon   Summon `json:",omitempty"`
+}
+
+// SummonLevelUp.Execute levels up the summon.
+func (request *SummonLevelUp) Execute() error {
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	summon := &request.Summon
+	var rarity HeroRarity
+	var base battle.Stats
+
+	err = tx.QueryRow(`SELECT summon.id, summon.player_id, summon.hero_id,
+	COALESCE(summon.level, 1), hero.rarity, attack, crit_chance,
+	crit_damage, hit_chance, effectiveness, health, defence, evasion,
+	resistance FROM summon INNER JOIN hero ON hero.id = summon.hero_id
+	INNER JOIN hero_base_stat ON hero_base_stat.hero_id = summon.hero_id
+	WHERE summon.id = $1 AND summon.player_id = $2 AND summon.is_active AND
+	summon.deleted_at IS NULL FOR UPDATE OF summon`, request.SummonID,
+		request.PlayerID,
+	).Scan(&summon.ID, &summon.PlayerID, &summon.HeroID, &summon.Level,
+		&rarity, &base.Attack, &base.CritChance, &base.CritDamage,
+		&base.HitChance, &base.Effectiveness, &base.Health, &base.Defence,
+		&base.Evasion, &base.Resistance)
+	if err == sql.ErrNoRows {
+		return errors.New("Summon not found")
+	} else if err != nil {
+		return err
+	}
+
+	curve, err := readCurve(tx, summon.HeroID, rarity)
+	if err != nil {
+		return err
+	}
+
+	if request.Level <= summon.Level {
+		return errors.New("Summons can only be levelled up")
+	} else if request.Level > curve.MaxLevel {
+		return errors.New("Level is above the max level of the summon")
+	}
+
+	summon.Level = request.Level
+	summon.Stats = SummonStats(curve.Apply(base, summon.Level))
+	stats := summon.Stats
+
+	if _, err = tx.Exec(`UPDATE summon SET level = $1 WHERE id = $2`,
+		summon.Level, summon.ID); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`UPDATE summon_stats SET attack = $1,
+	crit_chance = $2, crit_damage = $3, hit_chance = $4,
+	effectiveness = $5, health = $6, defence = $7, evasion = $8,
+	resistance = $9 WHERE summon_id = $10`, stats.Attack, stats.CritChance,
+		stats.CritDamage, stats.HitChance, stats.Effectiveness, stats.Health,
+		stats.Defence, stats.Evasion, stats.Resistance, summon.ID,
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+//========================== STAT DRIFT ==========================//
+// StatDrift is a summon whose stored stats (Actual) differ from its
+// stats recalculated from its hero's base stats & growth curve at
+// its level (Expected).
+//================================================================//
+type StatDrift struct {
+	SummonID int         `json:",omitempty"`
+	PlayerID int         `json:",omitempty"`
+	HeroID   int         `json:",omitempty"`
+	Level    int         `json:",omitempty"`
+	Expected SummonStats `json:",omitempty"`
+	Actual   SummonStats `json:",omitempty"`
+}
+
+// CheckSummonStats recalculates the stats of every active summon,
+// and returns the summons whose stored stats have drifted.
+func CheckSummonStats() ([]StatDrift, error) {
+	var drifts []StatDrift
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	heroes, rarities, err := readCurves(db)
+	if err != nil {
+		return drifts, err
+	}
+
+	rows, err := db.Query(`SELECT summon.id, summon.player_id,
+	summon.hero_id, COALESCE(summon.level, 1), hero.rarity,
+	hero_base_stat.attack, hero_base_stat.crit_chance,
+	hero_base_stat.crit_damage, hero_base_stat.hit_chance,
+	hero_base_stat.effectiveness, hero_base_stat.health,
+	hero_base_stat.defence, hero_base_stat.evasion,
+	hero_base_stat.resistance, summon_stats.attack,
+	summon_stats.crit_chance, summon_stats.crit_damage,
+	summon_stats.hit_chance, summon_stats.effectiveness,
+	summon_stats.health, summon_stats.defence, summon_stats.evasion,
+	summon_stats.resistance FROM summon
+	INNER JOIN hero ON hero.id = summon.hero_id
+	INNER JOIN hero_base_stat ON hero_base_stat.hero_id = summon.hero_id
+	INNER JOIN summon_stats ON summon_stats.summon_id = summon.id
+	WHERE summon.is_active AND summon.deleted_at IS NULL
+	ORDER BY summon.id`)
+	if err != nil {
+		return drifts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var drift StatDrift
+		var rarity HeroRarity
+		var base battle.Stats
+		actual := &drift.Actual
+
+		if err = rows.Scan(&drift.SummonID, &drift.PlayerID, &drift.HeroID,
+			&drift.Level, &rarity, &base.Attack, &base.CritChance,
+			&base.CritDamage, &base.HitChance, &base.Effectiveness,
+			&base.Health, &base.Defence, &base.Evasion, &base.Resistance,
+			&actual.Attack, &actual.CritChance, &actual.CritDamage,
+			&actual.HitChance, &actual.Effectiveness, &actual.Health,
+			&actual.Defence, &actual.Evasion, &actual.Resistance,
+		); err != nil {
+			return drifts, err
+		}
+
+		curve, ok := heroes[drift.HeroID]
+		if !ok {
+			if curve, ok = rarities[rarity]; !ok {
+				curve = battle.Flat
+			}
+		}
+
+		drift.Expected = SummonStats(curve.Apply(base, drift.Level))
+		if drift.Expected != drift.Actual {
+			drifts = append(drifts, drift)
+		}
+	}
+
+	return drifts, nil
+}
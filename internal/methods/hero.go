@@ -0,0 +1,553 @@
+// hero.go contains structs & CRUD functions that relate to
+// summonable heroes.
+package methods
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/axkeyz/gacha-api/config"
+	"github.com/axkeyz/gacha-api/internal/battle"
+)
+
+// HeroClass is the class (combat role) of a hero. Classes are
+// managed as reference data (see reference.go); the constants are
+// the classes that are seeded.
+type HeroClass int
+
+// Hero classes
+const (
+	ClassWarrior HeroClass = iota + 1
+	ClassKnight
+	ClassRanger
+	ClassMage
+	ClassHealer
+	ClassAssassin
+)
+
+// HeroRarity is the rarity of a hero, which is also the rarity tier
+// it is pulled from on a banner. The constants are the rarities that
+// are seeded.
+type HeroRarity int
+
+// Hero rarities
+const (
+	RarityCommon HeroRarity = iota + 1
+	RarityUncommon
+	RarityRare
+	RarityEpic
+	RarityLegendary
+)
+
+// HeroElement is the element of a hero. The constants are the
+// elements that are seeded.
+type HeroElement int
+
+// Hero elements
+const (
+	ElementFire HeroElement = iota + 1
+	ElementWater
+	ElementEarth
+	ElementWind
+	ElementLight
+	ElementDark
+)
+
+// Names of the seeded classes, rarities & elements
+var (
+	classNames   = []string{"warrior", "knight", "ranger", "mage", "healer", "assassin"}
+	rarityNames  = []string{"common", "uncommon", "rare", "epic", "legendary"}
+	elementNames = []string{"fire", "water", "earth", "wind", "light", "dark"}
+)
+
+// HeroClass.Valid returns whether a class is set. Whether it exists
+// is checked against the reference data when a hero is saved.
+func (class HeroClass) Valid() bool { return class > 0 }
+
+// HeroRarity.Valid returns whether a rarity is set.
+func (rarity HeroRarity) Valid() bool { return rarity > 0 }
+
+// HeroElement.Valid returns whether an element is set.
+func (element HeroElement) Valid() bool { return element > 0 }
+
+// HeroClass.String returns the name of a seeded class, or "class N"
+// for any other.
+func (class HeroClass) String() string {
+	return enumName(classNames, "class", int(class))
+}
+
+// HeroRarity.String returns the name of a seeded rarity, or
+// "rarity N" for any other.
+func (rarity HeroRarity) String() string {
+	return enumName(rarityNames, "rarity", int(rarity))
+}
+
+// HeroElement.String returns the name of a seeded element, or
+// "element N" for any other.
+func (element HeroElement) String() string {
+	return enumName(elementNames, "element", int(element))
+}
+
+// enumName returns the name of the value of a 1-based enum, or the
+// kind & value for values without one.
+func enumName(names []string, kind string, value int) string {
+	if value >= 1 && value <= len(names) {
+		return names[value-1]
+	}
+	return kind + " " + strconv.Itoa(value)
+}
+
+//============================= HERO =============================//
+// Hero is a summonable hero of the game.
+//
+// A hero is saved as a single aggregate: the hero, its background
+// (lore), its base stats and its skills are always written together
+// in one database transaction. Heroes read with a Locale have their
+// name, lore & skill descriptions in that locale (see Translation).
+//
+// This is directly mapped to the hero, hero_background,
+// hero_base_stat & hero_skill tables.
+//================================================================//
+type Hero struct {
+	ID         int            `query:"id" json:",omitempty"`
+	Name       string         `query:"name" json:",omitempty"`
+	Class      HeroClass      `query:"class" json:",omitempty"`
+	Rarity     HeroRarity     `query:"rarity" json:",omitempty"`
+	Element    HeroElement    `query:"element" json:",omitempty"`
+	IsActive   bool           `query:"is_active" json:",omitempty"`
+	Background HeroBackground `json:",omitempty"`
+	Stats      HeroBaseStat   `json:",omitempty"`
+	Skills     []HeroSkill    `json:",omitempty"`
+	CreatedAt  string         `json:",omitempty"`
+	UpdatedAt  string         `json:",omitempty"`
+	Locale     string         `query:"locale" json:",omitempty"`
+	Pagination
+}
+
+// HeroBackground is the lore of a hero.
+type HeroBackground struct {
+	ShortDescription string `json:",omitempty"`
+	LongDescription  string `json:",omitempty"`
+}
+
+// HeroBaseStat are the stats that a hero's summons start with.
+type HeroBaseStat = SummonStats
+
+// HeroSkill is a skill of a hero. Skills that are not active skills
+// are passive. Multipliers & actions are saved with their skill if
+// given. A hero update leaves the multipliers & actions of other
+// skills as they are, but a published revision is the whole hero:
+// its skills without a multiplier have none, and its skills without
+// actions carry none out.
+type HeroSkill struct {
+	ID            int                `json:",omitempty"`
+	HeroID        int                `json:",omitempty"`
+	Icon          string             `json:",omitempty"`
+	Description   string             `json:",omitempty"`
+	IsActiveSkill bool               `json:",omitempty"`
+	Multiplier    *battle.Multiplier `json:",omitempty"`
+	Actions       []SkillAction      `json:",omitempty"`
+}
+
+// ErrHeroLive is returned when a live (active) hero is changed other
+// than by publishing a revision.
+var ErrHeroLive = errors.New("Live heroes can only be changed by publishing a revision")
+
+// Hero.Create creates a new Hero with its background, base stats &
+// skills in the database. New heroes are not live until a revision
+// of them is published.
+func (hero *Hero) Create() error {
+	if hero.IsActive {
+		return ErrHeroLive
+	} else if err := hero.validate(); err != nil {
+		return err
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = hero.checkReferences(tx); err != nil {
+		return err
+	}
+
+	if err = tx.QueryRow(`INSERT INTO hero (name, class, rarity, element,
+	is_active) VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at,
+	updated_at`, hero.Name, hero.Class, hero.Rarity, hero.Element,
+		hero.IsActive,
+	).Scan(&hero.ID, &hero.CreatedAt, &hero.UpdatedAt); err != nil {
+		return err
+	}
+
+	if err = hero.saveDetails(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Hero.Read returns a list of heroes that fit the filter, with
+// their background, base stats & skills.
+func (filter *Hero) Read() ([]Hero, error) {
+	var heroes []Hero
+	var hero Hero
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	main := `SELECT hero.id, COALESCE(hero.name, ''), hero.class,
+	hero.rarity, hero.element, hero.is_active,
+	COALESCE(hero_background.short_description, ''),
+	COALESCE(hero_background.long_description, ''),
+	COALESCE(attack, 0), COALESCE(crit_chance, 0),
+	COALESCE(crit_damage, 0), COALESCE(hit_chance, 0),
+	COALESCE(effectiveness, 0), COALESCE(health, 0), COALESCE(defence, 0),
+	COALESCE(evasion, 0), COALESCE(resistance, 0), hero.created_at,
+	hero.updated_at FROM hero
+	LEFT JOIN hero_background ON hero_background.hero_id = hero.id
+	LEFT JOIN hero_base_stat ON hero_base_stat.hero_id = hero.id`
+	where, args := filter.Filter()
+	sort := filter.Pagination.Query()
+	if sort == "" {
+		sort = " ORDER BY hero.id"
+	}
+
+	rows, err := db.Query(main+where+sort, args...)
+	if err != nil {
+		return heroes, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		stats := &hero.Stats
+		if err = rows.Scan(&hero.ID, &hero.Name, &hero.Class, &hero.Rarity,
+			&hero.Element, &hero.IsActive, &hero.Background.ShortDescription,
+			&hero.Background.LongDescription, &stats.Attack,
+			&stats.CritChance, &stats.CritDamage, &stats.HitChance,
+			&stats.Effectiveness, &stats.Health, &stats.Defence,
+			&stats.Evasion, &stats.Resistance, &hero.CreatedAt,
+			&hero.UpdatedAt); err != nil {
+			return heroes, err
+		}
+
+		heroes = append(heroes, hero)
+	}
+	rows.Close()
+
+	for i := range heroes {
+		if err = heroes[i].readSkills(db); err != nil {
+			return heroes, err
+		} else if err = heroes[i].readSkillActions(db); err != nil {
+			return heroes, err
+		}
+	}
+
+	if filter.Locale != "" {
+		err = localiseHeroes(db, heroes, filter.Locale)
+	}
+
+	return heroes, err
+}
+
+// Hero.Update updates a Hero given its ID, with its background, base
+// stats & skills. Skills without an ID are added, and skills that
+// are left out are removed. Live heroes cannot be updated.
+func (hero *Hero) Update() error {
+	if hero.ID == 0 {
+		return errors.New("Hero ID cannot be empty")
+	} else if hero.IsActive {
+		return ErrHeroLive
+	} else if err := hero.validate(); err != nil {
+		return err
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = hero.checkReferences(tx); err != nil {
+		return err
+	}
+
+	if err = checkHeroDraft(tx, hero.ID); err != nil {
+		return err
+	}
+
+	if err = tx.QueryRow(`UPDATE hero SET name = $1, class = $2,
+	rarity = $3, element = $4, is_active = $5, updated_at =
+	CURRENT_TIMESTAMP WHERE id = $6 RETURNING created_at, updated_at`,
+		hero.Name, hero.Class, hero.Rarity, hero.Element, hero.IsActive,
+		hero.ID,
+	).Scan(&hero.CreatedAt, &hero.UpdatedAt); err == sql.ErrNoRows {
+		return errors.New("Hero not found")
+	} else if err != nil {
+		return err
+	}
+
+	if err = hero.saveDetails(tx); err != nil {
+		return err
+	} else if err = republishHeroOdds(tx, hero.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Hero.Filter generates a WHERE query string & its arguments given
+// the filter parameters.
+func (filter *Hero) Filter() (string, []interface{}) {
+	var items []string
+	var args []interface{}
+
+	if filter.Name != "" {
+		args = append(args, filter.Name)
+		items = append(items, "lower(hero.name) LIKE lower('%' || $"+
+			strconv.Itoa(len(args))+" || '%')")
+	}
+
+	if filter.ID != 0 {
+		args = append(args, filter.ID)
+		items = append(items, "hero.id = $"+strconv.Itoa(len(args)))
+	}
+
+	if filter.Class != 0 {
+		args = append(args, filter.Class)
+		items = append(items, "hero.class = $"+strconv.Itoa(len(args)))
+	}
+
+	if filter.Rarity != 0 {
+		args = append(args, filter.Rarity)
+		items = append(items, "hero.rarity = $"+strconv.Itoa(len(args)))
+	}
+
+	if filter.Element != 0 {
+		args = append(args, filter.Element)
+		items = append(items, "hero.element = $"+strconv.Itoa(len(args)))
+	}
+
+	if filter.IsActive {
+		items = append(items, "hero.is_active = true")
+	}
+
+	if len(items) > 0 {
+		return " WHERE " + strings.Join(items, " AND "), args
+	} else {
+		return "", args
+	}
+}
+
+// Hero.validate checks the required fields of a Hero.
+func (hero *Hero) validate() error {
+	if hero.Name == "" || len(hero.Name) > 15 {
+		return errors.New("Hero name must be 1 to 15 characters")
+	} else if !hero.Class.Valid() || !hero.Rarity.Valid() ||
+		!hero.Element.Valid() {
+		return errors.New("Hero class, rarity and element must be set")
+	} else if hero.Background.ShortDescription == "" ||
+		hero.Background.LongDescription == "" {
+		return errors.New("Hero background cannot be empty")
+	}
+
+	for _, skill := range hero.Skills {
+		if skill.Icon == "" || skill.Description == "" {
+			return errors.New("Hero skills need an icon and description")
+		} else if err := validateSkillActions(skill.Actions); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Hero.saveDetails creates or replaces the background & base stats
+// of a Hero, and saves its skills.
+func (hero *Hero) saveDetails(tx *sql.Tx) error {
+	if _, err := tx.Exec(`INSERT INTO hero_background (hero_id,
+		short_description, long_description) VALUES ($1, $2, $3)
+		ON CONFLICT (hero_id) DO UPDATE SET short_description = $2,
+		long_description = $3`, hero.ID, hero.Background.ShortDescription,
+		hero.Background.LongDescription); err != nil {
+		return err
+	}
+
+	stats := hero.Stats
+	if _, err := tx.Exec(`INSERT INTO hero_base_stat (hero_id, attack,
+		crit_chance, crit_damage, hit_chance, effectiveness, health,
+		defence, evasion, resistance) VALUES ($1, $2, $3, $4, $5, $6, $7,
+		$8, $9, $10) ON CONFLICT (hero_id) DO UPDATE SET attack = $2,
+		crit_chance = $3, crit_damage = $4, hit_chance = $5,
+		effectiveness = $6, health = $7, defence = $8, evasion = $9,
+		resistance = $10`, hero.ID, stats.Attack, stats.CritChance,
+		stats.CritDamage, stats.HitChance, stats.Effectiveness,
+		stats.Health, stats.Defence, stats.Evasion, stats.Resistance,
+	); err != nil {
+		return err
+	}
+
+	return hero.saveSkills(tx)
+}
+
+// Hero.saveSkills updates the skills of a Hero that have an ID,
+// inserts the ones that do not, and deletes any other skills of
+// the hero.
+func (hero *Hero) saveSkills(tx *sql.Tx) error {
+	var kept []string
+
+	for i := range hero.Skills {
+		skill := &hero.Skills[i]
+		skill.HeroID = hero.ID
+
+		if skill.ID == 0 {
+			continue
+		}
+
+		result, err := tx.Exec(`UPDATE hero_skill SET icon = $1,
+			description = $2, is_active_skill = $3 WHERE id = $4 AND
+			hero_id = $5`, skill.Icon, skill.Description, skill.IsActiveSkill,
+			skill.ID, hero.ID)
+		if err != nil {
+			return err
+		} else if count, _ := result.RowsAffected(); count == 0 {
+			return errors.New("Hero skill " + strconv.Itoa(skill.ID) +
+				" not found")
+		}
+		kept = append(kept, strconv.Itoa(skill.ID))
+	}
+
+	// Skills that are left out are removed, with their multipliers
+	// & actions
+	if err := deleteSkillMultipliers(
+		tx, hero.ID, strings.Join(kept, ", "),
+	); err != nil {
+		return err
+	} else if err = deleteSkillActions(tx, hero.ID, kept); err != nil {
+		return err
+	}
+
+	remove := `DELETE FROM hero_skill WHERE hero_id = $1`
+	if len(kept) > 0 {
+		remove += ` AND id NOT IN (` + strings.Join(kept, ", ") + `)`
+	}
+	if _, err := tx.Exec(remove, hero.ID); err != nil {
+		return err
+	}
+
+	for i := range hero.Skills {
+		skill := &hero.Skills[i]
+		if skill.ID != 0 {
+			continue
+		}
+
+		if err := tx.QueryRow(`INSERT INTO hero_skill (hero_id, icon,
+		description, is_active_skill) VALUES ($1, $2, $3, $4) RETURNING id`,
+			hero.ID, skill.Icon, skill.Description, skill.IsActiveSkill,
+		).Scan(&skill.ID); err != nil {
+			return err
+		}
+	}
+
+	// Multipliers are saved with their skills
+	for _, skill := range hero.Skills {
+		if skill.Multiplier == nil {
+			continue
+		}
+
+		multiplier := HeroSkillMultiplier{
+			HeroSkillID: skill.ID,
+			HeroID:      hero.ID,
+			Multiplier:  *skill.Multiplier,
+		}
+		if err := multiplier.save(tx); err != nil {
+			return err
+		}
+	}
+
+	// As are actions
+	for _, skill := range hero.Skills {
+		if skill.Actions == nil {
+			continue
+		}
+
+		if err := saveSkillActions(tx, skill.ID, skill.Actions); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Hero.readSkills loads the skills of a Hero, with their
+// multipliers.
+func (hero *Hero) readSkills(q querier) error {
+	hero.Skills = nil
+
+	rows, err := q.Query(`SELECT hero_skill.id, hero_skill.hero_id,
+	hero_skill.icon, hero_skill.description,
+	COALESCE(hero_skill.is_active_skill, false),
+	hero_skill_multiplier.hero_skill_id IS NOT NULL,
+	COALESCE(power, 0), COALESCE(attack, 0), COALESCE(crit_damage, 0),
+	COALESCE(defence, 0), COALESCE(health, 0), COALESCE(percent_health, 0),
+	COALESCE(vs_debuffed, 0), COALESCE(vs_evaded, 0),
+	COALESCE(vs_high_hp, 0), COALESCE(vs_high_atk, 0) FROM hero_skill
+	LEFT JOIN hero_skill_multiplier ON
+	hero_skill_multiplier.hero_skill_id = hero_skill.id
+	WHERE hero_skill.hero_id = $1 ORDER BY hero_skill.id`, hero.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var skill HeroSkill
+		var m battle.Multiplier
+		var hasMultiplier bool
+
+		if err = rows.Scan(&skill.ID, &skill.HeroID, &skill.Icon,
+			&skill.Description, &skill.IsActiveSkill, &hasMultiplier,
+			&m.Power, &m.Attack, &m.CritDamage, &m.Defence, &m.Health,
+			&m.PercentHealth, &m.VsDebuffed, &m.VsEvaded, &m.VsHighHP,
+			&m.VsHighAtk); err != nil {
+			return err
+		}
+		if hasMultiplier {
+			skill.Multiplier = &m
+		}
+
+		hero.Skills = append(hero.Skills, skill)
+	}
+
+	return nil
+}
+
+// checkHeroDraft locks a hero, and returns an error if it does not
+// exist or is live.
+func checkHeroDraft(tx *sql.Tx, heroID int) error {
+	var live bool
+
+	err := tx.QueryRow(`SELECT is_active FROM hero WHERE id = $1
+	FOR UPDATE`, heroID).Scan(&live)
+	if err == sql.ErrNoRows {
+		return errors.New("Hero not found")
+	} else if err != nil {
+		return err
+	} else if live {
+		return ErrHeroLive
+	}
+
+	return nil
+}
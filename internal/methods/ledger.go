@@ -0,0 +1,370 @@
+// ledger.go contains the player currency ledger. Every change to a
+// player's balance goes through here so that it is recorded as a
+// player_transaction.
+package methods
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/axkeyz/gacha-api/config"
+)
+
+// Transaction reasons recorded on player_transaction.reason
+const (
+	TransactionGrant  = "grant"
+	TransactionSpend  = "spend"
+	TransactionExpire = "expire"
+)
+
+// Spend priorities of currencies that split paid & free balances
+const (
+	SpendFreeFirst = "free"
+	SpendPaidFirst = "paid"
+)
+
+var (
+	ErrInsufficientBalance = errors.New("Insufficient currency balance")
+	ErrBalanceCap          = errors.New("Currency balance cap exceeded")
+	ErrNotSplitPaid        = errors.New("Currency does not track paid balances")
+)
+
+// PlayerCurrency.Grant adds amount to the player's balance as a new
+// lot. The lot never expires if expiresAt is empty. Paid lots can
+// only be granted for currencies that split paid & free balances.
+// Lots that have expired, but have not been swept yet, do not count
+// towards the currency's balance cap.
+func (currency *PlayerCurrency) Grant(amount int, paid bool, reason string,
+	expiresAt string) (PlayerTransaction, error) {
+	var transaction PlayerTransaction
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return transaction, err
+	}
+
+	if transaction, err = currency.grant(
+		tx, amount, paid, reason, expiresAt,
+	); err != nil {
+		tx.Rollback()
+		return transaction, err
+	}
+
+	return transaction, tx.Commit()
+}
+
+// PlayerCurrency.Spend removes amount from the player's balance,
+// consuming lots by the currency's spend priority and then the lots
+// that expire first.
+func (currency *PlayerCurrency) Spend(amount int, reason string) (PlayerTransaction, error) {
+	var transaction PlayerTransaction
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return transaction, err
+	}
+
+	if transaction, err = currency.spend(tx, amount, reason); err != nil {
+		tx.Rollback()
+		return transaction, err
+	}
+
+	return transaction, tx.Commit()
+}
+
+// PlayerCurrency.grant performs PlayerCurrency.Grant inside the
+// given database transaction.
+func (currency *PlayerCurrency) grant(tx *sql.Tx, amount int, paid bool,
+	reason string, expiresAt string) (PlayerTransaction, error) {
+	var transaction PlayerTransaction
+	var err error
+
+	if amount <= 0 {
+		return transaction, errors.New("Amount must be positive")
+	}
+
+	if err = currency.lock(tx); err != nil {
+		return transaction, err
+	}
+
+	if paid && !currency.Currency.SplitPaid {
+		return transaction, ErrNotSplitPaid
+	}
+
+	if currency.Currency.MaxBalance != 0 {
+		var expired int
+		if err = tx.QueryRow(`SELECT COALESCE(SUM(remaining), 0) FROM
+		player_currency_lot WHERE player_id = $1 AND currency_id = $2 AND
+		remaining > 0 AND expires_at <= CURRENT_TIMESTAMP`,
+			currency.PlayerID, currency.CurrencyID,
+		).Scan(&expired); err != nil {
+			return transaction, err
+		} else if currency.Amount-expired+amount > currency.Currency.MaxBalance {
+			return transaction, ErrBalanceCap
+		}
+	}
+
+	if paid {
+		transaction, err = currency.record(tx, amount, 0, reason)
+	} else {
+		transaction, err = currency.record(tx, 0, amount, reason)
+	}
+	if err != nil {
+		return transaction, err
+	}
+
+	if _, err = tx.Exec(`INSERT INTO player_currency_lot (player_id,
+		currency_id, transaction_id, amount, remaining, is_paid, expires_at)
+		VALUES ($1, $2, $3, $4, $4, $5, NULLIF($6, '')::timestamp)`,
+		currency.PlayerID, currency.CurrencyID, transaction.ID, amount,
+		paid, expiresAt,
+	); err != nil {
+		return transaction, err
+	}
+
+	return transaction, nil
+}
+
+// PlayerCurrency.spend performs PlayerCurrency.Spend inside the
+// given database transaction.
+func (currency *PlayerCurrency) spend(tx *sql.Tx, amount int,
+	reason string) (PlayerTransaction, error) {
+	var lots []PlayerCurrencyLot
+	var lot PlayerCurrencyLot
+	var spendable, paid, free int
+
+	if amount <= 0 {
+		return PlayerTransaction{}, errors.New("Amount must be positive")
+	}
+
+	if err := currency.lock(tx); err != nil {
+		return PlayerTransaction{}, err
+	}
+
+	// Free lots sort before paid lots unless paid is spent first
+	priority := "is_paid ASC"
+	if currency.Currency.SpendPriority == SpendPaidFirst {
+		priority = "is_paid DESC"
+	}
+
+	// Get live lots, the ones that expire first are spent first
+	rows, err := tx.Query(`SELECT id, remaining, is_paid FROM
+	player_currency_lot WHERE player_id = $1 AND currency_id = $2 AND
+	remaining > 0 AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)
+	ORDER BY `+priority+`, expires_at ASC NULLS LAST, id ASC FOR UPDATE`,
+		currency.PlayerID, currency.CurrencyID)
+	if err != nil {
+		return PlayerTransaction{}, err
+	}
+
+	for rows.Next() {
+		if err = rows.Scan(&lot.ID, &lot.Remaining, &lot.IsPaid); err != nil {
+			rows.Close()
+			return PlayerTransaction{}, err
+		}
+		lots = append(lots, lot)
+		spendable += lot.Remaining
+	}
+	rows.Close()
+
+	if spendable < amount {
+		return PlayerTransaction{}, ErrInsufficientBalance
+	}
+
+	// Consume lots until the amount is paid
+	left := amount
+	for _, lot := range lots {
+		take := lot.Remaining
+		if take > left {
+			take = left
+		}
+
+		if _, err = tx.Exec(`UPDATE player_currency_lot SET remaining =
+			remaining - $1 WHERE id = $2`, take, lot.ID); err != nil {
+			return PlayerTransaction{}, err
+		}
+
+		if lot.IsPaid {
+			paid += take
+		} else {
+			free += take
+		}
+
+		if left -= take; left == 0 {
+			break
+		}
+	}
+
+	return currency.record(tx, -paid, -free, reason)
+}
+
+// PlayerCurrency.lock locks (and creates, if required) the player's
+// balance row, and loads the current amounts and the balance rules
+// of its currency.
+func (currency *PlayerCurrency) lock(tx *sql.Tx) error {
+	if currency.PlayerID == 0 || currency.CurrencyID == 0 {
+		return errors.New("Player ID and Currency ID cannot be empty")
+	}
+
+	if _, err := tx.Exec(`INSERT INTO player_currency (player_id,
+		currency_id, amount) VALUES ($1, $2, 0) ON CONFLICT
+		(player_id, currency_id) DO NOTHING`,
+		currency.PlayerID, currency.CurrencyID,
+	); err != nil {
+		return err
+	}
+
+	return tx.QueryRow(`SELECT player_currency.amount,
+	player_currency.paid_amount, COALESCE(currency.max_balance, 0),
+	currency.split_paid, currency.spend_priority FROM player_currency
+	INNER JOIN currency ON currency.id = player_currency.currency_id
+	WHERE player_id = $1 AND currency_id = $2
+	FOR UPDATE OF player_currency`,
+		currency.PlayerID, currency.CurrencyID,
+	).Scan(&currency.Amount, &currency.PaidAmount,
+		&currency.Currency.MaxBalance, &currency.Currency.SplitPaid,
+		&currency.Currency.SpendPriority)
+}
+
+// PlayerCurrency.record applies the paid & free changes to a locked
+// balance and records them as a PlayerTransaction.
+func (currency *PlayerCurrency) record(tx *sql.Tx, paidChange int,
+	freeChange int, reason string) (PlayerTransaction, error) {
+	transaction := PlayerTransaction{
+		PlayerID:   currency.PlayerID,
+		CurrencyID: currency.CurrencyID,
+		Change:     paidChange + freeChange,
+		PaidChange: paidChange,
+		FreeChange: freeChange,
+		Reason:     reason,
+	}
+
+	if _, err := tx.Exec(`UPDATE player_currency SET amount = amount + $1,
+		paid_amount = paid_amount + $2 WHERE player_id = $3 AND
+		currency_id = $4`, transaction.Change, paidChange,
+		currency.PlayerID, currency.CurrencyID,
+	); err != nil {
+		return transaction, err
+	}
+	currency.Amount += transaction.Change
+	currency.PaidAmount += paidChange
+
+	err := tx.QueryRow(`INSERT INTO player_transaction (player_id,
+	currency_id, change, paid_change, free_change, reason) VALUES
+	($1, $2, $3, $4, $5, $6) RETURNING id, created_at`,
+		currency.PlayerID, currency.CurrencyID, transaction.Change,
+		paidChange, freeChange, reason,
+	).Scan(&transaction.ID, &transaction.CreatedAt)
+
+	return transaction, err
+}
+
+// ExpireCurrencyLots removes every expired lot from its player's
+// balance and logs the expiry as a PlayerTransaction. It returns the
+// number of lots that were expired. A balance that fails to expire
+// does not stop the others, and is expired again on the next run.
+func ExpireCurrencyLots() (int, error) {
+	var balances []PlayerCurrency
+	var balance PlayerCurrency
+	var failed []string
+	expired := 0
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	// Get the balances that hold expired lots
+	rows, err := db.Query(`SELECT DISTINCT player_id, currency_id FROM
+	player_currency_lot WHERE remaining > 0 AND expires_at <=
+	CURRENT_TIMESTAMP`)
+	if err != nil {
+		return expired, err
+	}
+
+	for rows.Next() {
+		if err = rows.Scan(&balance.PlayerID, &balance.CurrencyID); err != nil {
+			rows.Close()
+			return expired, err
+		}
+		balances = append(balances, balance)
+	}
+	rows.Close()
+
+	// Expire each balance in its own transaction
+	for _, balance := range balances {
+		count, err := balance.expire(db)
+		if err != nil {
+			failed = append(failed, "Player "+strconv.Itoa(balance.PlayerID)+
+				" currency "+strconv.Itoa(balance.CurrencyID)+": "+err.Error())
+			continue
+		}
+		expired += count
+	}
+
+	if len(failed) > 0 {
+		return expired, errors.New(strings.Join(failed, "; "))
+	}
+	return expired, nil
+}
+
+// PlayerCurrency.expire expires the lots of a single balance. The
+// balance is locked before its lots, in the same order as spend.
+func (currency *PlayerCurrency) expire(db *sql.DB) (int, error) {
+	var lots []PlayerCurrencyLot
+	var lot PlayerCurrencyLot
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err = currency.lock(tx); err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query(`SELECT id, remaining, is_paid FROM
+	player_currency_lot WHERE player_id = $1 AND currency_id = $2 AND
+	remaining > 0 AND expires_at <= CURRENT_TIMESTAMP ORDER BY id
+	FOR UPDATE`, currency.PlayerID, currency.CurrencyID)
+	if err != nil {
+		return 0, err
+	}
+
+	for rows.Next() {
+		if err = rows.Scan(&lot.ID, &lot.Remaining, &lot.IsPaid); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		lots = append(lots, lot)
+	}
+	rows.Close()
+
+	for _, lot := range lots {
+		if _, err = tx.Exec(`UPDATE player_currency_lot SET remaining = 0
+			WHERE id = $1`, lot.ID); err != nil {
+			return 0, err
+		}
+
+		if lot.IsPaid {
+			_, err = currency.record(tx, -lot.Remaining, 0, TransactionExpire)
+		} else {
+			_, err = currency.record(tx, 0, -lot.Remaining, TransactionExpire)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(lots), tx.Commit()
+}
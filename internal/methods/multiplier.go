@@ -0,0 +1,114 @@
+// multiplier.go contains the stat multipliers of hero skills.
+package methods
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/axkeyz/gacha-api/config"
+	"github.com/axkeyz/gacha-api/internal/battle"
+)
+
+//==================== HERO SKILL MULTIPLIER =====================//
+// HeroSkillMultiplier is how a hero's skill scales with stats (see
+// battle.Multiplier).
+//
+// This is directly mapped to the hero_skill_multiplier table.
+//================================================================//
+type HeroSkillMultiplier struct {
+	HeroSkillID int `json:",omitempty"`
+	HeroID      int `json:",omitempty"`
+	battle.Multiplier
+}
+
+// HeroSkillMultiplier.Read returns the multiplier of a hero's skill.
+func (multiplier *HeroSkillMultiplier) Read() error {
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	return multiplier.read(db)
+}
+
+// HeroSkillMultiplier.Save creates or replaces the multiplier of a
+// hero's skill. Multipliers of live heroes can only be changed by
+// publishing a revision.
+func (multiplier *HeroSkillMultiplier) Save() error {
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = checkHeroDraft(tx, multiplier.HeroID); err != nil {
+		return err
+	} else if err = multiplier.save(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// HeroSkillMultiplier.save creates or replaces the multiplier of a
+// hero's skill.
+func (multiplier *HeroSkillMultiplier) save(tx *sql.Tx) error {
+	m := multiplier.Multiplier
+	if m.Power < 0 || m.Attack < 0 || m.Defence < 0 || m.Health < 0 ||
+		m.PercentHealth < 0 || m.CritDamage < 0 {
+		return errors.New("Multipliers cannot be negative")
+	}
+
+	_, err := tx.Exec(`INSERT INTO hero_skill_multiplier (hero_skill_id,
+	hero_id, power, attack, crit_damage, defence, health, percent_health,
+	vs_debuffed, vs_evaded, vs_high_hp, vs_high_atk) VALUES ($1, $2, $3,
+	$4, $5, $6, $7, $8, $9, $10, $11, $12) ON CONFLICT (hero_skill_id) DO
+	UPDATE SET power = $3, attack = $4, crit_damage = $5, defence = $6,
+	health = $7, percent_health = $8, vs_debuffed = $9, vs_evaded = $10,
+	vs_high_hp = $11, vs_high_atk = $12`, multiplier.HeroSkillID,
+		multiplier.HeroID, m.Power, m.Attack, m.CritDamage, m.Defence,
+		m.Health, m.PercentHealth, m.VsDebuffed, m.VsEvaded, m.VsHighHP,
+		m.VsHighAtk)
+
+	return err
+}
+
+// HeroSkillMultiplier.read loads the multiplier of a hero's skill.
+func (multiplier *HeroSkillMultiplier) read(q querier) error {
+	m := &multiplier.Multiplier
+
+	rows, err := q.Query(`SELECT power, attack, crit_damage, defence,
+	health, percent_health, vs_debuffed, vs_evaded, vs_high_hp,
+	vs_high_atk FROM hero_skill_multiplier WHERE hero_skill_id = $1 AND
+	hero_id = $2`, multiplier.HeroSkillID, multiplier.HeroID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			return err
+		}
+		return errors.New("Hero skill multiplier not found")
+	}
+
+	return rows.Scan(&m.Power, &m.Attack, &m.CritDamage, &m.Defence,
+		&m.Health, &m.PercentHealth, &m.VsDebuffed, &m.VsEvaded,
+		&m.VsHighHP, &m.VsHighAtk)
+}
+
+// deleteSkillMultipliers deletes the multipliers of the skills of a
+// hero that are not kept.
+func deleteSkillMultipliers(tx *sql.Tx, heroID int, kept string) error {
+	remove := `DELETE FROM hero_skill_multiplier WHERE hero_id = $1`
+	if kept != "" {
+		remove += ` AND hero_skill_id NOT IN (` + kept + `)`
+	}
+
+	_, err := tx.Exec(remove, heroID)
+	return err
+}
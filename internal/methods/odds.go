@@ -0,0 +1,168 @@
+// odds.go contains the published odds (drop rates) of hero banners.
+package methods
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/axkeyz/gacha-api/config"
+	"github.com/axkeyz/gacha-api/internal/gacha"
+)
+
+//======================= HERO BANNER ODDS =======================//
+// HeroBannerOdds is a published version of a banner's odds, with
+// the heroes they refer to.
+//
+// The odds are generated from the banner's loot table, the same one
+// summons are pulled from, whenever an enabled banner is saved with
+// a new table, or one of its heroes is saved with a new rarity.
+// TableHash is the hash of that table, which is also stored on every
+// summon pulled from it.
+//
+// This is directly mapped to the hero_banner_odds table.
+//================================================================//
+type HeroBannerOdds struct {
+	HeroBannerID int        `query:"id" json:",omitempty"`
+	Version      int        `query:"version" json:",omitempty"`
+	TableHash    string     `json:",omitempty"`
+	Odds         gacha.Odds `json:",omitempty"`
+	Heroes       []Hero     `json:",omitempty"`
+	PublishedAt  string     `json:",omitempty"`
+}
+
+// HeroBannerOdds.Read returns the published odds of a banner, newest
+// version first. Only the given version is returned, if set.
+func (filter *HeroBannerOdds) Read() ([]HeroBannerOdds, error) {
+	var versions []HeroBannerOdds
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT hero_banner_id, version, table_hash,
+	disclosure, published_at FROM hero_banner_odds WHERE
+	hero_banner_id = $1 AND (version = $2 OR $2 = 0) ORDER BY version
+	DESC`, filter.HeroBannerID, filter.Version)
+	if err != nil {
+		return versions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var odds HeroBannerOdds
+		var disclosure []byte
+
+		if err = rows.Scan(&odds.HeroBannerID, &odds.Version,
+			&odds.TableHash, &disclosure, &odds.PublishedAt); err != nil {
+			return versions, err
+		} else if err = json.Unmarshal(disclosure, &odds); err != nil {
+			return versions, err
+		}
+
+		versions = append(versions, odds)
+	}
+
+	return versions, nil
+}
+
+// HeroBanner.publish validates the loot table of an enabled banner,
+// and publishes its odds if the table has changed since the last
+// version.
+func (banner *HeroBanner) publish(tx *sql.Tx) error {
+	var latest string
+	var version int
+
+	if !banner.IsEnabled {
+		return nil
+	}
+
+	// Read the banner back as the summon engine will
+	if err := banner.readHeroes(tx); err != nil {
+		return err
+	} else if err = banner.readRates(tx); err != nil {
+		return err
+	}
+
+	rarities := map[int]bool{}
+	for _, rate := range banner.Rates {
+		rarities[rate.Rarity] = true
+	}
+
+	odds := HeroBannerOdds{HeroBannerID: banner.ID}
+	for _, hero := range banner.Heroes {
+		if !rarities[int(hero.Hero.Rarity)] {
+			return errors.New("Banner hero " + hero.Hero.Name +
+				" has a rarity without a rate")
+		}
+		odds.Heroes = append(odds.Heroes, hero.Hero)
+	}
+
+	table := banner.LootTable()
+	if err := table.Validate(); err != nil {
+		return err
+	}
+	odds.TableHash, odds.Odds = table.Hash(), table.Odds()
+
+	// Publish a new version if the table has changed
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0),
+	COALESCE((SELECT table_hash FROM hero_banner_odds WHERE
+	hero_banner_id = $1 ORDER BY version DESC LIMIT 1), '')
+	FROM hero_banner_odds WHERE hero_banner_id = $1`, banner.ID,
+	).Scan(&version, &latest); err != nil {
+		return err
+	} else if latest == odds.TableHash {
+		return nil
+	}
+
+	disclosure, err := json.Marshal(struct {
+		Odds   gacha.Odds
+		Heroes []Hero
+	}{odds.Odds, odds.Heroes})
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO hero_banner_odds (hero_banner_id,
+		version, table_hash, disclosure) VALUES ($1, $2, $3, $4)`,
+		banner.ID, version+1, odds.TableHash, disclosure)
+	return err
+}
+
+// republishHeroOdds publishes the odds of every enabled banner with
+// the hero that has not ended, so that a change of the hero's rarity
+// is disclosed straight away. Banners with unchanged tables are left
+// as they are.
+func republishHeroOdds(tx *sql.Tx, heroID int) error {
+	var banners []HeroBanner
+	var banner HeroBanner
+
+	rows, err := tx.Query(`SELECT id, name, is_enabled, pity_soft_start,
+	pity_soft_step, pity_hard, featured_rate FROM hero_banner WHERE
+	is_enabled AND COALESCE(run_end > CURRENT_TIMESTAMP, true) AND id IN
+	(SELECT hero_banner_id FROM hero_banner_hero WHERE hero_id = $1)
+	ORDER BY id FOR UPDATE`, heroID)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		if err = rows.Scan(&banner.ID, &banner.Name, &banner.IsEnabled,
+			&banner.PitySoftStart, &banner.PitySoftStep, &banner.PityHard,
+			&banner.FeaturedRate); err != nil {
+			rows.Close()
+			return err
+		}
+		banners = append(banners, banner)
+	}
+	rows.Close()
+
+	for i := range banners {
+		if err = banners[i].publish(tx); err != nil {
+			return errors.New("Hero banner " + banners[i].Name + ": " +
+				err.Error())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+// pity.go contains the pity progress of players, which the summon
+// service applies to every pull.
+package methods
+
+import (
+	"database/sql"
+
+	"github.com/axkeyz/gacha-api/config"
+	"github.com/axkeyz/gacha-api/internal/gacha"
+)
+
+//========================== PLAYER PITY =========================//
+// PlayerPity is a player's pity progress on a banner type: the
+// number of pulls since their last top rarity hero, and whether
+// their next top rarity hero is guaranteed to be featured.
+//
+// Pity is shared by all banners of the same type.
+//
+// This is directly mapped to the player_pity table.
+//================================================================//
+type PlayerPity struct {
+	PlayerID   int    `json:",omitempty"`
+	BannerType string `json:",omitempty"`
+	Pulls      int    `json:",omitempty"`
+	Guaranteed bool   `json:",omitempty"`
+	UpdatedAt  string `json:",omitempty"`
+}
+
+// PlayerPity.Read returns the pity progress of the player
+// filter.PlayerID on every banner type they have pulled on.
+func (filter *PlayerPity) Read() ([]PlayerPity, error) {
+	var pities []PlayerPity
+	var pity PlayerPity
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT player_id, banner_type, pulls, guaranteed,
+	updated_at FROM player_pity WHERE player_id = $1 ORDER BY banner_type`,
+		filter.PlayerID)
+	if err != nil {
+		return pities, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		// Save data to pointer
+		err = rows.Scan(&pity.PlayerID, &pity.BannerType, &pity.Pulls,
+			&pity.Guaranteed, &pity.UpdatedAt)
+
+		if err != nil {
+			// Display error if rows.Scan causes an error
+			return pities, err
+		}
+
+		pities = append(pities, pity)
+	}
+
+	return pities, nil
+}
+
+// PlayerPity.State returns the pity progress as a gacha.PityState.
+func (pity *PlayerPity) State() gacha.PityState {
+	return gacha.PityState{Pulls: pity.Pulls, Guaranteed: pity.Guaranteed}
+}
+
+// PlayerPity.lock locks (and creates, if required) the player's pity
+// row for the banner type, and loads its progress.
+func (pity *PlayerPity) lock(tx *sql.Tx) error {
+	if _, err := tx.Exec(`INSERT INTO player_pity (player_id, banner_type)
+		VALUES ($1, $2) ON CONFLICT (player_id, banner_type) DO NOTHING`,
+		pity.PlayerID, pity.BannerType,
+	); err != nil {
+		return err
+	}
+
+	return tx.QueryRow(`SELECT pulls, guaranteed, updated_at FROM
+	player_pity WHERE player_id = $1 AND banner_type = $2 FOR UPDATE`,
+		pity.PlayerID, pity.BannerType,
+	).Scan(&pity.Pulls, &pity.Guaranteed, &pity.UpdatedAt)
+}
+
+// PlayerPity.save saves the given progress to a locked pity row.
+func (pity *PlayerPity) save(tx *sql.Tx, state gacha.PityState) error {
+	pity.Pulls, pity.Guaranteed = state.Pulls, state.Guaranteed
+
+	_, err := tx.Exec(`UPDATE player_pity SET pulls = $1, guaranteed = $2,
+		updated_at = CURRENT_TIMESTAMP WHERE player_id = $3 AND
+		banner_type = $4`, pity.Pulls, pity.Guaranteed, pity.PlayerID,
+		pity.BannerType)
+
+	return err
+}
@@ -1,5 +1,12 @@
+// player.go contains structs that relate to players of the game.
 package methods
 
+import (
+	"errors"
+
+	"github.com/axkeyz/gacha-api/config"
+)
+
 //============================= Currency ===========================//
 // Player is the player (gamer) API.
 //
@@ -8,12 +15,49 @@ package methods
 // This is directly mapped to the player table.
 //===============================================================//
 type Player struct {
-	ID         int    `json:",omitempty"`
-	Username   string `json:",omitempty"`
-	Email      string `json:",omitempty"`
-	Verified   bool   `json:",omitempty"`
-	VerifiedAt string `json:",omitempty"`
-	CreatedAt  string `json:",omitempty"`
-	UpdatedAt  string `json:",omitempty"`
-	DisabledAt string `json:",omitempty"`
+	ID         int              `json:",omitempty"`
+	Username   string           `json:",omitempty"`
+	Email      string           `json:",omitempty"`
+	Verified   bool             `json:",omitempty"`
+	VerifiedAt string           `json:",omitempty"`
+	CreatedAt  string           `json:",omitempty"`
+	UpdatedAt  string           `json:",omitempty"`
+	DisabledAt string           `json:",omitempty"`
+	Currency   []PlayerCurrency `json:",omitempty"`
+	Pity       []PlayerPity     `json:",omitempty"`
+}
+
+// Player.Read returns a single Player given its ID, along with the
+// player's balances & pity progress.
+func (filter *Player) Read() (Player, error) {
+	var player Player
+
+	if filter.ID == 0 {
+		return player, errors.New("Player ID cannot be empty")
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	if err := db.QueryRow(`SELECT id, username, COALESCE(email::text, ''),
+	verified, COALESCE(verified_at::text, ''), created_at, updated_at,
+	COALESCE(disabled_at::text, '') FROM player WHERE id = $1`, filter.ID,
+	).Scan(&player.ID, &player.Username, &player.Email, &player.Verified,
+		&player.VerifiedAt, &player.CreatedAt, &player.UpdatedAt,
+		&player.DisabledAt); err != nil {
+		return player, err
+	}
+
+	// Get related balances & pity
+	balances := PlayerCurrency{PlayerID: player.ID}
+	pity := PlayerPity{PlayerID: player.ID}
+
+	var err error
+	if player.Currency, err = balances.Read(); err != nil {
+		return player, err
+	}
+	player.Pity, err = pity.Read()
+
+	return player, err
 }
@@ -0,0 +1,193 @@
+// reference.go contains the reference data of heroes: the classes,
+// rarities & elements that heroes are assigned.
+package methods
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+
+	"github.com/lib/pq"
+
+	"github.com/axkeyz/gacha-api/config"
+)
+
+// Kinds of hero reference data, and the table of each kind
+var referenceTables = map[string]string{
+	"class":   "hero_class",
+	"rarity":  "hero_rarity",
+	"element": "hero_element",
+}
+
+// Reference names are short lowercase slugs
+var referenceName = regexp.MustCompile(`^[a-z][a-z0-9-]{0,24}$`)
+
+//=========================== REFERENCE ===========================//
+// Reference is a class, rarity or element that a hero can be
+// assigned (by its ID), given by Kind.
+//
+// Name is a stable slug used by tools & the game client, and
+// DisplayName is what players see. Rarities are also the rarity
+// tiers of banner loot tables, where the highest rarity is the top
+// tier that pity applies to.
+//
+// This is directly mapped to the hero_class, hero_rarity &
+// hero_element tables.
+//=================================================================//
+type Reference struct {
+	Kind        string `json:",omitempty"`
+	ID          int    `query:"id" json:",omitempty"`
+	Name        string `query:"name" json:",omitempty"`
+	DisplayName string `json:",omitempty"`
+	Icon        string `json:",omitempty"`
+	SortOrder   int    `json:",omitempty"`
+	CreatedAt   string `json:",omitempty"`
+	UpdatedAt   string `json:",omitempty"`
+}
+
+// Reference.Create creates a new class, rarity or element. The ID
+// is the value stored on heroes, so it is chosen rather than
+// generated.
+func (reference *Reference) Create() error {
+	table, err := reference.validate()
+	if err != nil {
+		return err
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	return db.QueryRow(`INSERT INTO `+table+` (id, name, display_name,
+	icon, sort_order) VALUES ($1, $2, $3, NULLIF($4, ''), $5)
+	RETURNING id, created_at, updated_at`, reference.ID, reference.Name,
+		reference.DisplayName, reference.Icon, reference.SortOrder,
+	).Scan(&reference.ID, &reference.CreatedAt, &reference.UpdatedAt)
+}
+
+// Reference.Read returns the classes, rarities or elements that fit
+// the filter, in their sort order.
+func (filter *Reference) Read() ([]Reference, error) {
+	var references []Reference
+	reference := Reference{Kind: filter.Kind}
+
+	table, ok := referenceTables[filter.Kind]
+	if !ok {
+		return references, errors.New("Kind must be class, rarity or element")
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, name, display_name,
+	COALESCE(icon, ''), sort_order, created_at, updated_at FROM `+table+`
+	WHERE (id = $1 OR $1 = 0) AND (name = $2 OR $2 = '')
+	ORDER BY sort_order, id`, filter.ID, filter.Name)
+	if err != nil {
+		return references, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&reference.ID, &reference.Name,
+			&reference.DisplayName, &reference.Icon, &reference.SortOrder,
+			&reference.CreatedAt, &reference.UpdatedAt); err != nil {
+			return references, err
+		}
+		references = append(references, reference)
+	}
+
+	return references, nil
+}
+
+// Reference.Update updates a class, rarity or element given its ID.
+func (reference *Reference) Update() error {
+	table, err := reference.validate()
+	if err != nil {
+		return err
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	err = db.QueryRow(`UPDATE `+table+` SET name = $1, display_name = $2,
+	icon = NULLIF($3, ''), sort_order = $4, updated_at = CURRENT_TIMESTAMP
+	WHERE id = $5 RETURNING created_at, updated_at`, reference.Name,
+		reference.DisplayName, reference.Icon, reference.SortOrder,
+		reference.ID,
+	).Scan(&reference.CreatedAt, &reference.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return errors.New("Reference not found")
+	}
+
+	return err
+}
+
+// Reference.Delete deletes a class, rarity or element given its ID.
+// References that are still in use cannot be deleted.
+func (reference *Reference) Delete() error {
+	table, ok := referenceTables[reference.Kind]
+	if !ok {
+		return errors.New("Kind must be class, rarity or element")
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM `+table+` WHERE id = $1`,
+		reference.ID)
+	if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == "23503" {
+		return errors.New("Reference is in use and cannot be deleted")
+	} else if err != nil {
+		return err
+	} else if count, _ := result.RowsAffected(); count == 0 {
+		return errors.New("Reference not found")
+	}
+
+	return nil
+}
+
+// Reference.validate checks the required fields of a Reference,
+// and returns the table of its kind.
+func (reference *Reference) validate() (string, error) {
+	table, ok := referenceTables[reference.Kind]
+	if !ok {
+		return "", errors.New("Kind must be class, rarity or element")
+	} else if !referenceName.MatchString(reference.Name) {
+		return "", errors.New("Name must be a lowercase slug of up to 25 characters")
+	} else if reference.DisplayName == "" {
+		return "", errors.New("Display name cannot be empty")
+	} else if reference.ID <= 0 {
+		return "", errors.New("ID must be positive")
+	}
+
+	return table, nil
+}
+
+// Hero.checkReferences checks that the class, rarity & element of a
+// Hero exist.
+func (hero *Hero) checkReferences(tx *sql.Tx) error {
+	var class, rarity, element bool
+
+	if err := tx.QueryRow(`SELECT
+	EXISTS (SELECT 1 FROM hero_class WHERE id = $1),
+	EXISTS (SELECT 1 FROM hero_rarity WHERE id = $2),
+	EXISTS (SELECT 1 FROM hero_element WHERE id = $3)`,
+		hero.Class, hero.Rarity, hero.Element,
+	).Scan(&class, &rarity, &element); err != nil {
+		return err
+	}
+
+	if !class {
+		return errors.New("Hero class is invalid")
+	} else if !rarity {
+		return errors.New("Hero rarity is invalid")
+	} else if !element {
+		return errors.New("Hero element is invalid")
+	}
+
+	return nil
+}
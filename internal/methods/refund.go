@@ -0,0 +1,435 @@
+// refund.go contains summon refunds, which reverse summons and post
+// compensating transactions through the player currency ledger.
+package methods
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+
+	"github.com/axkeyz/gacha-api/config"
+	"github.com/axkeyz/gacha-api/internal/gacha"
+)
+
+// Transaction reason of currency refunded (or clawed back) by a
+// summon refund
+const TransactionRefund = "refund"
+
+//========================= SUMMON REFUND ========================//
+// SummonRefund reverses some of a player's summons.
+//
+// Refunded summons are soft deleted, and any rings equipped to them
+// are unequipped. The cost of each summon is refunded, split evenly
+// over the summons of its transaction (so refunding every summon of
+// a multi pull refunds it in full), and paid & free currency are
+// refunded as they were spent. Spark points spent on a summon of a
+// banner that has ended are settled straight away (expired, or
+// refunded as the currency they convert to). Spark points earned by
+// the pulls and
+// currency converted from duplicates are clawed back (as far as the
+// player's balance allows), and limit breaks from duplicates are
+// lowered.
+//
+// Pity on each banner type is replayed without the refunded pulls.
+// A DryRun previews all of this without saving it.
+//================================================================//
+type SummonRefund struct {
+	PlayerID     int                 `json:",omitempty"`
+	SummonIDs    []int               `json:",omitempty"`
+	DryRun       bool                `json:",omitempty"`
+	Summons      []Summon            `json:",omitempty"`
+	Transactions []PlayerTransaction `json:",omitempty"`
+	Rings        []int               `json:",omitempty"`
+	Pity         []PlayerPity        `json:",omitempty"`
+}
+
+// refundCost is the cost transaction shared by refunded summons.
+type refundCost struct {
+	currencyID int
+	paid       int
+	free       int
+	summons    int
+	refunded   int
+	refunding  int
+	spark      HeroBannerSpark
+	ended      bool
+}
+
+// SummonRefund.Execute refunds the summons, or previews the refund
+// if refund.DryRun is set.
+func (refund *SummonRefund) Execute() error {
+	if refund.PlayerID == 0 || len(refund.SummonIDs) == 0 {
+		return errors.New("Player ID and Summon IDs cannot be empty")
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = refund.lock(tx); err != nil {
+		return err
+	} else if err = refund.refundCosts(tx); err != nil {
+		return err
+	} else if err = refund.reverseRewards(tx); err != nil {
+		return err
+	}
+
+	// Soft delete the summons & unequip their rings
+	ids := pq.Array(refund.SummonIDs)
+	if _, err = tx.Exec(`UPDATE summon SET deleted_at = CURRENT_TIMESTAMP,
+		is_active = false WHERE id = ANY($1)`, ids); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`UPDATE player_ring SET summon_id = NULL WHERE
+	summon_id = ANY($1) AND deleted_at IS NULL RETURNING ring_id`, ids)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		var ring int
+		if err = rows.Scan(&ring); err != nil {
+			rows.Close()
+			return err
+		}
+		refund.Rings = append(refund.Rings, ring)
+	}
+	rows.Close()
+
+	if err = refund.restorePity(tx); err != nil {
+		return err
+	}
+
+	if refund.DryRun {
+		return tx.Rollback()
+	}
+	return tx.Commit()
+}
+
+// SummonRefund.lock locks & loads the summons to refund. Every summon
+// must belong to the player and not already be refunded.
+func (refund *SummonRefund) lock(tx *sql.Tx) error {
+	var summon Summon
+
+	rows, err := tx.Query(`SELECT summon.id, summon.transaction_id,
+	summon.hero_id, summon.hero_banner_id, summon.rarity, summon.source,
+	summon.pity_count, summon.pity_guaranteed,
+	COALESCE(summon.duplicate_policy, ''), COALESCE(summon.duplicate_of, 0),
+	COALESCE(summon.duplicate_transaction_id, 0), summon.created_at,
+	COALESCE(summon.deleted_at::text, '') FROM summon WHERE
+	summon.id = ANY($1) AND summon.player_id = $2 ORDER BY summon.id
+	FOR UPDATE`, pq.Array(refund.SummonIDs), refund.PlayerID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	refund.Summons = nil
+	for rows.Next() {
+		if err = rows.Scan(&summon.ID, &summon.TransactionID,
+			&summon.HeroID, &summon.HeroBannerID, &summon.Rarity,
+			&summon.Source, &summon.PityCount, &summon.PityGuaranteed,
+			&summon.DuplicatePolicy, &summon.DuplicateOfID,
+			&summon.DuplicateTransactionID, &summon.CreatedAt,
+			&summon.DeletedAt); err != nil {
+			return err
+		} else if summon.DeletedAt != "" {
+			return errors.New("Summon is already refunded")
+		}
+		summon.PlayerID = refund.PlayerID
+
+		refund.Summons = append(refund.Summons, summon)
+	}
+
+	if err = rows.Err(); err != nil {
+		return err
+	} else if len(refund.Summons) != len(refund.SummonIDs) {
+		return errors.New("Summon not found")
+	}
+
+	return nil
+}
+
+// SummonRefund.refundCosts refunds each summon's share of the
+// transaction that paid for it.
+func (refund *SummonRefund) refundCosts(tx *sql.Tx) error {
+	var order []int
+	costs := map[int]*refundCost{}
+
+	for _, summon := range refund.Summons {
+		if cost, ok := costs[summon.TransactionID]; ok {
+			cost.refunding++
+			continue
+		}
+
+		cost := &refundCost{refunding: 1}
+		if err := tx.QueryRow(`SELECT currency_id, -paid_change,
+		-free_change, (SELECT COUNT(*) FROM summon WHERE transaction_id =
+		player_transaction.id), (SELECT COUNT(*) FROM summon WHERE
+		transaction_id = player_transaction.id AND deleted_at IS NOT NULL)
+		FROM player_transaction WHERE id = $1`, summon.TransactionID,
+		).Scan(&cost.currencyID, &cost.paid, &cost.free, &cost.summons,
+			&cost.refunded); err != nil {
+			return err
+		}
+
+		// Spark points are settled once their banner ends, and so
+		// cannot be given back after it has
+		if summon.Source == SummonSpark {
+			if err := tx.QueryRow(`SELECT spark_on_end,
+			COALESCE(spark_convert_currency_id, 0), spark_convert_rate,
+			spark_settled_at IS NOT NULL OR COALESCE(run_end <=
+			CURRENT_TIMESTAMP, false) FROM hero_banner WHERE id = $1 FOR SHARE`,
+				summon.HeroBannerID,
+			).Scan(&cost.spark.OnEnd, &cost.spark.ConvertCurrencyID,
+				&cost.spark.ConvertRate, &cost.ended); err != nil {
+				return err
+			}
+		}
+
+		costs[summon.TransactionID] = cost
+		order = append(order, summon.TransactionID)
+	}
+
+	for _, id := range order {
+		cost := costs[id]
+		currency := PlayerCurrency{
+			PlayerID:   refund.PlayerID,
+			CurrencyID: cost.currencyID,
+		}
+
+		rate := 1
+		if cost.ended {
+			if cost.spark.OnEnd != SparkConvert {
+				continue
+			}
+			currency.CurrencyID = cost.spark.ConvertCurrencyID
+			rate = cost.spark.ConvertRate
+		}
+
+		for _, paid := range []bool{true, false} {
+			spent := cost.free
+			if paid {
+				spent = cost.paid
+			}
+
+			// Shares are rounded down, so the last summon of the
+			// transaction to be refunded gets the remainder
+			amount := cost.share(spent) * rate
+			if amount <= 0 {
+				continue
+			}
+
+			transaction, err := currency.grant(
+				tx, amount, paid, TransactionRefund, "",
+			)
+			if err != nil {
+				return err
+			}
+			refund.Transactions = append(refund.Transactions, transaction)
+		}
+	}
+
+	return nil
+}
+
+// refundCost.share returns the part of spent that is refunded.
+func (cost *refundCost) share(spent int) int {
+	before := spent * cost.refunded / cost.summons
+	after := spent * (cost.refunded + cost.refunding) / cost.summons
+	return after - before
+}
+
+// SummonRefund.reverseRewards claws back the spark points earned by
+// refunded pulls & currency converted from refunded duplicates, and
+// lowers limit breaks raised by refunded duplicates.
+func (refund *SummonRefund) reverseRewards(tx *sql.Tx) error {
+	for _, summon := range refund.Summons {
+		var spark HeroBannerSpark
+
+		if summon.Source == SummonPull {
+			if err := tx.QueryRow(`SELECT COALESCE(spark_currency_id, 0),
+			spark_per_pull, COALESCE(spark_settled_at::text, '') FROM
+			hero_banner WHERE id = $1`, summon.HeroBannerID,
+			).Scan(&spark.CurrencyID, &spark.PerPull,
+				&spark.SettledAt); err != nil {
+				return err
+			}
+		}
+
+		if spark.CurrencyID != 0 && spark.SettledAt == "" {
+			points := PlayerCurrency{
+				PlayerID:   refund.PlayerID,
+				CurrencyID: spark.CurrencyID,
+			}
+			if err := refund.clawback(tx, &points, spark.PerPull); err != nil {
+				return err
+			}
+		}
+
+		switch summon.DuplicatePolicy {
+		case DuplicateLimitBreak:
+			if _, err := tx.Exec(`UPDATE summon SET limit_break =
+				GREATEST(limit_break - 1, 0) WHERE id = $1`,
+				summon.DuplicateOfID); err != nil {
+				return err
+			}
+		case DuplicateConvert:
+			var converted PlayerCurrency
+			var amount int
+
+			if err := tx.QueryRow(`SELECT currency_id, change FROM
+			player_transaction WHERE id = $1`, summon.DuplicateTransactionID,
+			).Scan(&converted.CurrencyID, &amount); err != nil {
+				return err
+			}
+			converted.PlayerID = refund.PlayerID
+
+			if err := refund.clawback(tx, &converted, amount); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// SummonRefund.clawback spends up to amount of the player's balance,
+// as far as their live lots allow.
+func (refund *SummonRefund) clawback(tx *sql.Tx, currency *PlayerCurrency,
+	amount int) error {
+	var spendable int
+
+	if err := currency.lock(tx); err != nil {
+		return err
+	}
+
+	if err := tx.QueryRow(`SELECT COALESCE(SUM(remaining), 0) FROM
+	player_currency_lot WHERE player_id = $1 AND currency_id = $2 AND
+	remaining > 0 AND (expires_at IS NULL OR expires_at >
+	CURRENT_TIMESTAMP)`, currency.PlayerID, currency.CurrencyID,
+	).Scan(&spendable); err != nil {
+		return err
+	}
+
+	if amount > spendable {
+		amount = spendable
+	}
+	if amount <= 0 {
+		return nil
+	}
+
+	transaction, err := currency.spend(tx, amount, TransactionRefund)
+	if err != nil {
+		return err
+	}
+	refund.Transactions = append(refund.Transactions, transaction)
+
+	return nil
+}
+
+// SummonRefund.restorePity replays the player's pity on each banner
+// type with refunded pulls. Refunded summons must already be soft
+// deleted.
+func (refund *SummonRefund) restorePity(tx *sql.Tx) error {
+	// Get the first refunded pull on each banner type
+	rows, err := tx.Query(`SELECT hero_banner.banner_type, MIN(summon.id)
+	FROM summon INNER JOIN hero_banner ON hero_banner.id =
+	summon.hero_banner_id WHERE summon.id = ANY($1) AND summon.source = $2
+	GROUP BY hero_banner.banner_type ORDER BY hero_banner.banner_type`,
+		pq.Array(refund.SummonIDs), SummonPull)
+	if err != nil {
+		return err
+	}
+
+	firsts := map[string]int{}
+	var types []string
+	for rows.Next() {
+		var bannerType string
+		var first int
+		if err = rows.Scan(&bannerType, &first); err != nil {
+			rows.Close()
+			return err
+		}
+		firsts[bannerType] = first
+		types = append(types, bannerType)
+	}
+	rows.Close()
+
+	for _, bannerType := range types {
+		pity := PlayerPity{PlayerID: refund.PlayerID, BannerType: bannerType}
+		if err = pity.lock(tx); err != nil {
+			return err
+		}
+
+		state, err := refund.replayPity(tx, &pity, firsts[bannerType])
+		if err != nil {
+			return err
+		} else if err = pity.save(tx, state); err != nil {
+			return err
+		}
+
+		refund.Pity = append(refund.Pity, pity)
+	}
+
+	return nil
+}
+
+// SummonRefund.replayPity returns the pity progress of a banner type
+// without its refunded pulls, starting from just before the first
+// refunded pull. Every pull stores the progress before it, so each
+// pull that is kept is replayed from the progress stored on the pull
+// after it (or the current progress, after the last pull): that pull
+// was a top tier hero if its pity count was reset.
+func (refund *SummonRefund) replayPity(tx *sql.Tx, pity *PlayerPity,
+	first int) (gacha.PityState, error) {
+	var states []gacha.PityState
+	var deleted []bool
+
+	rows, err := tx.Query(`SELECT summon.pity_count, summon.pity_guaranteed,
+	summon.deleted_at IS NOT NULL FROM summon INNER JOIN hero_banner ON
+	hero_banner.id = summon.hero_banner_id WHERE summon.player_id = $1 AND
+	hero_banner.banner_type = $2 AND summon.source = $3 AND summon.id >= $4
+	ORDER BY summon.id`, refund.PlayerID, pity.BannerType, SummonPull, first)
+	if err != nil {
+		return gacha.PityState{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var state gacha.PityState
+		var isDeleted bool
+		if err = rows.Scan(&state.Pulls, &state.Guaranteed,
+			&isDeleted); err != nil {
+			return gacha.PityState{}, err
+		}
+		states = append(states, state)
+		deleted = append(deleted, isDeleted)
+	}
+	if err = rows.Err(); err != nil {
+		return gacha.PityState{}, err
+	}
+	states = append(states, pity.State())
+
+	state := states[0]
+	for i := range deleted {
+		if deleted[i] {
+			continue
+		}
+
+		if next := states[i+1]; next.Pulls == 0 {
+			state = gacha.PityState{Guaranteed: next.Guaranteed}
+		} else {
+			state.Pulls++
+		}
+	}
+
+	return state, nil
+}
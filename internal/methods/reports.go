@@ -0,0 +1,95 @@
+// reports.go contains read-only reports over the player currency
+// ledger.
+package methods
+
+import (
+	"github.com/axkeyz/gacha-api/config"
+)
+
+//======================= CURRENCY REPORT ========================//
+// CurrencyReport breaks a currency's outstanding balances and its
+// ledger changes out by paid & free sub-balance.
+//
+// The outstanding paid balance is the deferred revenue of the
+// currency: currency that was bought but has not been spent yet.
+//================================================================//
+type CurrencyReport struct {
+	CurrencyID  int                    `query:"currency_id" json:",omitempty"`
+	Currency    string                 `json:",omitempty"`
+	PaidBalance int                    `json:",omitempty"`
+	FreeBalance int                    `json:",omitempty"`
+	Changes     []CurrencyReportChange `json:",omitempty"`
+	From        string                 `query:"from" json:",omitempty"`
+	To          string                 `query:"to" json:",omitempty"`
+}
+
+// CurrencyReportChange is the total paid & free change of a single
+// transaction reason.
+type CurrencyReportChange struct {
+	Reason     string `json:",omitempty"`
+	PaidChange int    `json:",omitempty"`
+	FreeChange int    `json:",omitempty"`
+}
+
+// CurrencyReport.Read returns a report for every currency (or only
+// filter.CurrencyID, if set). Changes are limited to transactions
+// between filter.From and filter.To, where either may be empty.
+func (filter *CurrencyReport) Read() ([]CurrencyReport, error) {
+	var reports []CurrencyReport
+	var report CurrencyReport
+	var change CurrencyReportChange
+	var currencyID int
+	index := map[int]int{}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	// Get outstanding balances
+	rows, err := db.Query(`SELECT currency.id, currency.name,
+	COALESCE(SUM(player_currency.paid_amount), 0),
+	COALESCE(SUM(player_currency.amount - player_currency.paid_amount), 0)
+	FROM currency LEFT JOIN player_currency ON player_currency.currency_id
+	= currency.id WHERE ($1 = 0 OR currency.id = $1) GROUP BY currency.id
+	ORDER BY currency.id`, filter.CurrencyID)
+	if err != nil {
+		return reports, err
+	}
+
+	for rows.Next() {
+		if err = rows.Scan(&report.CurrencyID, &report.Currency,
+			&report.PaidBalance, &report.FreeBalance); err != nil {
+			rows.Close()
+			return reports, err
+		}
+		report.From, report.To = filter.From, filter.To
+		index[report.CurrencyID] = len(reports)
+		reports = append(reports, report)
+	}
+	rows.Close()
+
+	// Get ledger changes within the date range
+	rows, err = db.Query(`SELECT currency_id, reason, SUM(paid_change),
+	SUM(free_change) FROM player_transaction WHERE ($1 = 0 OR
+	currency_id = $1) AND created_at >= COALESCE(NULLIF($2, '')::timestamp,
+	'-infinity') AND created_at < COALESCE(NULLIF($3, '')::timestamp,
+	'infinity') GROUP BY currency_id, reason ORDER BY currency_id, reason`,
+		filter.CurrencyID, filter.From, filter.To)
+	if err != nil {
+		return reports, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&currencyID, &change.Reason, &change.PaidChange,
+			&change.FreeChange); err != nil {
+			return reports, err
+		}
+
+		if i, ok := index[currencyID]; ok {
+			reports[i].Changes = append(reports[i].Changes, change)
+		}
+	}
+
+	return reports, nil
+}
@@ -0,0 +1,411 @@
+// revision.go contains the draft & publish workflow of hero content:
+// revisions of a hero are drafted, approved, and published live.
+package methods
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/axkeyz/gacha-api/config"
+)
+
+// Revision statuses
+const (
+	RevisionDraft     = "draft"
+	RevisionApproved  = "approved"
+	RevisionPublished = "published"
+	RevisionArchived  = "archived"
+)
+
+//========================= HERO REVISION ========================//
+// HeroRevision is a numbered revision of a hero's content: the hero
+// with its background, base stats, skills, skill multipliers & skill
+// actions.
+//
+// Revisions start as drafts, which can be edited by their author
+// until they are approved by a member of staff other than their
+// author. Publishing an approved revision makes its content live in
+// one transaction, and archives the revision that was live. Rolling
+// back publishes a new revision with the content of an archived one,
+// so the history of what was live is never lost.
+//
+// Rolling back deliberately skips review, so that a bad publish can
+// be undone straight away: the content was already approved when it
+// was first published. The rollback revision is created & approved
+// by the member of staff who rolled back.
+//
+// This is directly mapped to the hero_revision table.
+//================================================================//
+type HeroRevision struct {
+	ID          int    `query:"id" json:",omitempty"`
+	HeroID      int    `json:",omitempty"`
+	Number      int    `json:",omitempty"`
+	Status      string `query:"status" json:",omitempty"`
+	Content     Hero   `json:",omitempty"`
+	Note        string `json:",omitempty"`
+	RollbackOf  int    `json:",omitempty"`
+	CreatedBy   int    `json:",omitempty"`
+	ApprovedBy  int    `json:",omitempty"`
+	PublishedBy int    `json:",omitempty"`
+	CreatedAt   string `json:",omitempty"`
+	ApprovedAt  string `json:",omitempty"`
+	PublishedAt string `json:",omitempty"`
+}
+
+// HeroRevision.Create creates a new draft revision of a hero.
+func (revision *HeroRevision) Create() error {
+	if err := revision.validate(); err != nil {
+		return err
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	revision.Status = RevisionDraft
+	if err = revision.insert(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// HeroRevision.Read returns the revisions of a hero that fit the
+// filter, newest first.
+func (filter *HeroRevision) Read() ([]HeroRevision, error) {
+	var revisions []HeroRevision
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, hero_id, number, status, content,
+	COALESCE(note, ''), COALESCE(rollback_of, 0), created_by,
+	COALESCE(approved_by, 0), COALESCE(published_by, 0), created_at,
+	COALESCE(approved_at::text, ''), COALESCE(published_at::text, '')
+	FROM hero_revision WHERE hero_id = $1 AND (id = $2 OR $2 = 0) AND
+	(status = $3 OR $3 = '') ORDER BY number DESC`, filter.HeroID,
+		filter.ID, filter.Status)
+	if err != nil {
+		return revisions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var revision HeroRevision
+		var content []byte
+
+		if err = rows.Scan(&revision.ID, &revision.HeroID, &revision.Number,
+			&revision.Status, &content, &revision.Note, &revision.RollbackOf,
+			&revision.CreatedBy, &revision.ApprovedBy, &revision.PublishedBy,
+			&revision.CreatedAt, &revision.ApprovedAt,
+			&revision.PublishedAt); err != nil {
+			return revisions, err
+		} else if err = json.Unmarshal(content, &revision.Content); err != nil {
+			return revisions, err
+		}
+
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
+
+// HeroRevision.Update updates the content & note of a draft
+// revision. Revisions can only be edited by their author, so that
+// nobody can approve their own edits.
+func (revision *HeroRevision) Update(staffID int) error {
+	if err := revision.validate(); err != nil {
+		return err
+	}
+
+	content, err := revision.content()
+	if err != nil {
+		return err
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stored := HeroRevision{ID: revision.ID, HeroID: revision.HeroID}
+	if err = stored.lock(tx); err != nil {
+		return err
+	} else if stored.Status != RevisionDraft {
+		return errors.New("Only draft revisions can be edited")
+	} else if stored.CreatedBy != staffID {
+		return errors.New("Revisions can only be edited by their author")
+	}
+
+	if _, err = tx.Exec(`UPDATE hero_revision SET content = $1,
+	note = NULLIF($2, '') WHERE id = $3`, content, revision.Note,
+		revision.ID); err != nil {
+		return err
+	}
+
+	revision.Number, revision.Status = stored.Number, stored.Status
+	revision.CreatedBy = stored.CreatedBy
+	return tx.Commit()
+}
+
+// HeroRevision.Approve approves a draft revision. Revisions cannot
+// be approved by their author.
+func (revision *HeroRevision) Approve(staffID int) error {
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = revision.lock(tx); err != nil {
+		return err
+	} else if revision.Status != RevisionDraft {
+		return errors.New("Only draft revisions can be approved")
+	} else if revision.CreatedBy == staffID {
+		return errors.New("Revisions cannot be approved by their author")
+	}
+
+	if err = tx.QueryRow(`UPDATE hero_revision SET status = $1,
+	approved_by = $2, approved_at = CURRENT_TIMESTAMP WHERE id = $3
+	RETURNING status, approved_by, approved_at`, RevisionApproved, staffID,
+		revision.ID,
+	).Scan(&revision.Status, &revision.ApprovedBy,
+		&revision.ApprovedAt); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// HeroRevision.Publish makes an approved revision live.
+func (revision *HeroRevision) Publish(staffID int) error {
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = revision.lock(tx); err != nil {
+		return err
+	} else if revision.Status != RevisionApproved {
+		return errors.New("Only approved revisions can be published")
+	}
+
+	if err = revision.publish(tx, staffID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// HeroRevision.Rollback publishes a new revision with the content
+// of an archived (previously live) revision, and returns it. The new
+// revision is not reviewed again.
+func (revision *HeroRevision) Rollback(staffID int) (HeroRevision, error) {
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return HeroRevision{}, err
+	}
+	defer tx.Rollback()
+
+	if err = revision.lock(tx); err != nil {
+		return HeroRevision{}, err
+	} else if revision.Status != RevisionArchived {
+		return HeroRevision{}, errors.New(
+			"Only previously published revisions can be rolled back to")
+	}
+
+	rollback := HeroRevision{
+		HeroID:     revision.HeroID,
+		Status:     RevisionApproved,
+		Content:    revision.Content,
+		Note:       "Rollback to revision " + strconv.Itoa(revision.Number),
+		RollbackOf: revision.ID,
+		CreatedBy:  staffID,
+		ApprovedBy: staffID,
+	}
+
+	if err = rollback.insert(tx); err != nil {
+		return rollback, err
+	} else if err = rollback.publish(tx, staffID); err != nil {
+		return rollback, err
+	}
+
+	return rollback, tx.Commit()
+}
+
+// HeroRevision.validate checks the content of a HeroRevision.
+func (revision *HeroRevision) validate() error {
+	if revision.HeroID == 0 {
+		return errors.New("Hero ID cannot be empty")
+	}
+
+	return revision.Content.validate()
+}
+
+// HeroRevision.content returns the content of a HeroRevision as
+// JSON.
+func (revision *HeroRevision) content() (string, error) {
+	content := revision.Content
+	content.ID = revision.HeroID
+	content.CreatedAt, content.UpdatedAt = "", ""
+	content.Pagination = Pagination{}
+
+	for i := range content.Skills {
+		content.Skills[i].HeroID = revision.HeroID
+	}
+
+	encoded, err := json.Marshal(content)
+	return string(encoded), err
+}
+
+// HeroRevision.insert inserts a revision as the next revision of its
+// hero.
+func (revision *HeroRevision) insert(tx *sql.Tx) error {
+	content, err := revision.content()
+	if err != nil {
+		return err
+	}
+
+	// Lock the hero so that revisions are numbered in order
+	var heroID int
+	if err = tx.QueryRow(`SELECT id FROM hero WHERE id = $1 FOR UPDATE`,
+		revision.HeroID).Scan(&heroID); err == sql.ErrNoRows {
+		return errors.New("Hero not found")
+	} else if err != nil {
+		return err
+	}
+
+	return tx.QueryRow(`INSERT INTO hero_revision (hero_id, number, status,
+	content, note, rollback_of, created_by, approved_by, approved_at)
+	SELECT $1, COALESCE(MAX(number), 0) + 1, $2, $3, NULLIF($4, ''),
+	NULLIF($5, 0), $6, NULLIF($7, 0), CASE WHEN $7 = 0 THEN NULL ELSE
+	CURRENT_TIMESTAMP END FROM hero_revision WHERE hero_id = $1
+	RETURNING id, number, created_at, COALESCE(approved_at::text, '')`,
+		revision.HeroID, revision.Status, content, revision.Note,
+		revision.RollbackOf, revision.CreatedBy, revision.ApprovedBy,
+	).Scan(&revision.ID, &revision.Number, &revision.CreatedAt,
+		&revision.ApprovedAt)
+}
+
+// HeroRevision.lock loads & locks a revision given its ID & hero.
+func (revision *HeroRevision) lock(tx *sql.Tx) error {
+	var content []byte
+
+	err := tx.QueryRow(`SELECT number, status, content, created_by FROM
+	hero_revision WHERE id = $1 AND hero_id = $2 FOR UPDATE`, revision.ID,
+		revision.HeroID,
+	).Scan(&revision.Number, &revision.Status, &content,
+		&revision.CreatedBy)
+	if err == sql.ErrNoRows {
+		return errors.New("Revision not found")
+	} else if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(content, &revision.Content)
+}
+
+// HeroRevision.publish writes the content of a revision to its hero,
+// archives the revision that was live, and marks the revision as
+// published.
+func (revision *HeroRevision) publish(tx *sql.Tx, staffID int) error {
+	hero := revision.Content
+	hero.ID = revision.HeroID
+
+	if err := hero.validate(); err != nil {
+		return err
+	} else if err = hero.checkReferences(tx); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE hero SET name = $1, class = $2,
+	rarity = $3, element = $4, is_active = $5, updated_at =
+	CURRENT_TIMESTAMP WHERE id = $6`, hero.Name, hero.Class, hero.Rarity,
+		hero.Element, hero.IsActive, hero.ID); err != nil {
+		return err
+	}
+
+	// Skills that were removed since the revision are added again
+	for i := range hero.Skills {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM hero_skill
+		WHERE id = $1 AND hero_id = $2)`, hero.Skills[i].ID, hero.ID,
+		).Scan(&exists); err != nil {
+			return err
+		} else if !exists {
+			hero.Skills[i].ID = 0
+		}
+	}
+
+	if err := hero.saveDetails(tx); err != nil {
+		return err
+	} else if err = republishHeroOdds(tx, hero.ID); err != nil {
+		return err
+	}
+
+	// Skills without multipliers or actions in the revision have none
+	// live
+	var multiplied, acting []string
+	for _, skill := range hero.Skills {
+		if skill.Multiplier != nil {
+			multiplied = append(multiplied, strconv.Itoa(skill.ID))
+		}
+		if len(skill.Actions) > 0 {
+			acting = append(acting, strconv.Itoa(skill.ID))
+		}
+	}
+	if err := deleteSkillMultipliers(
+		tx, hero.ID, strings.Join(multiplied, ", "),
+	); err != nil {
+		return err
+	} else if err = deleteSkillActions(tx, hero.ID, acting); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(`UPDATE hero_revision SET status = $1 WHERE
+	hero_id = $2 AND status = $3`, RevisionArchived, hero.ID,
+		RevisionPublished); err != nil {
+		return err
+	}
+
+	// Store the content as published, with the IDs of new skills
+	revision.Content = hero
+	content, err := revision.content()
+	if err != nil {
+		return err
+	}
+
+	return tx.QueryRow(`UPDATE hero_revision SET status = $1,
+	content = $2, published_by = $3, published_at = CURRENT_TIMESTAMP
+	WHERE id = $4 RETURNING status, published_by, published_at`,
+		RevisionPublished, content, staffID, revision.ID,
+	).Scan(&revision.Status, &revision.PublishedBy, &revision.PublishedAt)
+}
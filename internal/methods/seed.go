@@ -0,0 +1,300 @@
+// seed.go contains the per-player random streams that summons are
+// pulled from, and the verification of past summons.
+package methods
+
+import (
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/axkeyz/gacha-api/config"
+	"github.com/axkeyz/gacha-api/internal/gacha"
+)
+
+var ErrSummonNotPulled = errors.New("Summon was not pulled from a seed")
+
+//========================== PLAYER SEED =========================//
+// PlayerSeed is the secret seed of a player's random stream (see
+// gacha.Stream). Each player has one active seed, which is created
+// on their first pull. Draws is the index of the next draw.
+//
+// Only the Commitment of an active seed is shown. Once a seed is
+// rotated, it is revealed and a new seed takes its place, so that
+// every summon pulled from it can be checked independently.
+//
+// This is directly mapped to the player_seed table.
+//================================================================//
+type PlayerSeed struct {
+	ID         int    `json:",omitempty"`
+	PlayerID   int    `json:",omitempty"`
+	Seed       string `json:",omitempty"`
+	Commitment string `json:",omitempty"`
+	Draws      int64  `json:",omitempty"`
+	IsActive   bool   `json:",omitempty"`
+	CreatedAt  string `json:",omitempty"`
+	RevealedAt string `json:",omitempty"`
+	seed       []byte
+}
+
+// SummonVerification is the re-derived outcome of a past summon.
+//
+// Result is the pull replayed from the summon's seed, draw index and
+// pity progress. Verified is true if it matches the stored summon.
+// The pull is replayed against the snapshot of the loot table it was
+// pulled from. TableChanged is true if the banner's loot table has
+// been edited since the summon. The seed is only included once it
+// has been revealed.
+type SummonVerification struct {
+	Summon       Summon       `json:",omitempty"`
+	Seed         PlayerSeed   `json:",omitempty"`
+	DrawIndex    int64        `json:",omitempty"`
+	TableHash    string       `json:",omitempty"`
+	TableChanged bool         `json:",omitempty"`
+	Result       gacha.Result `json:",omitempty"`
+	Verified     bool         `json:",omitempty"`
+}
+
+// PlayerSeed.Read returns the seeds of a player, newest first. The
+// seeds of active seeds are hidden.
+func (filter *PlayerSeed) Read() ([]PlayerSeed, error) {
+	var seeds []PlayerSeed
+	var seed PlayerSeed
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, player_id, seed, commitment, draws,
+	is_active, created_at, COALESCE(revealed_at::text, '') FROM
+	player_seed WHERE player_id = $1 ORDER BY id DESC`, filter.PlayerID)
+	if err != nil {
+		return seeds, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&seed.ID, &seed.PlayerID, &seed.seed,
+			&seed.Commitment, &seed.Draws, &seed.IsActive, &seed.CreatedAt,
+			&seed.RevealedAt); err != nil {
+			return seeds, err
+		}
+
+		seed.Seed = ""
+		if !seed.IsActive {
+			seed.Seed = hex.EncodeToString(seed.seed)
+		}
+		seed.seed = nil
+
+		seeds = append(seeds, seed)
+	}
+
+	return seeds, nil
+}
+
+// PlayerSeed.Rotate reveals the player's active seed (if any) and
+// replaces it with a new one.
+func (seed *PlayerSeed) Rotate() error {
+	if seed.PlayerID == 0 {
+		return errors.New("Player ID cannot be empty")
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = seed.lock(tx); err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`UPDATE player_seed SET is_active = false,
+		revealed_at = CURRENT_TIMESTAMP WHERE id = $1`, seed.ID); err != nil {
+		return err
+	}
+
+	if err = seed.create(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// PlayerSeed.Stream returns a gacha.Stream at the seed's next draw.
+func (seed *PlayerSeed) Stream() *gacha.Stream {
+	return &gacha.Stream{Seed: seed.seed, Index: seed.Draws}
+}
+
+// PlayerSeed.lock locks (and creates, if required) the player's
+// active seed.
+func (seed *PlayerSeed) lock(tx *sql.Tx) error {
+	err := tx.QueryRow(`SELECT id, seed, commitment, draws, is_active,
+	created_at FROM player_seed WHERE player_id = $1 AND is_active
+	FOR UPDATE`, seed.PlayerID,
+	).Scan(&seed.ID, &seed.seed, &seed.Commitment, &seed.Draws,
+		&seed.IsActive, &seed.CreatedAt)
+
+	if err == sql.ErrNoRows {
+		return seed.create(tx)
+	}
+	return err
+}
+
+// PlayerSeed.create inserts a new active seed for the player. The
+// insert waits on any other active seed of the player, so the seed
+// that wins is locked & loaded instead.
+func (seed *PlayerSeed) create(tx *sql.Tx) error {
+	secret, err := gacha.NewSeed()
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(`INSERT INTO player_seed (player_id, seed,
+		commitment) VALUES ($1, $2, $3) ON CONFLICT (player_id)
+		WHERE is_active DO NOTHING`, seed.PlayerID, secret,
+		gacha.Commitment(secret)); err != nil {
+		return err
+	}
+
+	return tx.QueryRow(`SELECT id, seed, commitment, draws, is_active,
+	created_at FROM player_seed WHERE player_id = $1 AND is_active
+	FOR UPDATE`, seed.PlayerID,
+	).Scan(&seed.ID, &seed.seed, &seed.Commitment, &seed.Draws,
+		&seed.IsActive, &seed.CreatedAt)
+}
+
+// PlayerSeed.advance saves the index of the next draw to a locked
+// seed.
+func (seed *PlayerSeed) advance(tx *sql.Tx, draws int64) error {
+	seed.Draws = draws
+
+	_, err := tx.Exec(`UPDATE player_seed SET draws = $1 WHERE id = $2`,
+		seed.Draws, seed.ID)
+	return err
+}
+
+// VerifySummon replays a past summon from its seed & draw index, and
+// checks the outcome against the stored summon.
+func VerifySummon(summonID int) (SummonVerification, error) {
+	var verification SummonVerification
+	var seedID sql.NullInt64
+	var drawIndex sql.NullInt64
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	summon := &verification.Summon
+	if err := db.QueryRow(`SELECT id, player_id, hero_id, hero_banner_id,
+	rarity, is_featured, source, pity_count, pity_guaranteed,
+	player_seed_id, draw_index, COALESCE(table_hash, ''), created_at
+	FROM summon WHERE id = $1`, summonID,
+	).Scan(&summon.ID, &summon.PlayerID, &summon.HeroID,
+		&summon.HeroBannerID, &summon.Rarity, &summon.IsFeatured,
+		&summon.Source, &summon.PityCount, &summon.PityGuaranteed, &seedID,
+		&drawIndex, &verification.TableHash, &summon.CreatedAt,
+	); err != nil {
+		return verification, err
+	} else if !seedID.Valid || !drawIndex.Valid {
+		return verification, ErrSummonNotPulled
+	}
+	verification.DrawIndex = drawIndex.Int64
+
+	// Get the seed the summon was pulled from
+	seed := &verification.Seed
+	if err := db.QueryRow(`SELECT id, player_id, seed, commitment, draws,
+	is_active, created_at, COALESCE(revealed_at::text, '') FROM
+	player_seed WHERE id = $1`, seedID.Int64,
+	).Scan(&seed.ID, &seed.PlayerID, &seed.seed, &seed.Commitment,
+		&seed.Draws, &seed.IsActive, &seed.CreatedAt, &seed.RevealedAt,
+	); err != nil {
+		return verification, err
+	}
+	// Active seeds stay secret, or later pulls could be predicted
+	if !seed.IsActive {
+		seed.Seed = hex.EncodeToString(seed.seed)
+	}
+
+	// Get the banner's current loot table
+	filter := HeroBanner{ID: summon.HeroBannerID}
+	banners, err := filter.Read()
+	if err != nil {
+		return verification, err
+	} else if len(banners) == 0 {
+		return verification, errors.New("Banner not found")
+	}
+
+	table := banners[0].LootTable()
+	verification.TableChanged = table.Hash() != verification.TableHash
+
+	// Replay against the loot table the summon was pulled from. Only
+	// summons pulled before snapshots were kept use the current table
+	if table, err = readLootSnapshot(db, verification.TableHash); err == sql.ErrNoRows {
+		table = banners[0].LootTable()
+	} else if err != nil {
+		return verification, err
+	}
+
+	// Replay the pull
+	stream := gacha.Stream{Seed: seed.seed, Index: verification.DrawIndex}
+	state := gacha.PityState{
+		Pulls:      summon.PityCount,
+		Guaranteed: summon.PityGuaranteed,
+	}
+	if verification.Result, err = table.Pull(&stream, &state); err != nil {
+		return verification, err
+	}
+
+	verification.Verified = verification.Result.HeroID == summon.HeroID &&
+		verification.Result.Rarity == summon.Rarity &&
+		verification.Result.Featured == summon.IsFeatured
+
+	return verification, nil
+}
+
+// saveLootSnapshot keeps the loot table that summons are pulled from
+// under its hash, so that they can be replayed after the banner is
+// edited.
+func saveLootSnapshot(tx *sql.Tx, table *gacha.LootTable) error {
+	snapshot, err := json.Marshal(table)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`INSERT INTO loot_table_snapshot (hash, loot_table)
+	VALUES ($1, $2) ON CONFLICT (hash) DO NOTHING`, table.Hash(),
+		string(snapshot))
+	return err
+}
+
+// readLootSnapshot returns the loot table with the given hash.
+func readLootSnapshot(q querier, hash string) (gacha.LootTable, error) {
+	var table gacha.LootTable
+
+	rows, err := q.Query(`SELECT loot_table FROM loot_table_snapshot
+	WHERE hash = $1`, hash)
+	if err != nil {
+		return table, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return table, sql.ErrNoRows
+	}
+
+	var snapshot []byte
+	if err = rows.Scan(&snapshot); err != nil {
+		return table, err
+	} else if err = json.Unmarshal(snapshot, &table); err != nil {
+		return table, err
+	} else if table.Hash() != hash {
+		return table, errors.New("Loot table snapshot does not match its hash")
+	}
+
+	return table, nil
+}
@@ -0,0 +1,309 @@
+// sound.go contains the sound assets (voice lines, sound effects &
+// music) of heroes & their skills.
+package methods
+
+import (
+	"database/sql"
+	"errors"
+	"regexp"
+
+	"github.com/axkeyz/gacha-api/config"
+	"github.com/axkeyz/gacha-api/internal/media"
+)
+
+// Categories of sound
+const (
+	SoundVoice = "voice"
+	SoundSFX   = "sfx"
+	SoundMusic = "music"
+)
+
+// languagePattern matches language tags such as en, ja or pt-BR.
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Z]{2})?$`)
+
+//========================== SOUND ASSET =========================//
+// SoundAsset is an uploaded sound of a Category, for a hero or one
+// of its skills (or neither, e.g. for menu music). Voice lines need
+// a hero and a Language, which groups them into voice packs.
+//
+// Sound files are stored under the SHA-256 hash of their content,
+// so the same file uploaded for several heroes is stored once.
+// Uploads & deletes of the same file are serialised by its hash. Its
+// Duration (in seconds), SampleRate & Channels are read from the
+// file's headers on upload.
+//
+// This is directly mapped to the sound_asset table.
+//================================================================//
+type SoundAsset struct {
+	ID           int     `query:"id" json:",omitempty"`
+	Hash         string  `json:",omitempty"`
+	FileName     string  `json:",omitempty"`
+	OriginalName string  `query:"name" json:",omitempty"`
+	MimeType     string  `query:"mime_type" json:",omitempty"`
+	Size         int     `json:",omitempty"`
+	Category     string  `query:"category" json:",omitempty"`
+	Language     string  `query:"language" json:",omitempty"`
+	HeroID       int     `query:"hero_id" json:",omitempty"`
+	HeroSkillID  int     `query:"hero_skill_id" json:",omitempty"`
+	Duration     float64 `json:",omitempty"`
+	SampleRate   int     `json:",omitempty"`
+	Channels     int     `json:",omitempty"`
+	URL          string  `json:",omitempty"`
+	UploadedBy   int     `json:",omitempty"`
+	CreatedAt    string  `json:",omitempty"`
+	UpdatedAt    string  `json:",omitempty"`
+}
+
+// SoundAsset.Upload validates & stores an uploaded sound file, and
+// creates its SoundAsset with the file's metadata.
+func (asset *SoundAsset) Upload(data []byte) error {
+	sound, err := media.DecodeSound(data)
+	if err != nil {
+		return err
+	} else if err = asset.validate(); err != nil {
+		return err
+	}
+
+	asset.Hash = media.Hash(data)
+	asset.FileName = "sound/" + asset.Hash + sound.Extension
+	asset.MimeType, asset.Size = sound.MimeType, len(data)
+	asset.Duration, asset.SampleRate, asset.Channels = sound.Duration,
+		sound.SampleRate, sound.Channels
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = lockSoundFile(tx, asset.Hash); err != nil {
+		return err
+	} else if err = asset.checkHero(tx); err != nil {
+		return err
+	}
+
+	if err = tx.QueryRow(`INSERT INTO sound_asset (hash, file_name,
+	original_name, mime_type, size, category, language, hero_id,
+	hero_skill_id, duration, sample_rate, channels, uploaded_by) VALUES
+	($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, 0), NULLIF($9, 0),
+	$10, $11, $12, $13) RETURNING id, created_at, updated_at`, asset.Hash,
+		asset.FileName, asset.OriginalName, asset.MimeType, asset.Size,
+		asset.Category, asset.Language, asset.HeroID, asset.HeroSkillID,
+		asset.Duration, asset.SampleRate, asset.Channels, asset.UploadedBy,
+	).Scan(&asset.ID, &asset.CreatedAt, &asset.UpdatedAt); err != nil {
+		return err
+	}
+
+	// The file is only saved once its asset is, and is removed again
+	// if the asset cannot be committed
+	store := config.SetupStorage()
+	exists, err := store.Exists(asset.FileName)
+	if err != nil {
+		return err
+	} else if !exists {
+		if err = store.Save(asset.FileName, data); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		if !exists {
+			store.Delete(asset.FileName)
+		}
+		return err
+	}
+
+	asset.URL = store.URL(asset.FileName)
+	return nil
+}
+
+// SoundAsset.Read returns the sound assets that fit the filter.
+func (filter *SoundAsset) Read() ([]SoundAsset, error) {
+	var assets []SoundAsset
+	var asset SoundAsset
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, hash, file_name, original_name,
+	mime_type, size, category, COALESCE(language, ''), COALESCE(hero_id, 0),
+	COALESCE(hero_skill_id, 0), duration, sample_rate, channels,
+	uploaded_by, created_at, updated_at FROM sound_asset WHERE
+	(id = $1 OR $1 = 0) AND (lower(original_name) LIKE lower('%' || $2 || '%'))
+	AND (mime_type = $3 OR $3 = '') AND (category = $4 OR $4 = '') AND
+	(language = $5 OR $5 = '') AND (hero_id = $6 OR $6 = 0) AND
+	(hero_skill_id = $7 OR $7 = 0) ORDER BY hero_id, hero_skill_id,
+	category, language, id`, filter.ID, filter.OriginalName,
+		filter.MimeType, filter.Category, filter.Language, filter.HeroID,
+		filter.HeroSkillID)
+	if err != nil {
+		return assets, err
+	}
+	defer rows.Close()
+
+	store := config.SetupStorage()
+	for rows.Next() {
+		if err = rows.Scan(&asset.ID, &asset.Hash, &asset.FileName,
+			&asset.OriginalName, &asset.MimeType, &asset.Size,
+			&asset.Category, &asset.Language, &asset.HeroID,
+			&asset.HeroSkillID, &asset.Duration, &asset.SampleRate,
+			&asset.Channels, &asset.UploadedBy, &asset.CreatedAt,
+			&asset.UpdatedAt); err != nil {
+			return assets, err
+		}
+
+		asset.URL = store.URL(asset.FileName)
+		assets = append(assets, asset)
+	}
+
+	return assets, nil
+}
+
+// SoundAsset.Update updates the category, language, hero & skill of
+// a SoundAsset given its ID. Its file cannot be changed.
+func (asset *SoundAsset) Update() error {
+	if err := asset.validate(); err != nil {
+		return err
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = asset.checkHero(tx); err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`UPDATE sound_asset SET category = $1,
+	language = NULLIF($2, ''), hero_id = NULLIF($3, 0),
+	hero_skill_id = NULLIF($4, 0), updated_at = CURRENT_TIMESTAMP
+	WHERE id = $5 RETURNING hash, file_name, original_name, mime_type,
+	size, duration, sample_rate, channels, uploaded_by, created_at,
+	updated_at`, asset.Category, asset.Language, asset.HeroID,
+		asset.HeroSkillID, asset.ID,
+	).Scan(&asset.Hash, &asset.FileName, &asset.OriginalName,
+		&asset.MimeType, &asset.Size, &asset.Duration, &asset.SampleRate,
+		&asset.Channels, &asset.UploadedBy, &asset.CreatedAt,
+		&asset.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return errors.New("Sound asset not found")
+	} else if err != nil {
+		return err
+	}
+
+	asset.URL = config.SetupStorage().URL(asset.FileName)
+	return tx.Commit()
+}
+
+// SoundAsset.Delete deletes a SoundAsset given its ID, and its file
+// if no other sound asset uses it.
+func (asset *SoundAsset) Delete() error {
+	var shared bool
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err = tx.QueryRow(`SELECT hash FROM sound_asset WHERE id = $1`,
+		asset.ID).Scan(&asset.Hash); err == sql.ErrNoRows {
+		return errors.New("Sound asset not found")
+	} else if err != nil {
+		return err
+	} else if err = lockSoundFile(tx, asset.Hash); err != nil {
+		return err
+	}
+
+	err = tx.QueryRow(`WITH deleted AS (DELETE FROM sound_asset WHERE
+	id = $1 RETURNING hash, file_name) SELECT file_name, EXISTS (SELECT 1
+	FROM sound_asset WHERE hash = deleted.hash AND id != $1) FROM deleted`,
+		asset.ID).Scan(&asset.FileName, &shared)
+	if err == sql.ErrNoRows {
+		return errors.New("Sound asset not found")
+	} else if err != nil {
+		return err
+	}
+
+	// The file is deleted while the hash is locked, so that an upload
+	// of the same file cannot find it before it is gone
+	if !shared {
+		if err = config.SetupStorage().Delete(asset.FileName); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// lockSoundFile serialises uploads & deletes of the sound file with
+// the given hash until tx ends.
+func lockSoundFile(tx *sql.Tx, hash string) error {
+	_, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`,
+		"sound/"+hash)
+	return err
+}
+
+// SoundAsset.validate checks the tags of a SoundAsset.
+func (asset *SoundAsset) validate() error {
+	switch asset.Category {
+	case SoundVoice:
+		if asset.HeroID == 0 && asset.HeroSkillID == 0 {
+			return errors.New("Voice lines need a hero")
+		} else if asset.Language == "" {
+			return errors.New("Voice lines need a language")
+		}
+	case SoundSFX, SoundMusic:
+	default:
+		return errors.New("Sound category must be voice, sfx or music")
+	}
+
+	if asset.Language != "" && !languagePattern.MatchString(asset.Language) {
+		return errors.New("Language must be a language tag, e.g. en or pt-BR")
+	}
+
+	return nil
+}
+
+// SoundAsset.checkHero checks that the hero & skill of a SoundAsset
+// exist, and sets the hero of a skill's sound.
+func (asset *SoundAsset) checkHero(tx *sql.Tx) error {
+	if asset.HeroSkillID != 0 {
+		var heroID int
+		if err := tx.QueryRow(`SELECT hero_id FROM hero_skill WHERE
+		id = $1`, asset.HeroSkillID).Scan(&heroID); err == sql.ErrNoRows {
+			return errors.New("Hero skill not found")
+		} else if err != nil {
+			return err
+		} else if asset.HeroID != 0 && asset.HeroID != heroID {
+			return errors.New("Hero skill belongs to another hero")
+		}
+
+		asset.HeroID = heroID
+	} else if asset.HeroID != 0 {
+		var exists bool
+		if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM hero WHERE
+		id = $1)`, asset.HeroID).Scan(&exists); err != nil {
+			return err
+		} else if !exists {
+			return errors.New("Hero not found")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,305 @@
+// spark.go contains spark (exchange point) functions. Spark points
+// are earned by pulling on a banner and are exchanged for one of
+// its featured heroes.
+package methods
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/axkeyz/gacha-api/config"
+)
+
+// Transaction reasons of spark points earned, exchanged & converted
+const (
+	TransactionSparkEarn     = "spark-earn"
+	TransactionSparkExchange = "spark-exchange"
+	TransactionSparkConvert  = "spark-convert"
+)
+
+// What happens to spark points left over when a banner ends
+const (
+	SparkExpire  = "expire"
+	SparkConvert = "convert"
+)
+
+// Sources of a summon
+const (
+	SummonPull  = "pull"
+	SummonSpark = "spark"
+)
+
+var ErrNotSparkable = errors.New("Hero cannot be sparked on this banner")
+
+//======================== HERO BANNER SPARK =====================//
+// HeroBannerSpark are the spark settings of a HeroBanner.
+//
+// Every pull on the banner earns PerPull points of the banner's own
+// spark currency (CurrencyID), and Cost points can be exchanged for
+// any featured hero of the banner. Spark points are held in the
+// player currency ledger, so they are audited like any other
+// currency.
+//
+// Once the banner ends, left over points expire or are converted
+// into ConvertRate of ConvertCurrencyID each (OnEnd). SettledAt is
+// set once this has been done, after which pulls earn no points. A
+// CurrencyID of 0 disables spark.
+//
+// This is directly mapped to the spark columns of hero_banner.
+//================================================================//
+type HeroBannerSpark struct {
+	CurrencyID        int    `json:",omitempty"`
+	PerPull           int    `json:",omitempty"`
+	Cost              int    `json:",omitempty"`
+	OnEnd             string `json:",omitempty"`
+	ConvertCurrencyID int    `json:",omitempty"`
+	ConvertRate       int    `json:",omitempty"`
+	SettledAt         string `json:",omitempty"`
+}
+
+// SparkRequest is a player's exchange of spark points for a featured
+// hero of a banner.
+type SparkRequest struct {
+	PlayerID     int               `json:",omitempty"`
+	HeroBannerID int               `json:",omitempty"`
+	HeroID       int               `json:",omitempty"`
+	Transaction  PlayerTransaction `json:",omitempty"`
+	Summon       Summon            `json:",omitempty"`
+}
+
+// HeroBannerSpark.validate returns an error if the spark settings
+// are invalid.
+func (spark *HeroBannerSpark) validate() error {
+	if spark.OnEnd == "" {
+		spark.OnEnd = SparkExpire
+	}
+
+	if spark.CurrencyID == 0 {
+		return nil
+	}
+
+	if spark.PerPull <= 0 || spark.Cost <= 0 {
+		return errors.New("Spark points per pull and cost must be positive")
+	} else if spark.OnEnd != SparkExpire && spark.OnEnd != SparkConvert {
+		return errors.New("Spark points must expire or convert")
+	} else if spark.OnEnd == SparkConvert &&
+		(spark.ConvertCurrencyID == 0 || spark.ConvertRate <= 0) {
+		return errors.New("Spark conversion needs a currency and positive rate")
+	} else if spark.ConvertCurrencyID == spark.CurrencyID {
+		return errors.New("Spark points cannot convert to themselves")
+	}
+
+	return nil
+}
+
+// SparkRequest.Execute spends the banner's spark cost and gives the
+// player the requested featured hero.
+func (request *SparkRequest) Execute() error {
+	var sparkable bool
+	var rarity int
+
+	if request.PlayerID == 0 || request.HeroBannerID == 0 ||
+		request.HeroID == 0 {
+		return errors.New("Player ID, Banner ID and Hero ID cannot be empty")
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Get the banner
+	banner, err := lockBanner(tx, request.HeroBannerID)
+	if err != nil {
+		return err
+	} else if banner.Spark.CurrencyID == 0 {
+		return ErrNotSparkable
+	}
+
+	if err = tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM hero_banner_hero
+	WHERE hero_banner_id = $1 AND hero_id = $2 AND is_featured),
+	COALESCE((SELECT rarity FROM hero WHERE id = $2), 0)`,
+		request.HeroBannerID, request.HeroID,
+	).Scan(&sparkable, &rarity); err != nil {
+		return err
+	} else if !sparkable {
+		return ErrNotSparkable
+	}
+
+	// Charge the player's spark points
+	currency := PlayerCurrency{
+		PlayerID:   request.PlayerID,
+		CurrencyID: banner.Spark.CurrencyID,
+	}
+	if request.Transaction, err = currency.spend(
+		tx, banner.Spark.Cost, TransactionSparkExchange,
+	); err != nil {
+		return err
+	}
+
+	request.Summon = Summon{
+		TransactionID: request.Transaction.ID,
+		PlayerID:      request.PlayerID,
+		HeroID:        request.HeroID,
+		HeroBannerID:  request.HeroBannerID,
+		Rarity:        rarity,
+		IsFeatured:    true,
+		Source:        SummonSpark,
+	}
+	if err = request.Summon.create(tx); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SettleBannerSparks expires or converts the spark points left over
+// on every banner that has ended. It returns the IDs of the banners
+// that were settled. A banner that fails to settle does not stop the
+// others, and is settled again on the next run.
+func SettleBannerSparks() ([]int, error) {
+	var banners []HeroBanner
+	var banner HeroBanner
+	var settled []int
+	var failed []string
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	// Get ended banners that have not been settled
+	rows, err := db.Query(`SELECT id, spark_currency_id, spark_on_end,
+	COALESCE(spark_convert_currency_id, 0), spark_convert_rate FROM
+	hero_banner WHERE spark_currency_id IS NOT NULL AND spark_settled_at
+	IS NULL AND run_end <= CURRENT_TIMESTAMP ORDER BY id`)
+	if err != nil {
+		return settled, err
+	}
+
+	for rows.Next() {
+		if err = rows.Scan(&banner.ID, &banner.Spark.CurrencyID,
+			&banner.Spark.OnEnd, &banner.Spark.ConvertCurrencyID,
+			&banner.Spark.ConvertRate); err != nil {
+			rows.Close()
+			return settled, err
+		}
+		banners = append(banners, banner)
+	}
+	rows.Close()
+
+	for _, banner := range banners {
+		if err = banner.Spark.settle(db, banner.ID); err != nil {
+			failed = append(failed, "Hero banner "+strconv.Itoa(banner.ID)+
+				": "+err.Error())
+			continue
+		}
+		settled = append(settled, banner.ID)
+	}
+
+	if len(failed) > 0 {
+		return settled, errors.New(strings.Join(failed, "; "))
+	}
+	return settled, nil
+}
+
+// HeroBannerSpark.settle settles the spark points of every player on
+// a banner, each in its own database transaction. The banner is only
+// marked as settled once every player is.
+func (spark *HeroBannerSpark) settle(db *sql.DB, bannerID int) error {
+	var players []int
+	var player int
+	var failed []string
+
+	// Wait for pulls that started before the banner ended, so that the
+	// points they earned are settled too. Later pulls find it ended.
+	if _, err := db.Exec(`SELECT 1 FROM hero_banner WHERE id = $1
+	FOR UPDATE`, bannerID); err != nil {
+		return err
+	}
+
+	rows, err := db.Query(`SELECT player_id FROM player_currency WHERE
+	currency_id = $1 AND amount > 0 ORDER BY player_id`, spark.CurrencyID)
+	if err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		if err = rows.Scan(&player); err != nil {
+			rows.Close()
+			return err
+		}
+		players = append(players, player)
+	}
+	rows.Close()
+
+	for _, player := range players {
+		if err = spark.settlePlayer(db, player); err != nil {
+			failed = append(failed, "player "+strconv.Itoa(player)+": "+
+				err.Error())
+		}
+	}
+
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, ", "))
+	}
+
+	_, err = db.Exec(`UPDATE hero_banner SET spark_settled_at =
+		CURRENT_TIMESTAMP WHERE id = $1`, bannerID)
+	return err
+}
+
+// HeroBannerSpark.settlePlayer expires or converts a single player's
+// spark points. Only live points are settled: lots that have expired
+// are left to the expiry sweep (see ExpireCurrencyLots).
+func (spark *HeroBannerSpark) settlePlayer(db *sql.DB, playerID int) error {
+	var spendable int
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	points := PlayerCurrency{PlayerID: playerID, CurrencyID: spark.CurrencyID}
+	if err = points.lock(tx); err != nil {
+		return err
+	} else if err = tx.QueryRow(`SELECT COALESCE(SUM(remaining), 0) FROM
+	player_currency_lot WHERE player_id = $1 AND currency_id = $2 AND
+	remaining > 0 AND (expires_at IS NULL OR expires_at > CURRENT_TIMESTAMP)`,
+		playerID, spark.CurrencyID).Scan(&spendable); err != nil {
+		return err
+	} else if spendable <= 0 {
+		return nil
+	}
+
+	reason := TransactionExpire
+	if spark.OnEnd == SparkConvert {
+		reason = TransactionSparkConvert
+	}
+
+	if _, err = points.spend(tx, spendable, reason); err != nil {
+		return err
+	}
+
+	if spark.OnEnd == SparkConvert {
+		converted := PlayerCurrency{
+			PlayerID:   playerID,
+			CurrencyID: spark.ConvertCurrencyID,
+		}
+		if _, err = converted.grant(
+			tx, spendable*spark.ConvertRate, false,
+			TransactionSparkConvert, "",
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,446 @@
+// summon.go contains the summon service, which pulls heroes from a
+// banner's loot table and charges the player for them.
+package methods
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/axkeyz/gacha-api/config"
+	"github.com/axkeyz/gacha-api/internal/gacha"
+)
+
+// Transaction reason of currency spent on summons
+const TransactionSummon = "summon"
+
+// Number of heroes pulled by a single pull & a multi (10) pull
+const (
+	SinglePull = 1
+	MultiPull  = 10
+)
+
+var ErrBannerInactive = errors.New("Banner is not active")
+
+// summonSortColumns are the columns of the summon history that
+// summons can be sorted by.
+var summonSortColumns = map[string]bool{
+	"id": true, "hero_id": true, "hero": true, "hero_banner_id": true,
+	"banner": true, "rarity": true, "is_featured": true, "source": true,
+	"pity_count": true, "transaction_id": true, "currency": true,
+	"change": true, "cost": true, "created_at": true, "deleted_at": true,
+}
+
+//============================ SUMMON ============================//
+// Summon is a hero owned by a player.
+//
+// Every summon was paid for by a PlayerTransaction. A multi pull
+// creates several summons that share a single transaction. Source
+// is whether the summon was pulled or exchanged for spark points.
+//
+// Cost is the summon's share of its transaction's change, split
+// evenly over the summons of the transaction (with the remainder on
+// its last summon), in the same way as SummonRefund.
+//
+// PityCount & PityGuaranteed are the player's pity progress just
+// before the summon was pulled. Pulled summons also keep the seed &
+// draw index of the player's random stream they were pulled from,
+// and the hash of the loot table, so that they can be verified.
+//
+// Summons of a hero the player already owns record the duplicate
+// policy applied to them (see DuplicatePolicy). Duplicates that
+// raised a limit break or were converted to currency are inactive.
+//
+// This is directly mapped to the summon & summon_stats tables.
+//================================================================//
+type Summon struct {
+	ID                     int               `json:",omitempty"`
+	TransactionID          int               `json:",omitempty"`
+	PlayerID               int               `json:",omitempty"`
+	HeroID                 int               `json:",omitempty"`
+	Hero                   Hero              `json:",omitempty"`
+	HeroBannerID           int               `query:"banner_id" json:",omitempty"`
+	HeroBanner             HeroBanner        `json:",omitempty"`
+	Rarity                 int               `json:",omitempty"`
+	IsFeatured             bool              `json:",omitempty"`
+	Source                 string            `json:",omitempty"`
+	PityCount              int               `json:",omitempty"`
+	PityGuaranteed         bool              `json:",omitempty"`
+	PlayerSeedID           int               `json:",omitempty"`
+	DrawIndex              int64             `json:",omitempty"`
+	TableHash              string            `json:",omitempty"`
+	LimitBreak             int               `json:",omitempty"`
+	DuplicatePolicy        string            `json:",omitempty"`
+	DuplicateOfID          int               `json:",omitempty"`
+	DuplicateTransactionID int               `json:",omitempty"`
+	Level                  int               `json:",omitempty"`
+	Friendship             float64           `json:",omitempty"`
+	IsActive               bool              `json:",omitempty"`
+	Stats                  SummonStats       `json:",omitempty"`
+	Transaction            PlayerTransaction `json:",omitempty"`
+	Cost                   int               `json:",omitempty"`
+	CreatedAt              string            `json:",omitempty"`
+	DeletedAt              string            `json:",omitempty"`
+	From                   string            `query:"from" json:"-"`
+	To                     string            `query:"to" json:"-"`
+	Pagination
+}
+
+// SummonStats are the stats of a single summon, which start as a
+// copy of its hero's base stats.
+type SummonStats struct {
+	Attack        int `json:",omitempty"`
+	CritChance    int `json:",omitempty"`
+	CritDamage    int `json:",omitempty"`
+	HitChance     int `json:",omitempty"`
+	Effectiveness int `json:",omitempty"`
+	Health        int `json:",omitempty"`
+	Defence       int `json:",omitempty"`
+	Evasion       int `json:",omitempty"`
+	Resistance    int `json:",omitempty"`
+}
+
+//======================== SUMMON REQUEST ========================//
+// SummonRequest is a single or multi pull by a player on a banner.
+//
+// The cost of the pull, any spark points earned, every summon and
+// its stats, and the player's pity progress are written in a single
+// database transaction.
+//
+// Heroes are pulled from the player's seeded random stream, unless
+// another Source is given.
+//================================================================//
+type SummonRequest struct {
+	PlayerID     int               `json:",omitempty"`
+	HeroBannerID int               `json:",omitempty"`
+	Pulls        int               `json:",omitempty"`
+	Source       gacha.Source      `json:"-"`
+	Transaction  PlayerTransaction `json:",omitempty"`
+	Spark        PlayerTransaction `json:",omitempty"`
+	Pity         PlayerPity        `json:",omitempty"`
+	Seed         PlayerSeed        `json:",omitempty"`
+	Summons      []Summon          `json:",omitempty"`
+}
+
+// SummonRequest.Execute pulls request.Pulls heroes from the banner
+// and charges the player the banner's cost.
+func (request *SummonRequest) Execute() error {
+	if request.PlayerID == 0 || request.HeroBannerID == 0 {
+		return errors.New("Player ID and Banner ID cannot be empty")
+	} else if request.Pulls != SinglePull && request.Pulls != MultiPull {
+		return errors.New("Pulls must be 1 or 10")
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Get the banner & its loot table
+	banner, err := lockBanner(tx, request.HeroBannerID)
+	if err != nil {
+		return err
+	}
+
+	table := banner.LootTable()
+	if err = table.Check(); err != nil {
+		return err
+	}
+
+	cost := banner.CostSingle
+	if request.Pulls == MultiPull {
+		cost = banner.CostMulti
+	}
+
+	// Charge the player
+	currency := PlayerCurrency{
+		PlayerID:   request.PlayerID,
+		CurrencyID: banner.CostCurrencyID,
+	}
+	if request.Transaction, err = currency.spend(
+		tx, cost, TransactionSummon,
+	); err != nil {
+		return err
+	}
+
+	// Earn spark points on banners that have them, unless they have
+	// already been settled
+	if banner.Spark.CurrencyID != 0 && banner.Spark.SettledAt == "" {
+		spark := PlayerCurrency{
+			PlayerID:   request.PlayerID,
+			CurrencyID: banner.Spark.CurrencyID,
+		}
+		if request.Spark, err = spark.grant(
+			tx, request.Pulls*banner.Spark.PerPull, false,
+			TransactionSparkEarn, "",
+		); err != nil {
+			return err
+		}
+	}
+
+	// Get the player's pity on this type of banner
+	request.Pity = PlayerPity{
+		PlayerID:   request.PlayerID,
+		BannerType: banner.BannerType,
+	}
+	if err = request.Pity.lock(tx); err != nil {
+		return err
+	}
+	state := request.Pity.State()
+
+	// Get the player's random stream
+	var stream *gacha.Stream
+	src := request.Source
+	if src == nil {
+		request.Seed = PlayerSeed{PlayerID: request.PlayerID}
+		if err = request.Seed.lock(tx); err != nil {
+			return err
+		}
+		stream = request.Seed.Stream()
+		src = stream
+
+		if err = saveLootSnapshot(tx, &table); err != nil {
+			return err
+		}
+	}
+	hash := table.Hash()
+
+	// Pull each hero
+	request.Summons = nil
+	for i := 0; i < request.Pulls; i++ {
+		before := state
+
+		summon := Summon{}
+		if stream != nil {
+			summon.PlayerSeedID = request.Seed.ID
+			summon.DrawIndex = stream.Index
+			summon.TableHash = hash
+		}
+
+		result, err := table.Pull(src, &state)
+		if err != nil {
+			return err
+		}
+
+		summon.TransactionID = request.Transaction.ID
+		summon.PlayerID = request.PlayerID
+		summon.HeroID = result.HeroID
+		summon.HeroBannerID = request.HeroBannerID
+		summon.Rarity = result.Rarity
+		summon.IsFeatured = result.Featured
+		summon.PityCount = before.Pulls
+		summon.PityGuaranteed = before.Guaranteed
+		if err = summon.create(tx); err != nil {
+			return err
+		}
+
+		request.Summons = append(request.Summons, summon)
+	}
+
+	if err = request.Pity.save(tx, state); err != nil {
+		return err
+	}
+
+	if stream != nil {
+		if err = request.Seed.advance(tx, stream.Index); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Summon.Read returns the summons of the player filter.PlayerID that
+// fit the filter's banner & date range (From inclusive, To
+// exclusive), with their banner, hero & cost transaction.
+func (filter *Summon) Read() ([]Summon, error) {
+	var summons []Summon
+	var summon Summon
+
+	if filter.SortBy != "" && !summonSortColumns[filter.SortBy] {
+		return summons, errors.New("Summons cannot be sorted by " +
+			filter.SortBy)
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	main := `SELECT * FROM (SELECT summon.id, summon.player_id,
+	summon.hero_id, hero.name AS hero, summon.hero_banner_id,
+	hero_banner.name AS banner, summon.rarity, summon.is_featured,
+	summon.source, summon.pity_count, summon.pity_guaranteed,
+	COALESCE(summon.duplicate_policy, '') AS duplicate_policy,
+	summon.limit_break, summon.is_active, summon.transaction_id,
+	player_transaction.currency_id, currency.name AS currency,
+	player_transaction.change, player_transaction.change * ROW_NUMBER()
+	OVER spend / COUNT(*) OVER spend - player_transaction.change *
+	(ROW_NUMBER() OVER spend - 1) / COUNT(*) OVER spend AS cost,
+	summon.created_at, COALESCE(summon.deleted_at::text, '') AS deleted_at
+	FROM summon
+	INNER JOIN hero ON hero.id = summon.hero_id
+	INNER JOIN hero_banner ON hero_banner.id = summon.hero_banner_id
+	INNER JOIN player_transaction ON player_transaction.id =
+	summon.transaction_id
+	INNER JOIN currency ON currency.id = player_transaction.currency_id
+	WHERE summon.player_id = $1 WINDOW spend AS (PARTITION BY
+	summon.transaction_id ORDER BY summon.id ROWS BETWEEN UNBOUNDED
+	PRECEDING AND UNBOUNDED FOLLOWING)) AS history`
+	where, args := filter.Filter()
+	sort := filter.Pagination.Query()
+	if sort == "" {
+		sort = " ORDER BY id"
+	}
+
+	rows, err := db.Query(main+where+sort, args...)
+	if err != nil {
+		return summons, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		// Save data to pointer
+		err = rows.Scan(&summon.ID, &summon.PlayerID, &summon.HeroID,
+			&summon.Hero.Name, &summon.HeroBannerID, &summon.HeroBanner.Name,
+			&summon.Rarity, &summon.IsFeatured, &summon.Source,
+			&summon.PityCount, &summon.PityGuaranteed,
+			&summon.DuplicatePolicy, &summon.LimitBreak, &summon.IsActive,
+			&summon.TransactionID, &summon.Transaction.CurrencyID,
+			&summon.Transaction.Currency.Name, &summon.Transaction.Change,
+			&summon.Cost, &summon.CreatedAt, &summon.DeletedAt)
+
+		if err != nil {
+			// Display error if rows.Scan causes an error
+			return summons, err
+		}
+		summon.Hero.ID = summon.HeroID
+		summon.HeroBanner.ID = summon.HeroBannerID
+		summon.Transaction.ID = summon.TransactionID
+
+		summons = append(summons, summon)
+	}
+
+	return summons, nil
+}
+
+// Summon.Filter generates a WHERE query string, and its arguments,
+// given the filter parameters. The player ID is always the first
+// argument.
+func (filter *Summon) Filter() (string, []interface{}) {
+	var items []string
+	args := []interface{}{filter.PlayerID}
+
+	if filter.HeroBannerID != 0 {
+		args = append(args, filter.HeroBannerID)
+		items = append(items, "hero_banner_id = $"+strconv.Itoa(len(args)))
+	}
+
+	if filter.From != "" {
+		args = append(args, filter.From)
+		items = append(items, "created_at >= $"+strconv.Itoa(len(args))+
+			"::timestamp")
+	}
+
+	if filter.To != "" {
+		args = append(args, filter.To)
+		items = append(items, "created_at < $"+strconv.Itoa(len(args))+
+			"::timestamp")
+	}
+
+	if len(items) > 0 {
+		return " WHERE " + strings.Join(items, " AND "), args
+	} else {
+		return "", args
+	}
+}
+
+// lockBanner loads a banner with its heroes & rates, and holds it
+// until tx ends, so that it cannot be changed or republished while
+// it is pulled on. It returns ErrBannerInactive unless the banner is
+// running now, whether or not ScheduleHeroBanners has switched it on
+// or off yet.
+func lockBanner(tx *sql.Tx, id int) (HeroBanner, error) {
+	banner := HeroBanner{ID: id}
+	var running bool
+
+	err := tx.QueryRow(`SELECT name, banner_type, slot, is_enabled,
+	cost_currency_id, cost_single, cost_multi, pity_soft_start,
+	pity_soft_step, pity_hard, featured_rate, COALESCE(spark_currency_id, 0),
+	spark_per_pull, spark_cost, spark_on_end,
+	COALESCE(spark_convert_currency_id, 0), spark_convert_rate,
+	COALESCE(spark_settled_at::text, ''), `+bannerRunning+` FROM
+	hero_banner WHERE id = $1 FOR SHARE`, id,
+	).Scan(&banner.Name, &banner.BannerType, &banner.Slot,
+		&banner.IsEnabled, &banner.CostCurrencyID, &banner.CostSingle,
+		&banner.CostMulti, &banner.PitySoftStart, &banner.PitySoftStep,
+		&banner.PityHard, &banner.FeaturedRate, &banner.Spark.CurrencyID,
+		&banner.Spark.PerPull, &banner.Spark.Cost, &banner.Spark.OnEnd,
+		&banner.Spark.ConvertCurrencyID, &banner.Spark.ConvertRate,
+		&banner.Spark.SettledAt, &running)
+	if err == sql.ErrNoRows {
+		return banner, errors.New("Banner not found")
+	} else if err != nil {
+		return banner, err
+	} else if !running {
+		return banner, ErrBannerInactive
+	}
+	banner.IsActive = true
+
+	if err = banner.readHeroes(tx); err != nil {
+		return banner, err
+	} else if err = banner.readRates(tx); err != nil {
+		return banner, err
+	}
+
+	return banner, nil
+}
+
+// Summon.create applies the duplicate policy to a Summon, inserts it
+// and copies its hero's base stats to its summon stats.
+func (summon *Summon) create(tx *sql.Tx) error {
+	if summon.Source == "" {
+		summon.Source = SummonPull
+	}
+
+	if err := summon.applyDuplicate(tx); err != nil {
+		return err
+	}
+	summon.IsActive = summon.DuplicatePolicy != DuplicateLimitBreak &&
+		summon.DuplicatePolicy != DuplicateConvert
+
+	if err := tx.QueryRow(`INSERT INTO summon (transaction_id, player_id,
+	hero_id, hero_banner_id, rarity, is_featured, source, pity_count,
+	pity_guaranteed, player_seed_id, draw_index, table_hash,
+	duplicate_policy, duplicate_of, duplicate_transaction_id, is_active)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, 0),
+	CASE WHEN $10 = 0 THEN NULL ELSE $11::bigint END, NULLIF($12, ''),
+	NULLIF($13, ''), NULLIF($14, 0), NULLIF($15, 0), $16)
+	RETURNING id, level, is_active, created_at`, summon.TransactionID,
+		summon.PlayerID, summon.HeroID, summon.HeroBannerID, summon.Rarity,
+		summon.IsFeatured, summon.Source, summon.PityCount,
+		summon.PityGuaranteed, summon.PlayerSeedID, summon.DrawIndex,
+		summon.TableHash, summon.DuplicatePolicy, summon.DuplicateOfID,
+		summon.DuplicateTransactionID, summon.IsActive,
+	).Scan(&summon.ID, &summon.Level, &summon.IsActive,
+		&summon.CreatedAt); err != nil {
+		return err
+	}
+
+	stats := &summon.Stats
+	return tx.QueryRow(`INSERT INTO summon_stats (summon_id, attack,
+	crit_chance, crit_damage, hit_chance, effectiveness, health, defence,
+	evasion, resistance) SELECT $1, attack, crit_chance, crit_damage,
+	hit_chance, effectiveness, health, defence, evasion, resistance FROM
+	hero_base_stat WHERE hero_id = $2 RETURNING attack, crit_chance,
+	crit_damage, hit_chance, effectiveness, health, defence, evasion,
+	resistance`, summon.ID, summon.HeroID,
+	).Scan(&stats.Attack, &stats.CritChance, &stats.CritDamage,
+		&stats.HitChance, &stats.Effectiveness, &stats.Health,
+		&stats.Defence, &stats.Evasion, &stats.Resistance)
+}
@@ -0,0 +1,138 @@
+// transaction.go contains the player transaction history, the
+// record of every change made by the player currency ledger.
+package methods
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/axkeyz/gacha-api/config"
+)
+
+//====================== PLAYER TRANSACTION ======================//
+// PlayerTransaction is a single change to a player's balance.
+//
+// RunningBalance is the player's balance of the currency after
+// the change. Each transaction links back to what caused it: the
+// summons it paid for, the lot it granted or the exchange that it
+// was part of.
+//
+// This is directly mapped to the player_transaction table.
+//================================================================//
+type PlayerTransaction struct {
+	ID               int      `json:",omitempty"`
+	PlayerID         int      `json:",omitempty"`
+	Player           Player   `json:",omitempty"`
+	CurrencyID       int      `query:"currency_id" json:",omitempty"`
+	Currency         Currency `json:",omitempty"`
+	Change           int      `json:",omitempty"`
+	PaidChange       int      `json:",omitempty"`
+	FreeChange       int      `json:",omitempty"`
+	RunningBalance   int      `json:",omitempty"`
+	Reason           string   `query:"reason" json:",omitempty"`
+	SummonIDs        []int64  `json:",omitempty"`
+	LotID            int      `json:",omitempty"`
+	PlayerExchangeID int      `json:",omitempty"`
+	CreatedAt        string   `json:",omitempty"`
+	From             string   `query:"from" json:"-"`
+	To               string   `query:"to" json:"-"`
+	Pagination
+}
+
+// PlayerTransaction.Read returns the transactions of the player
+// filter.PlayerID that fit the filter's currency, reason & date
+// range (From inclusive, To exclusive).
+func (filter *PlayerTransaction) Read() ([]PlayerTransaction, error) {
+	var transactions []PlayerTransaction
+	var transaction PlayerTransaction
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	// Setup query. The running balance is calculated over all of the
+	// player's transactions, before the filters are applied.
+	main := `SELECT * FROM (SELECT player_transaction.id,
+	player_transaction.player_id, player_transaction.currency_id,
+	currency.name AS currency, change, paid_change, free_change,
+	SUM(change) OVER (PARTITION BY player_transaction.currency_id
+	ORDER BY player_transaction.id) AS running_balance, reason,
+	ARRAY(SELECT summon.id FROM summon WHERE summon.transaction_id =
+	player_transaction.id ORDER BY summon.id) AS summon_ids,
+	COALESCE(player_currency_lot.id, 0) AS lot_id,
+	COALESCE(player_exchange_id, 0) AS player_exchange_id,
+	player_transaction.created_at FROM player_transaction
+	INNER JOIN currency ON currency.id = player_transaction.currency_id
+	LEFT JOIN player_currency_lot ON player_currency_lot.transaction_id
+	= player_transaction.id WHERE player_transaction.player_id = $1)
+	AS history`
+	where, args := filter.Filter()
+	sort := filter.Pagination.Query()
+	if sort == "" {
+		sort = " ORDER BY id"
+	}
+
+	rows, err := db.Query(main+where+sort, args...)
+	if err != nil {
+		return transactions, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		// Save data to pointer
+		err = rows.Scan(&transaction.ID, &transaction.PlayerID,
+			&transaction.CurrencyID, &transaction.Currency.Name,
+			&transaction.Change, &transaction.PaidChange,
+			&transaction.FreeChange, &transaction.RunningBalance,
+			&transaction.Reason, pq.Array(&transaction.SummonIDs),
+			&transaction.LotID, &transaction.PlayerExchangeID,
+			&transaction.CreatedAt)
+
+		if err != nil {
+			// Display error if rows.Scan causes an error
+			return transactions, err
+		}
+
+		transactions = append(transactions, transaction)
+	}
+
+	return transactions, nil
+}
+
+// PlayerTransaction.Filter generates a WHERE query string, and its
+// arguments, given the filter parameters. The player ID is always
+// the first argument.
+func (filter *PlayerTransaction) Filter() (string, []interface{}) {
+	var items []string
+	args := []interface{}{filter.PlayerID}
+
+	if filter.CurrencyID != 0 {
+		args = append(args, filter.CurrencyID)
+		items = append(items, "currency_id = $"+strconv.Itoa(len(args)))
+	}
+
+	if filter.Reason != "" {
+		args = append(args, filter.Reason)
+		items = append(items, "reason = $"+strconv.Itoa(len(args)))
+	}
+
+	if filter.From != "" {
+		args = append(args, filter.From)
+		items = append(items, "created_at >= $"+strconv.Itoa(len(args))+
+			"::timestamp")
+	}
+
+	if filter.To != "" {
+		args = append(args, filter.To)
+		items = append(items, "created_at < $"+strconv.Itoa(len(args))+
+			"::timestamp")
+	}
+
+	if len(items) > 0 {
+		return " WHERE " + strings.Join(items, " AND "), args
+	} else {
+		return "", args
+	}
+}
@@ -0,0 +1,534 @@
+// translation.go contains the locales that game text is translated
+// into, the translations of hero, skill & currency text, and their
+// import & export as JSON or XLIFF.
+package methods
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/axkeyz/gacha-api/config"
+)
+
+// Translatable fields of game text
+const (
+	FieldHeroName         = "hero_name"
+	FieldHeroShort        = "hero_short_description"
+	FieldHeroLong         = "hero_long_description"
+	FieldSkillDescription = "skill_description"
+	FieldCurrency         = "currency_description"
+)
+
+// translationSources are the queries of the source (default locale)
+// text of each translatable field, by id.
+var translationSources = map[string]string{
+	FieldHeroName:         `SELECT id, name FROM hero`,
+	FieldHeroShort:        `SELECT hero_id, short_description FROM hero_background`,
+	FieldHeroLong:         `SELECT hero_id, long_description FROM hero_background`,
+	FieldSkillDescription: `SELECT id, description FROM hero_skill`,
+	FieldCurrency:         `SELECT id, description FROM currency`,
+}
+
+// translationFields are the translatable fields, in report order.
+var translationFields = []string{FieldHeroName, FieldHeroShort,
+	FieldHeroLong, FieldSkillDescription, FieldCurrency}
+
+// sourceText returns a query of the source text of every field, as
+// rows of field, id & text.
+func sourceText() string {
+	var sources []string
+	for _, field := range translationFields {
+		sources = append(sources, `SELECT '`+field+`' AS field, source.*
+		FROM (`+translationSources[field]+`) AS source`)
+	}
+
+	return `(SELECT field, id, COALESCE(name, '') AS text FROM (` +
+		strings.Join(sources, " UNION ALL ") + `) AS sources (field, id, name))`
+}
+
+//============================ LOCALE ============================//
+// Locale is a language (tag) that game text is translated into.
+// Text that is not translated into a locale falls back to its
+// Fallback locale, and so on, and then to the source text: the text
+// of the Default locale, which is stored with heroes, skills &
+// currencies themselves.
+//
+// This is directly mapped to the locale table.
+//================================================================//
+type Locale struct {
+	Code      string `json:",omitempty"`
+	Name      string `json:",omitempty"`
+	Fallback  string `json:",omitempty"`
+	IsDefault bool   `json:",omitempty"`
+	CreatedAt string `json:",omitempty"`
+	UpdatedAt string `json:",omitempty"`
+}
+
+// ReadLocales returns every locale.
+func ReadLocales() ([]Locale, error) {
+	var locales []Locale
+	var locale Locale
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT code, name, COALESCE(fallback, ''),
+	is_default, created_at, updated_at FROM locale ORDER BY NOT is_default,
+	code`)
+	if err != nil {
+		return locales, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err = rows.Scan(&locale.Code, &locale.Name, &locale.Fallback,
+			&locale.IsDefault, &locale.CreatedAt,
+			&locale.UpdatedAt); err != nil {
+			return locales, err
+		}
+
+		locales = append(locales, locale)
+	}
+
+	return locales, nil
+}
+
+// Locale.Save creates or updates the name & fallback of a Locale.
+// The default locale cannot be changed.
+func (locale *Locale) Save() error {
+	if !languagePattern.MatchString(locale.Code) {
+		return errors.New("Locale code must be a language tag, e.g. en or pt-BR")
+	} else if locale.Name == "" {
+		return errors.New("Locale name cannot be empty")
+	} else if locale.Fallback == locale.Code {
+		return errors.New("Locales cannot fall back to themselves")
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Serialise changes to fallbacks, so that cycles are not created
+	if _, err = tx.Exec(`LOCK TABLE locale IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return err
+	}
+
+	if locale.Fallback != "" {
+		chain, err := localeChain(tx, locale.Fallback)
+		if err != nil {
+			return errors.New("Fallback locale not found")
+		}
+
+		for _, code := range chain {
+			if code == locale.Code {
+				return errors.New("Locale fallbacks cannot form a loop")
+			}
+		}
+	}
+
+	err = tx.QueryRow(`INSERT INTO locale (code, name, fallback) VALUES
+	($1, $2, NULLIF($3, '')) ON CONFLICT (code) DO UPDATE SET name = $2,
+	fallback = NULLIF($3, ''), updated_at = CURRENT_TIMESTAMP WHERE NOT
+	locale.is_default RETURNING is_default, created_at, updated_at`,
+		locale.Code, locale.Name, locale.Fallback,
+	).Scan(&locale.IsDefault, &locale.CreatedAt, &locale.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return errors.New("The default locale cannot be changed")
+	} else if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// localeChain returns a locale followed by its fallbacks, up to (and
+// without) the default locale, whose text is the source text.
+func localeChain(q querier, code string) ([]string, error) {
+	var chain []string
+
+	rows, err := q.Query(`WITH RECURSIVE chain (code, fallback, is_default,
+	depth) AS (SELECT code, fallback, is_default, 0 FROM locale WHERE
+	code = $1 UNION ALL SELECT locale.code, locale.fallback,
+	locale.is_default, chain.depth + 1 FROM locale INNER JOIN chain ON
+	locale.code = chain.fallback WHERE chain.depth < 10) SELECT code,
+	is_default FROM chain ORDER BY depth`, code)
+	if err != nil {
+		return chain, err
+	}
+	defer rows.Close()
+
+	found := false
+	for rows.Next() {
+		var isDefault bool
+		if err = rows.Scan(&code, &isDefault); err != nil {
+			return chain, err
+		}
+
+		found = true
+		if isDefault {
+			break
+		}
+		chain = append(chain, code)
+	}
+
+	if !found {
+		return chain, errors.New("Locale not found")
+	}
+
+	return chain, nil
+}
+
+//========================= TRANSLATION ==========================//
+// Translation is the Text of a field (e.g. a hero's name) of a
+// source (e.g. hero SourceID) in a Locale, with the Source text it
+// translates.
+//
+// Translations are Missing if the field has no text in the locale
+// (fallbacks aside), and Outdated if the source text has changed
+// since it was translated.
+//
+// This is directly mapped to the translation table.
+//================================================================//
+type Translation struct {
+	Locale    string `query:"locale" json:",omitempty"`
+	Field     string `query:"field" json:",omitempty"`
+	SourceID  int    `query:"source_id" json:",omitempty"`
+	Source    string `json:",omitempty"`
+	Text      string `json:",omitempty"`
+	Missing   bool   `query:"missing" json:",omitempty"`
+	Outdated  bool   `json:",omitempty"`
+	UpdatedBy int    `json:",omitempty"`
+	UpdatedAt string `json:",omitempty"`
+}
+
+// Translation.Read returns every translatable field of a locale that
+// fits the filter, with its translation if any. If Missing is set,
+// only missing & outdated translations are returned.
+func (filter *Translation) Read() ([]Translation, error) {
+	var translations []Translation
+
+	if filter.Field != "" && translationSources[filter.Field] == "" {
+		return translations, errors.New("Unknown translation field")
+	}
+
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	if _, err := localeChain(db, filter.Locale); err != nil {
+		return translations, err
+	}
+
+	rows, err := db.Query(`SELECT source.field, source.id, source.text,
+	COALESCE(translation.text, ''), translation.text IS NULL,
+	COALESCE(translation.source_text != source.text, false),
+	COALESCE(translation.updated_by, 0),
+	COALESCE(translation.updated_at::text, '') FROM `+sourceText()+`
+	AS source LEFT JOIN translation ON translation.locale = $1 AND
+	translation.field = source.field AND translation.source_id = source.id
+	WHERE (source.field = $2 OR $2 = '') AND (source.id = $3 OR $3 = 0) AND
+	(NOT $4 OR translation.text IS NULL OR
+	translation.source_text != source.text)
+	ORDER BY source.field, source.id`, filter.Locale, filter.Field,
+		filter.SourceID, filter.Missing)
+	if err != nil {
+		return translations, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		translation := Translation{Locale: filter.Locale}
+		if err = rows.Scan(&translation.Field, &translation.SourceID,
+			&translation.Source, &translation.Text, &translation.Missing,
+			&translation.Outdated, &translation.UpdatedBy,
+			&translation.UpdatedAt); err != nil {
+			return translations, err
+		}
+
+		translations = append(translations, translation)
+	}
+
+	return translations, nil
+}
+
+// SaveTranslations creates or replaces translations into a locale,
+// and returns how many were saved. Translations without text are
+// removed. The default locale cannot be translated into.
+func SaveTranslations(locale string, translations []Translation, staffID int) (int, error) {
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if chain, err := localeChain(tx, locale); err != nil {
+		return 0, err
+	} else if len(chain) == 0 {
+		return 0, errors.New("The default locale is the source text")
+	}
+
+	for _, translation := range translations {
+		name := translation.Field + " " + strconv.Itoa(translation.SourceID)
+		if translationSources[translation.Field] == "" {
+			return 0, errors.New("Unknown translation field " + translation.Field)
+		}
+
+		var source string
+		if err = tx.QueryRow(`SELECT text FROM `+sourceText()+` AS source
+		WHERE field = $1 AND id = $2`, translation.Field,
+			translation.SourceID).Scan(&source); err == sql.ErrNoRows {
+			return 0, errors.New("Source text of " + name + " not found")
+		} else if err != nil {
+			return 0, err
+		}
+
+		if translation.Text == "" {
+			_, err = tx.Exec(`DELETE FROM translation WHERE locale = $1 AND
+			field = $2 AND source_id = $3`, locale, translation.Field,
+				translation.SourceID)
+		} else {
+			_, err = tx.Exec(`INSERT INTO translation (locale, field,
+			source_id, text, source_text, updated_by) VALUES ($1, $2, $3, $4,
+			$5, $6) ON CONFLICT (locale, field, source_id) DO UPDATE SET
+			text = $4, source_text = $5, updated_by = $6, updated_at =
+			CURRENT_TIMESTAMP`, locale, translation.Field,
+				translation.SourceID, translation.Text, source, staffID)
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(translations), tx.Commit()
+}
+
+// readLocalised returns the text of a field in a locale, by source
+// id. Sources without a translation in the locale or its fallbacks
+// are left out.
+func readLocalised(q querier, locale, field string) (map[int]string, error) {
+	texts := make(map[int]string)
+
+	chain, err := localeChain(q, locale)
+	if err != nil {
+		return texts, err
+	}
+
+	// Fallbacks first, so that more specific locales replace them
+	for i := len(chain) - 1; i >= 0; i-- {
+		rows, err := q.Query(`SELECT source_id, text FROM translation WHERE
+		locale = $1 AND field = $2`, chain[i], field)
+		if err != nil {
+			return texts, err
+		}
+
+		for rows.Next() {
+			var id int
+			var text string
+			if err = rows.Scan(&id, &text); err != nil {
+				rows.Close()
+				return texts, err
+			}
+			texts[id] = text
+		}
+		rows.Close()
+	}
+
+	return texts, nil
+}
+
+// localiseHeroes replaces the names, backgrounds & skill
+// descriptions of heroes with their text in a locale.
+func localiseHeroes(q querier, heroes []Hero, locale string) error {
+	fields := make(map[string]map[int]string)
+	for _, field := range []string{FieldHeroName, FieldHeroShort,
+		FieldHeroLong, FieldSkillDescription} {
+		texts, err := readLocalised(q, locale, field)
+		if err != nil {
+			return err
+		}
+		fields[field] = texts
+	}
+
+	for i := range heroes {
+		hero := &heroes[i]
+		localise(&hero.Name, fields[FieldHeroName], hero.ID)
+		localise(&hero.Background.ShortDescription, fields[FieldHeroShort],
+			hero.ID)
+		localise(&hero.Background.LongDescription, fields[FieldHeroLong],
+			hero.ID)
+
+		for j := range hero.Skills {
+			skill := &hero.Skills[j]
+			localise(&skill.Description, fields[FieldSkillDescription],
+				skill.ID)
+		}
+	}
+
+	return nil
+}
+
+// localiseCurrencies replaces the descriptions of currencies with
+// their text in a locale.
+func localiseCurrencies(q querier, currencies []Currency, locale string) error {
+	texts, err := readLocalised(q, locale, FieldCurrency)
+	if err != nil {
+		return err
+	}
+
+	for i := range currencies {
+		localise(&currencies[i].Description, texts, currencies[i].ID)
+	}
+
+	return nil
+}
+
+// localise replaces text with its translation by id, if any.
+func localise(text *string, texts map[int]string, id int) {
+	if translated, ok := texts[id]; ok {
+		*text = translated
+	}
+}
+
+//======================== IMPORT & EXPORT =======================//
+// Translations are exported & imported as JSON (a list of
+// Translations) or as XLIFF 1.2, where each trans-unit is identified
+// by its field & source id (e.g. hero_name.12).
+//================================================================//
+
+// Formats of exported translations
+const (
+	FormatJSON  = "json"
+	FormatXLIFF = "xliff"
+)
+
+// xliff is an XLIFF 1.2 document with one file.
+type xliff struct {
+	XMLName xml.Name  `xml:"urn:oasis:names:tc:xliff:document:1.2 xliff"`
+	Version string    `xml:"version,attr"`
+	File    xliffFile `xml:"file"`
+}
+
+// xliffFile is the file of an XLIFF document.
+type xliffFile struct {
+	Original       string      `xml:"original,attr"`
+	SourceLanguage string      `xml:"source-language,attr"`
+	TargetLanguage string      `xml:"target-language,attr"`
+	DataType       string      `xml:"datatype,attr"`
+	Units          []xliffUnit `xml:"body>trans-unit"`
+}
+
+// xliffUnit is a translation in an XLIFF document.
+type xliffUnit struct {
+	ID     string `xml:"id,attr"`
+	Source string `xml:"source"`
+	Target string `xml:"target,omitempty"`
+}
+
+// Translation.Export returns the translations that fit the filter
+// (see Translation.Read) as a JSON or XLIFF document.
+func (filter *Translation) Export(format string) ([]byte, error) {
+	translations, err := filter.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatJSON, "":
+		if translations == nil {
+			translations = []Translation{}
+		}
+		return json.MarshalIndent(translations, "", "  ")
+	case FormatXLIFF:
+		document := xliff{Version: "1.2", File: xliffFile{
+			Original:       "gacha-api",
+			SourceLanguage: defaultLocale(),
+			TargetLanguage: filter.Locale,
+			DataType:       "plaintext",
+		}}
+
+		for _, translation := range translations {
+			document.File.Units = append(document.File.Units, xliffUnit{
+				ID: translation.Field + "." +
+					strconv.Itoa(translation.SourceID),
+				Source: translation.Source,
+				Target: translation.Text,
+			})
+		}
+
+		encoded, err := xml.MarshalIndent(document, "", "  ")
+		return append([]byte(xml.Header), encoded...), err
+	}
+
+	return nil, errors.New("Export format must be json or xliff")
+}
+
+// ImportTranslations saves the translations of a JSON or XLIFF
+// document (see Translation.Export) into a locale, and returns how
+// many were saved. Translations without text are skipped, so that
+// partly translated documents do not remove translations, and
+// documents of another locale are rejected.
+func ImportTranslations(locale string, data []byte, staffID int) (int, error) {
+	var translations []Translation
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '<' {
+		var document xliff
+		if err := xml.Unmarshal(data, &document); err != nil {
+			return 0, errors.New("Translations must be JSON or XLIFF 1.2")
+		} else if target := document.File.TargetLanguage; target != "" &&
+			target != locale {
+			return 0, errors.New("XLIFF target language is " + target)
+		}
+
+		for _, unit := range document.File.Units {
+			dot := strings.LastIndex(unit.ID, ".")
+			id, err := strconv.Atoi(unit.ID[dot+1:])
+			if dot < 0 || err != nil {
+				return 0, errors.New("Invalid trans-unit id " + unit.ID)
+			}
+
+			translations = append(translations, Translation{
+				Field: unit.ID[:dot], SourceID: id, Text: unit.Target,
+			})
+		}
+	} else if err := json.Unmarshal(data, &translations); err != nil {
+		return 0, errors.New("Translations must be JSON or XLIFF 1.2")
+	}
+
+	var translated []Translation
+	for _, translation := range translations {
+		if translation.Locale != "" && translation.Locale != locale {
+			return 0, errors.New("Translation locale is " + translation.Locale)
+		} else if translation.Text != "" {
+			translated = append(translated, translation)
+		}
+	}
+
+	return SaveTranslations(locale, translated, staffID)
+}
+
+// defaultLocale returns the code of the default locale.
+func defaultLocale() string {
+	// Setup database
+	db := config.SetupDB()
+	defer db.Close()
+
+	code := "en"
+	db.QueryRow(`SELECT code FROM locale WHERE is_default`).Scan(&code)
+	return code
+}
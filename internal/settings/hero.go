@@ -0,0 +1,70 @@
+// hero.go contains the routes for managing the hero catalogue.
+package settings
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/hero"
+)
+
+// Non-public facing routes for the hero catalogue
+func HeroRoutes(a *echo.Group) {
+	a.GET("/heroes", hero.IndexHeroes)
+	a.POST("/heroes/new", hero.CreateHero)
+	a.GET("/heroes/:id", hero.ReadHero)
+	a.POST("/heroes/:id", hero.UpdateHero)
+	a.GET("/heroes/:id/skills/:skill/multiplier", hero.ReadSkillMultiplier)
+	a.POST("/heroes/:id/skills/:skill/multiplier", hero.UpdateSkillMultiplier)
+	a.GET("/heroes/:id/skills/:skill/actions", hero.ReadSkillActions)
+	a.POST("/heroes/:id/skills/:skill/actions", hero.UpdateSkillActions)
+	a.GET("/heroes/:id/revisions", hero.IndexRevisions)
+	a.POST("/heroes/:id/revisions", hero.CreateRevision)
+	a.GET("/heroes/:id/revisions/:revision", hero.ReadRevision)
+	a.POST("/heroes/:id/revisions/:revision", hero.UpdateRevision)
+	a.POST("/heroes/:id/revisions/:revision/approve", hero.ApproveRevision)
+	a.POST("/heroes/:id/revisions/:revision/publish", hero.PublishRevision)
+	a.POST("/heroes/:id/revisions/:revision/rollback", hero.RollbackRevision)
+
+	a.GET("/art", hero.IndexArt)
+	a.POST("/art/new", hero.UploadArt)
+	a.GET("/art/:id", hero.ReadArt)
+	a.DELETE("/art/:id", hero.DeleteArt)
+	a.POST("/art/:id/links", hero.LinkArt)
+	a.DELETE("/art/:id/links/:link", hero.UnlinkArt)
+
+	a.GET("/sounds", hero.IndexSounds)
+	a.POST("/sounds/new", hero.UploadSound)
+	a.GET("/sounds/:id", hero.ReadSound)
+	a.POST("/sounds/:id", hero.UpdateSound)
+	a.DELETE("/sounds/:id", hero.DeleteSound)
+
+	a.GET("/locales", hero.IndexLocales)
+	a.POST("/locales/:code", hero.SaveLocale)
+	a.GET("/translations/:locale", hero.IndexTranslations)
+	a.POST("/translations/:locale", hero.SaveTranslations)
+	a.GET("/translations/:locale/export", hero.ExportTranslations)
+	a.POST("/translations/:locale/import", hero.ImportTranslations)
+
+	a.GET("/growth", hero.IndexGrowthCurves)
+	a.POST("/growth", hero.SaveGrowthCurve)
+	a.GET("/growth/drift", hero.CheckGrowthDrift)
+	a.DELETE("/growth/:id", hero.DeleteGrowthCurve)
+
+	a.GET("/skill-actions", hero.IndexActions)
+	a.GET("/skill-actions/types", hero.IndexActionTypes)
+	a.POST("/skill-actions/new", hero.CreateAction)
+	a.GET("/skill-actions/:id", hero.ReadAction)
+	a.POST("/skill-actions/:id", hero.UpdateAction)
+	a.DELETE("/skill-actions/:id", hero.DeleteAction)
+
+	a.GET("/advantages", hero.IndexElementAdvantages)
+	a.POST("/advantages/:attacker/:defender", hero.UpdateElementAdvantage)
+	a.GET("/damage", hero.CalculateDamage)
+	a.GET("/battles/simulate", hero.SimulateBattles)
+
+	a.GET("/references/:kind", hero.IndexReferences)
+	a.POST("/references/:kind/new", hero.CreateReference)
+	a.GET("/references/:kind/:id", hero.ReadReference)
+	a.POST("/references/:kind/:id", hero.UpdateReference)
+	a.DELETE("/references/:kind/:id", hero.DeleteReference)
+}
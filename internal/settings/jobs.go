@@ -0,0 +1,99 @@
+// jobs.go contains the background jobs of the API.
+package settings
+
+import (
+	"log"
+	"os"
+	"time"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// RegisterJobs starts the background jobs.
+func RegisterJobs() {
+	go every(time.Minute, expireCurrencyLots)
+	go every(time.Minute, scheduleHeroBanners)
+	go every(time.Minute, settleBannerSparks)
+	go every(time.Hour, checkSummonDrift)
+	go every(24*time.Hour, checkSummonStats)
+}
+
+// every runs job once per interval, forever.
+func every(interval time.Duration, job func()) {
+	for range time.Tick(interval) {
+		job()
+	}
+}
+
+// expireCurrencyLots removes expired currency lots from player balances.
+func expireCurrencyLots() {
+	count, err := methods.ExpireCurrencyLots()
+	if err != nil {
+		log.Println(err)
+	}
+
+	if count > 0 {
+		log.Printf("Expired %d currency lots", count)
+	}
+}
+
+// scheduleHeroBanners switches hero banners on & off by their run times.
+func scheduleHeroBanners() {
+	if switched, err := methods.ScheduleHeroBanners(); err != nil {
+		log.Println(err)
+	} else if len(switched) > 0 {
+		log.Printf("Switched hero banners %v", switched)
+	}
+}
+
+// settleBannerSparks expires or converts left over spark points of
+// ended hero banners.
+func settleBannerSparks() {
+	settled, err := methods.SettleBannerSparks()
+	if err != nil {
+		log.Println(err)
+	}
+
+	if len(settled) > 0 {
+		log.Printf("Settled spark points of hero banners %v", settled)
+	}
+}
+
+// checkSummonDrift alerts when the rarities pulled from a banner drift
+// from its rates. Alerts are logged, and posted to DRIFT_WEBHOOK_URL
+// if it is set.
+func checkSummonDrift() {
+	alerts, err := methods.CheckSummonDrift()
+	if err != nil {
+		log.Println(err)
+	}
+
+	for _, alert := range alerts {
+		log.Printf("Summon drift on hero banner %d over %dh: %d pulls, "+
+			"chi-square %.2f (df %d), p = %.2g, observed %v, expected %v",
+			alert.HeroBannerID, alert.WindowHours, alert.Pulls,
+			alert.ChiSquare, alert.DF, alert.PValue, alert.Observed,
+			alert.Expected)
+	}
+
+	if url := os.Getenv("DRIFT_WEBHOOK_URL"); url != "" && len(alerts) > 0 {
+		if err = methods.SendDriftAlerts(url, alerts); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// checkSummonStats logs the summons whose stored stats have drifted
+// from their growth curves.
+func checkSummonStats() {
+	drifts, err := methods.CheckSummonStats()
+	if err != nil {
+		log.Println(err)
+	}
+
+	for _, drift := range drifts {
+		log.Printf("Summon %d (hero %d, level %d) stats drifted: "+
+			"expected %+v, stored %+v", drift.SummonID, drift.HeroID,
+			drift.Level, drift.Expected, drift.Actual)
+	}
+}
@@ -47,4 +47,24 @@ var adminJWT = middleware.JWTConfig{
 
 func AdminMiddleware(g *echo.Group) {
 	g.Use(middleware.JWTWithConfig(adminJWT))
+	g.Use(requireToken(true))
+}
+
+// PlayerMiddleware authenticates players on player-facing routes,
+// with the same JWT tokens as staff.
+func PlayerMiddleware(g *echo.Group) {
+	g.Use(middleware.JWTWithConfig(adminJWT))
+	g.Use(requireToken(false))
+}
+
+// requireToken only lets staff tokens (or only player tokens) through.
+func requireToken(staff bool) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if methods.CurrentAuthStaff(c.Get("user")).Staff != staff {
+				return echo.ErrUnauthorized
+			}
+			return next(c)
+		}
+	}
 }
\ No newline at end of file
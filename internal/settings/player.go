@@ -0,0 +1,35 @@
+// player.go contains the routes for managing players.
+package settings
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/player"
+)
+
+// Non-public facing routes for managing players
+func PlayerRoutes(a *echo.Group) {
+	a.GET("/players/:id", player.ReadPlayer)
+	a.GET("/players/:id/currency", player.IndexPlayerCurrency)
+	a.POST("/players/:id/currency", player.IssuePlayerCurrency)
+	a.GET("/players/:id/transactions", player.IndexPlayerTransactions)
+	a.GET("/players/:id/summons", player.IndexPlayerSummons)
+	a.POST("/players/:id/summons/:summon/level", player.LevelPlayerSummon)
+	a.POST("/players/:id/refund", player.RefundPlayerSummons)
+	a.POST("/players/:id/exchange", player.ExecutePlayerExchange)
+	a.POST("/players/:id/summon", player.SummonPlayerHeroes)
+	a.POST("/players/:id/spark", player.SparkPlayerHero)
+	a.GET("/players/:id/seeds", player.IndexPlayerSeeds)
+	a.POST("/players/:id/seeds", player.RotatePlayerSeed)
+	a.GET("/summons/:id/verify", player.VerifyPlayerSummon)
+}
+
+// Public-facing routes for players to log in
+func AuthenticatePlayer(e *echo.Echo) {
+	e.POST("/login", player.AuthenticatePlayer)
+}
+
+// Routes for the authenticated player
+func PlayerFacingRoutes(p *echo.Group) {
+	p.GET("/summons", player.IndexOwnSummons)
+}
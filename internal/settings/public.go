@@ -4,6 +4,10 @@ package settings
 import (
 	"net/http"
     "github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/hero"
+	"github.com/axkeyz/gacha-api/internal/storage"
+	"github.com/axkeyz/gacha-api/resources"
 )
 
 // PublicRoutes contains the public routes
@@ -11,4 +15,12 @@ func PublicRoutes(e *echo.Echo) {
 	e.GET("/", func(c echo.Context) error {       
 		return c.String(http.StatusOK, "Hello, World!\n")  
 	})
+
+	e.GET("/banners", resources.IndexRunningBanners)
+	e.GET("/banners/:id/odds", resources.ReadBannerOdds)
+	e.GET("/references/:kind", hero.IndexReferences)
+
+	// Uploaded art & sound in local storage
+	assets := storage.NewLocal()
+	e.Static(assets.BaseURL, assets.Root)
 }
\ No newline at end of file
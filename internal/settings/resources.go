@@ -0,0 +1,32 @@
+// resources.go contains the routes for managing game resources.
+package settings
+
+import (
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/resources"
+)
+
+// Non-public facing routes for game resources
+func ResourceRoutes(a *echo.Group) {
+	a.GET("/currency", resources.IndexCurrency)
+	a.POST("/currency/new", resources.CreateCurrency)
+	a.GET("/currency/report", resources.ReportCurrency)
+	a.GET("/currency/:id", resources.ReadCurrency)
+	a.POST("/currency/:id", resources.UpdateCurrency)
+
+	a.GET("/exchanges", resources.IndexExchanges)
+	a.POST("/exchanges/new", resources.CreateExchange)
+	a.GET("/exchanges/:id", resources.ReadExchange)
+	a.POST("/exchanges/:id", resources.UpdateExchange)
+
+	a.GET("/banners", resources.IndexBanners)
+	a.POST("/banners/new", resources.CreateBanner)
+	a.GET("/banners/:id", resources.ReadBanner)
+	a.POST("/banners/:id", resources.UpdateBanner)
+	a.DELETE("/banners/:id", resources.DeleteBanner)
+	a.GET("/banners/:id/simulate", resources.SimulateBanner)
+
+	a.GET("/duplicates", resources.IndexDuplicatePolicies)
+	a.POST("/duplicates/:rarity", resources.UpdateDuplicatePolicy)
+}
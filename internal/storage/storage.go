@@ -0,0 +1,148 @@
+// storage.go contains the storage of uploaded files (art & sound),
+// and its local filesystem implementation.
+package storage
+
+import (
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound is returned when a stored file does not exist.
+var ErrNotFound = errors.New("File not found")
+
+//=========================== STORAGE ============================//
+// Storage stores files by name. Names are slash-separated paths
+// (e.g. art/<hash>.png) and are the same for every implementation,
+// so stored files can be moved between them.
+//================================================================//
+type Storage interface {
+	// Save stores data under name, replacing any file with the name.
+	Save(name string, data []byte) error
+	// Open returns the data stored under name.
+	Open(name string) ([]byte, error)
+	// Exists returns true if a file is stored under name.
+	Exists(name string) (bool, error)
+	// Delete removes the file stored under name, if any.
+	Delete(name string) error
+	// URL returns the URL that the file stored under name is served at.
+	URL(name string) string
+}
+
+//============================ LOCAL =============================//
+// Local stores files under the Root directory of the local
+// filesystem, and serves them at BaseURL.
+//================================================================//
+type Local struct {
+	Root    string
+	BaseURL string
+}
+
+// NewLocal returns the local storage set up by the ASSET_DIR &
+// ASSET_URL .env variables, which default to ./assets & /assets.
+func NewLocal() *Local {
+	local := &Local{
+		Root:    os.Getenv("ASSET_DIR"),
+		BaseURL: os.Getenv("ASSET_URL"),
+	}
+
+	if local.Root == "" {
+		local.Root = "assets"
+	}
+	if local.BaseURL == "" {
+		local.BaseURL = "/assets"
+	}
+
+	return local
+}
+
+// Local.Save writes the file to a temporary file first, so that a
+// partly written file is never served.
+func (local *Local) Save(name string, data []byte) error {
+	file, err := local.path(name)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(file), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err = temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	} else if err = temp.Close(); err != nil {
+		return err
+	} else if err = os.Chmod(temp.Name(), 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), file)
+}
+
+// Local.Open reads a file from the filesystem.
+func (local *Local) Open(name string) ([]byte, error) {
+	file, err := local.path(name)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+// Local.Exists returns true if the file is on the filesystem.
+func (local *Local) Exists(name string) (bool, error) {
+	file, err := local.path(name)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err = os.Stat(file); errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+// Local.Delete removes a file from the filesystem.
+func (local *Local) Delete(name string) error {
+	file, err := local.path(name)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(file); errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
+
+// Local.URL returns the URL of a file under BaseURL.
+func (local *Local) URL(name string) string {
+	return strings.TrimSuffix(local.BaseURL, "/") + "/" + name
+}
+
+// Local.path returns the path of a file on the filesystem. Names
+// cannot leave the root directory.
+func (local *Local) path(name string) (string, error) {
+	clean := path.Clean("/" + name)
+	if name == "" || clean != "/"+name {
+		return "", errors.New("Invalid file name")
+	}
+
+	return filepath.Join(local.Root, filepath.FromSlash(clean)), nil
+}
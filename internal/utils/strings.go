@@ -2,6 +2,9 @@ package utils
 
 import(
 	"regexp"
+	"errors"
+	"strconv"
+	"strings"
 	"encoding/json"
 )
 
@@ -30,4 +33,30 @@ func MapifyStruct(s interface{}) map[string]interface{} {
     json.Unmarshal(inrec, &inInterface)
 
     return inInterface
-}
\ No newline at end of file
+}
+
+// ParseIntPairs converts strings in the form "key:value" (for example
+// "currency_id:amount") to pairs of integers.
+func ParseIntPairs(pairs []string) ([][2]int, error) {
+	var parsed [][2]int
+
+	for _, pair := range pairs {
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return parsed, errors.New("Expected key:value, got " + pair)
+		}
+
+		key, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+		if err != nil {
+			return parsed, err
+		}
+		value, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			return parsed, err
+		}
+
+		parsed = append(parsed, [2]int{key, value})
+	}
+
+	return parsed, nil
+}
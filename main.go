@@ -11,15 +11,17 @@ func main() {
 	// Open .env file
 	_ = godotenv.Load()
 
-	// Register echo (public) & groups (admin & testing)
+	// Register echo (public) & groups (admin, testing & player)
 	e := echo.New()
 	a := e.Group("/admin")
 	t := e.Group("/test")
+	p := e.Group("/me")
 
 	// register middleware
 	settings.RegisterMiddlewares(e)
 	settings.AdminMiddleware(a)
 	settings.AdminMiddleware(t)
+	settings.PlayerMiddleware(p)
 
 	// Set IP address extractor
 	e.IPExtractor = echo.ExtractIPFromXFFHeader()
@@ -30,6 +32,15 @@ func main() {
 	settings.AuthenticateAdmin(e)
 	settings.TestAdminRoutes(t)
 	settings.AdminRoutes(a)
+	settings.ResourceRoutes(a)
+	settings.HeroRoutes(a)
+	settings.PlayerRoutes(a)
+
+	settings.AuthenticatePlayer(e)
+	settings.PlayerFacingRoutes(p)
+
+	// Start background jobs
+	settings.RegisterJobs()
 
 	e.Logger.Fatal(e.Start(":1588"))
 }
\ No newline at end of file
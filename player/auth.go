@@ -0,0 +1,35 @@
+// auth.go creates an API that allows authentication of players.
+package player
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// AuthenticatePlayer attempts to authenticate a player with the given
+// username & password. @POST /login
+// If the authentication is a success, a JWT token is generated. If
+// authentication failed, ErrUnauthorized is returned.
+func AuthenticatePlayer(c echo.Context) error {
+	// Create auth credentials and token
+	auth := methods.Auth{
+		Username: c.FormValue("username"),
+		Password: c.FormValue("password"),
+	}
+	token := methods.JWTToken{}
+
+	// Check if player exists
+	encodedToken, err := token.CreatePlayerToken(auth)
+	if err != nil {
+		// Unauthorised login attempt
+		c.Logger().Error(err)
+		return echo.ErrUnauthorized
+	}
+
+	return c.JSON(http.StatusOK, echo.Map{
+		"token": encodedToken,
+	})
+}
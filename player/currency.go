@@ -4,28 +4,99 @@ package player
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/axkeyz/gacha-api/internal/methods"
 	"github.com/labstack/echo/v4"
 )
 
+// IndexPlayerCurrency returns the balances of a single player
+// @ GET /admin/players/:id/currency
 func IndexPlayerCurrency(c echo.Context) error {
 	// Bind query parameters to model
-	filterStaffActions := new(methods.StaffAction)
-	if err := c.Bind(filterStaffActions); err != nil {
+	filter := new(methods.PlayerCurrency)
+	if err := c.Bind(filter); err != nil {
 		// Return the error
 		c.Logger().Error(err)
 		return echo.ErrBadRequest
 	}
+	filter.PlayerID, _ = strconv.Atoi(c.Param("id"))
 
-	// Get all applicable actions
-	actions, err := filterStaffActions.Index()
+	// Get all balances of the player
+	balances, err := filter.Read()
 	if err != nil {
 		// Return the error
 		c.Logger().Error(err)
 		return echo.NewHTTPError(http.StatusNotFound, err)
 	}
 
-	// Return actions
-	return c.JSON(http.StatusOK, actions)
+	// Return balances
+	return c.JSON(http.StatusOK, balances)
+}
+
+// IndexPlayerTransactions returns the currency history of a single
+// player, filtered by currency_id, reason and from & to dates
+// @ GET /admin/players/:id/transactions
+func IndexPlayerTransactions(c echo.Context) error {
+	// Bind query parameters to model
+	filter := new(methods.PlayerTransaction)
+	if err := c.Bind(filter); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.ErrBadRequest
+	}
+	filter.PlayerID, _ = strconv.Atoi(c.Param("id"))
+
+	// Get all applicable transactions
+	transactions, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return transactions
+	return c.JSON(http.StatusOK, transactions)
+}
+
+// IssuePlayerCurrency grants currency to a player. The grant expires
+// at expires_at, or never if expires_at is empty. is_paid marks the
+// grant as bought rather than free.
+// @ POST /admin/players/:id/currency
+func IssuePlayerCurrency(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "currency-issue"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind parameters to model
+	var currency methods.PlayerCurrency
+	currency.PlayerID, _ = strconv.Atoi(c.Param("id"))
+	currency.CurrencyID, _ = strconv.Atoi(c.FormValue("currency_id"))
+	amount, _ := strconv.Atoi(c.FormValue("amount"))
+	paid, _ := strconv.ParseBool(c.FormValue("is_paid"))
+
+	transaction, err := currency.Grant(amount, paid,
+		methods.TransactionGrant, c.FormValue("expires_at"))
+	if err != nil {
+		// Failed to grant currency
+		staffLog.Create(false, methods.Error{Details: err, Data: currency})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return transaction
+	staffLog.Create(true, methods.Error{Data: transaction})
+	return c.JSON(http.StatusOK, transaction)
 }
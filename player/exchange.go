@@ -0,0 +1,48 @@
+// exchange.go executes currency exchanges for players.
+package player
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// ExecutePlayerExchange executes a currency exchange quantity times
+// on behalf of a player @ POST /admin/players/:id/exchange
+func ExecutePlayerExchange(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "exchange-execute"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind parameters to model
+	var execution methods.PlayerExchange
+	execution.PlayerID, _ = strconv.Atoi(c.Param("id"))
+	execution.ExchangeID, _ = strconv.Atoi(c.FormValue("exchange_id"))
+	execution.Quantity, _ = strconv.Atoi(c.FormValue("quantity"))
+
+	if err := execution.Execute(); err != nil {
+		// Failed to execute exchange
+		staffLog.Create(false, methods.Error{Details: err, Data: execution})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return execution
+	staffLog.Create(true, methods.Error{Data: execution})
+	return c.JSON(http.StatusOK, execution)
+}
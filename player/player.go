@@ -0,0 +1,29 @@
+// player.go allows staff to view players.
+package player
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// ReadPlayer returns a single player, with their balances & pity
+// progress @ GET /admin/players/:id
+func ReadPlayer(c echo.Context) error {
+	var filter methods.Player
+	filter.ID, _ = strconv.Atoi(c.Param("id"))
+
+	// Get the player
+	player, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return player
+	return c.JSON(http.StatusOK, player)
+}
@@ -0,0 +1,65 @@
+// seed.go allows staff to view & rotate the random streams that
+// player summons are pulled from.
+package player
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// IndexPlayerSeeds returns a player's seeds. Active seeds only show
+// their commitment @ GET /admin/players/:id/seeds
+func IndexPlayerSeeds(c echo.Context) error {
+	var filter methods.PlayerSeed
+	filter.PlayerID, _ = strconv.Atoi(c.Param("id"))
+
+	// Get seeds
+	seeds, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return seeds
+	return c.JSON(http.StatusOK, seeds)
+}
+
+// RotatePlayerSeed reveals a player's active seed and replaces it
+// with a new one @ POST /admin/players/:id/seeds
+func RotatePlayerSeed(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "seed-rotate"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind parameters to model
+	var seed methods.PlayerSeed
+	seed.PlayerID, _ = strconv.Atoi(c.Param("id"))
+
+	if err := seed.Rotate(); err != nil {
+		// Failed to rotate
+		staffLog.Create(false, methods.Error{Details: err, Data: seed})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return new seed's commitment
+	staffLog.Create(true, methods.Error{Data: seed})
+	return c.JSON(http.StatusOK, seed)
+}
@@ -1,2 +1,291 @@
 // summon.go tracks & manages player heroes (summons).
-package player
\ No newline at end of file
+package player
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// SummonPlayerHeroes pulls 1 or 10 heroes from a banner on behalf of
+// a player, charging the banner's cost @ POST /admin/players/:id/summon
+func SummonPlayerHeroes(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "summon-create"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind parameters to model
+	var request methods.SummonRequest
+	request.PlayerID, _ = strconv.Atoi(c.Param("id"))
+	request.HeroBannerID, _ = strconv.Atoi(c.FormValue("banner_id"))
+	request.Pulls, _ = strconv.Atoi(c.FormValue("pulls"))
+
+	if err := request.Execute(); err != nil {
+		// Failed to summon
+		staffLog.Create(false, methods.Error{Details: err, Data: request})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return summons
+	staffLog.Create(true, methods.Error{Data: request})
+	return c.JSON(http.StatusOK, request)
+}
+
+// SparkPlayerHero exchanges a player's spark points for a featured
+// hero of a banner @ POST /admin/players/:id/spark
+func SparkPlayerHero(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "spark-exchange"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind parameters to model
+	var request methods.SparkRequest
+	request.PlayerID, _ = strconv.Atoi(c.Param("id"))
+	request.HeroBannerID, _ = strconv.Atoi(c.FormValue("banner_id"))
+	request.HeroID, _ = strconv.Atoi(c.FormValue("hero_id"))
+
+	if err := request.Execute(); err != nil {
+		// Failed to spark
+		staffLog.Create(false, methods.Error{Details: err, Data: request})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return sparked summon
+	staffLog.Create(true, methods.Error{Data: request})
+	return c.JSON(http.StatusOK, request)
+}
+
+// VerifyPlayerSummon re-derives a past summon from its seed & draw
+// index and checks it against the stored summon
+// @ GET /admin/summons/:id/verify
+func VerifyPlayerSummon(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "summon-verify"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	id, _ := strconv.Atoi(c.Param("id"))
+
+	verification, err := methods.VerifySummon(id)
+	if err != nil {
+		// Failed to verify
+		staffLog.Create(false, methods.Error{Details: err, Data: id})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return verification, without logging the seed
+	logged := verification
+	logged.Seed.Seed = ""
+	staffLog.Create(true, methods.Error{Data: logged})
+	return c.JSON(http.StatusOK, verification)
+}
+
+// RefundPlayerSummons refunds some of a player's summons, given as
+// repeated "summon_ids" form values. With dry_run=true, the refund is
+// only previewed @ POST /admin/players/:id/refund
+func RefundPlayerSummons(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "summon-refund"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind parameters to model
+	var refund methods.SummonRefund
+	refund.PlayerID, _ = strconv.Atoi(c.Param("id"))
+	refund.DryRun, _ = strconv.ParseBool(c.FormValue("dry_run"))
+
+	form, err := c.FormParams()
+	if err != nil {
+		return echo.ErrBadRequest
+	}
+	for _, value := range form["summon_ids"] {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, err)
+		}
+		refund.SummonIDs = append(refund.SummonIDs, id)
+	}
+
+	if err := refund.Execute(); err != nil {
+		// Failed to refund
+		staffLog.Create(false, methods.Error{Details: err, Data: refund})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return refund (or its preview)
+	staffLog.Create(true, methods.Error{Data: refund})
+	return c.JSON(http.StatusOK, refund)
+}
+
+// LevelPlayerSummon levels up one of a player's summons to the
+// "level" form value, and stores its stats at that level on its
+// growth curve @ POST /admin/players/:id/summons/:summon/level
+func LevelPlayerSummon(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "summon-level"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind parameters to model
+	var request methods.SummonLevelUp
+	request.PlayerID, _ = strconv.Atoi(c.Param("id"))
+	request.SummonID, _ = strconv.Atoi(c.Param("summon"))
+	request.Level, _ = strconv.Atoi(c.FormValue("level"))
+
+	if err := request.Execute(); err != nil {
+		// Failed to level up
+		staffLog.Create(false, methods.Error{Details: err, Data: request})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return summon
+	staffLog.Create(true, methods.Error{Data: request})
+	return c.JSON(http.StatusOK, request.Summon)
+}
+
+// IndexPlayerSummons returns a player's summon history, filtered by
+// ?banner_id & ?from / ?to dates, as JSON or as CSV (?format=csv)
+// @ GET /admin/players/:id/summons
+func IndexPlayerSummons(c echo.Context) error {
+	// Bind query parameters to model
+	filter := new(methods.Summon)
+	if err := c.Bind(filter); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.ErrBadRequest
+	}
+	filter.PlayerID, _ = strconv.Atoi(c.Param("id"))
+
+	return indexSummons(c, filter)
+}
+
+// IndexOwnSummons returns the summon history of the authenticated
+// player, in the same way as IndexPlayerSummons @ GET /me/summons
+func IndexOwnSummons(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+
+	// Bind only the query parameters players may filter & sort by
+	filter := &methods.Summon{
+		PlayerID: user.ID,
+		From:     c.QueryParam("from"),
+		To:       c.QueryParam("to"),
+	}
+	filter.HeroBannerID, _ = strconv.Atoi(c.QueryParam("banner_id"))
+	filter.SortBy, filter.SortDir = c.QueryParam("sortby"), c.QueryParam("dir")
+	filter.Limit, _ = strconv.Atoi(c.QueryParam("limit"))
+	filter.Offset, _ = strconv.Atoi(c.QueryParam("offset"))
+
+	return indexSummons(c, filter)
+}
+
+// indexSummons returns the summons that fit filter as JSON, or as CSV
+// if ?format=csv.
+func indexSummons(c echo.Context, filter *methods.Summon) error {
+	// Get all applicable summons
+	summons, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	if c.QueryParam("format") != "csv" {
+		// Return summons
+		return c.JSON(http.StatusOK, summons)
+	}
+
+	// Return summons as a CSV download
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv")
+	c.Response().Header().Set(echo.HeaderContentDisposition,
+		`attachment; filename="summons.csv"`)
+	c.Response().WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(c.Response())
+	w.Write([]string{"id", "created_at", "banner_id", "banner", "hero_id",
+		"hero", "rarity", "is_featured", "source", "pity_count",
+		"pity_guaranteed", "duplicate_policy", "transaction_id",
+		"currency", "cost", "deleted_at"})
+
+	for _, summon := range summons {
+		w.Write([]string{
+			strconv.Itoa(summon.ID), summon.CreatedAt,
+			strconv.Itoa(summon.HeroBannerID), summon.HeroBanner.Name,
+			strconv.Itoa(summon.HeroID), summon.Hero.Name,
+			strconv.Itoa(summon.Rarity), strconv.FormatBool(summon.IsFeatured),
+			summon.Source, strconv.Itoa(summon.PityCount),
+			strconv.FormatBool(summon.PityGuaranteed), summon.DuplicatePolicy,
+			strconv.Itoa(summon.TransactionID),
+			summon.Transaction.Currency.Name,
+			strconv.Itoa(summon.Cost), summon.DeletedAt,
+		})
+	}
+
+	w.Flush()
+	return w.Error()
+}
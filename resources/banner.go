@@ -1,2 +1,301 @@
 // banner.go manages CRUD operations for a new hero banner.
-package resources
\ No newline at end of file
+package resources
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/gacha"
+	"github.com/axkeyz/gacha-api/internal/methods"
+	"github.com/axkeyz/gacha-api/internal/utils"
+)
+
+// IndexBanners returns a list of all hero banners
+// @ GET /admin/banners
+func IndexBanners(c echo.Context) error {
+	// Bind query parameters to model
+	filter := new(methods.HeroBanner)
+	if err := c.Bind(filter); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.ErrBadRequest
+	}
+
+	// Get all applicable banners
+	banners, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return banners
+	return c.JSON(http.StatusOK, banners)
+}
+
+// IndexRunningBanners returns a list of the hero banners that are
+// currently running @ GET /banners
+func IndexRunningBanners(c echo.Context) error {
+	filter := methods.HeroBanner{IsActive: true}
+
+	// Get all running banners
+	banners, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return banners
+	return c.JSON(http.StatusOK, banners)
+}
+
+// ReadBannerOdds returns the published odds of a hero banner: the
+// latest version, or the given ?version @ GET /banners/:id/odds
+func ReadBannerOdds(c echo.Context) error {
+	var filter methods.HeroBannerOdds
+	filter.HeroBannerID, _ = strconv.Atoi(c.Param("id"))
+	filter.Version, _ = strconv.Atoi(c.QueryParam("version"))
+
+	// Get the odds
+	versions, err := filter.Read()
+	if err != nil || len(versions) == 0 {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return odds
+	return c.JSON(http.StatusOK, versions[0])
+}
+
+// CreateBanner creates a new hero banner. Featured heroes are given
+// as repeated "hero_id:weight" form values (featured heroes are also
+// listed as "featured" form values), and the loot table as repeated
+// "rarity:percent" rates form values
+// @ POST /admin/banners/new
+func CreateBanner(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "banner-create"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	banner, err := bindBanner(c)
+	if err == nil {
+		err = banner.Create()
+	}
+
+	if err != nil {
+		// Failed to create banner
+		staffLog.Create(false, methods.Error{Details: err, Data: banner})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return banner
+	staffLog.Create(true, methods.Error{Data: banner})
+	return c.JSON(http.StatusOK, banner)
+}
+
+// ReadBanner returns a single hero banner
+// @ GET /admin/banners/:id
+func ReadBanner(c echo.Context) error {
+	var filter methods.HeroBanner
+	filter.ID, _ = strconv.Atoi(c.Param("id"))
+
+	// Get the banner
+	banners, err := filter.Read()
+	if err != nil || len(banners) == 0 {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return banner
+	return c.JSON(http.StatusOK, banners[0])
+}
+
+// SimulateBanner runs a Monte Carlo simulation of pulls on a single
+// hero banner @ GET /admin/banners/:id/simulate
+func SimulateBanner(c echo.Context) error {
+	var filter methods.HeroBanner
+	var sim gacha.Simulation
+	filter.ID, _ = strconv.Atoi(c.Param("id"))
+	sim.Players, _ = strconv.Atoi(c.QueryParam("players"))
+	sim.Pulls, _ = strconv.Atoi(c.QueryParam("pulls"))
+	sim.Seed, _ = strconv.ParseInt(c.QueryParam("seed"), 10, 64)
+
+	// Get the banner
+	banners, err := filter.Read()
+	if err != nil || len(banners) == 0 {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	report, err := banners[0].Simulate(sim)
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusBadRequest, err)
+	}
+
+	// Return simulation report
+	return c.JSON(http.StatusOK, report)
+}
+
+// UpdateBanner updates a single hero banner
+// @ POST /admin/banners/:id
+func UpdateBanner(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "banner-update"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	banner, err := bindBanner(c)
+	banner.ID, _ = strconv.Atoi(c.Param("id"))
+	if err == nil {
+		err = banner.Update()
+	}
+
+	if err != nil {
+		// Failed to update banner
+		staffLog.Create(false, methods.Error{Details: err, Data: banner})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return banner
+	staffLog.Create(true, methods.Error{Data: banner})
+	return c.JSON(http.StatusOK, banner)
+}
+
+// DeleteBanner deletes a single hero banner that has no summons
+// @ DELETE /admin/banners/:id
+func DeleteBanner(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "banner-delete"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	var banner methods.HeroBanner
+	banner.ID, _ = strconv.Atoi(c.Param("id"))
+
+	if err := banner.Delete(); err != nil {
+		// Failed to delete banner
+		staffLog.Create(false, methods.Error{Details: err, Data: banner})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return banner
+	staffLog.Create(true, methods.Error{Data: banner})
+	return c.JSON(http.StatusOK, banner)
+}
+
+// bindBanner binds the form values of a banner create or update
+// request to a HeroBanner.
+func bindBanner(c echo.Context) (methods.HeroBanner, error) {
+	banner := methods.HeroBanner{
+		Name:       c.FormValue("name"),
+		BannerType: c.FormValue("banner_type"),
+		RunStart:   c.FormValue("run_start"),
+		RunEnd:     c.FormValue("run_end"),
+	}
+	banner.Slot, _ = strconv.Atoi(c.FormValue("slot"))
+	banner.CostCurrencyID, _ = strconv.Atoi(c.FormValue("cost_currency_id"))
+	banner.CostSingle, _ = strconv.Atoi(c.FormValue("cost_single"))
+	banner.CostMulti, _ = strconv.Atoi(c.FormValue("cost_multi"))
+	banner.PitySoftStart, _ = strconv.Atoi(c.FormValue("pity_soft_start"))
+	banner.PitySoftStep, _ = strconv.ParseFloat(c.FormValue("pity_soft_step"), 64)
+	banner.PityHard, _ = strconv.Atoi(c.FormValue("pity_hard"))
+	banner.FeaturedRate, _ = strconv.ParseFloat(c.FormValue("featured_rate"), 64)
+	banner.IsEnabled, _ = strconv.ParseBool(c.FormValue("is_enabled"))
+
+	banner.Spark.CurrencyID, _ = strconv.Atoi(c.FormValue("spark_currency_id"))
+	banner.Spark.PerPull, _ = strconv.Atoi(c.FormValue("spark_per_pull"))
+	banner.Spark.Cost, _ = strconv.Atoi(c.FormValue("spark_cost"))
+	banner.Spark.OnEnd = c.FormValue("spark_on_end")
+	banner.Spark.ConvertCurrencyID, _ = strconv.Atoi(c.FormValue("spark_convert_currency_id"))
+	banner.Spark.ConvertRate, _ = strconv.Atoi(c.FormValue("spark_convert_rate"))
+
+	form, err := c.FormParams()
+	if err != nil {
+		return banner, err
+	}
+
+	featured := map[string]bool{}
+	for _, id := range form["featured"] {
+		featured[id] = true
+	}
+
+	heroes, err := utils.ParseIntPairs(form["heroes"])
+	if err != nil {
+		return banner, err
+	}
+	for _, hero := range heroes {
+		banner.Heroes = append(banner.Heroes, methods.HeroBannerHero{
+			HeroID:     hero[0],
+			Weight:     hero[1],
+			IsFeatured: featured[strconv.Itoa(hero[0])],
+		})
+	}
+
+	for _, pair := range form["rates"] {
+		var rate methods.HeroBannerRate
+
+		parts := strings.SplitN(pair, ":", 2)
+		if len(parts) != 2 {
+			return banner, errors.New("Expected rarity:percent, got " + pair)
+		}
+
+		if rate.Rarity, err = strconv.Atoi(parts[0]); err != nil {
+			return banner, err
+		} else if rate.Rate, err = strconv.ParseFloat(parts[1], 64); err != nil {
+			return banner, err
+		}
+
+		banner.Rates = append(banner.Rates, rate)
+	}
+
+	return banner, nil
+}
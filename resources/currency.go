@@ -1,2 +1,176 @@
 // currency.go manages CRUD operations for currency types.
-package resources
\ No newline at end of file
+package resources
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// IndexCurrency returns a list of all currency types
+// @ GET /admin/currency
+func IndexCurrency(c echo.Context) error {
+	// Bind query parameters to model
+	filter := new(methods.Currency)
+	if err := c.Bind(filter); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.ErrBadRequest
+	}
+
+	// Get all applicable currencies
+	currencies, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return currencies
+	return c.JSON(http.StatusOK, currencies)
+}
+
+// CreateCurrency creates a new currency type
+// @ POST /admin/currency/new
+func CreateCurrency(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "currency-create"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	currency := bindCurrency(c)
+
+	if err := currency.Create(); err != nil {
+		// Failed to create currency
+		staffLog.Create(false, methods.Error{Details: err, Data: currency})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return currency
+	staffLog.Create(true, methods.Error{Data: currency})
+	return c.JSON(http.StatusOK, currency)
+}
+
+// ReadCurrency returns a single currency type
+// @ GET /admin/currency/:id
+func ReadCurrency(c echo.Context) error {
+	var filter methods.Currency
+	filter.ID, _ = strconv.Atoi(c.Param("id"))
+	filter.Locale = c.QueryParam("locale")
+
+	// Get the currency
+	currencies, err := filter.Read()
+	if err != nil || len(currencies) == 0 {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return currency
+	return c.JSON(http.StatusOK, currencies[0])
+}
+
+// UpdateCurrency updates a single currency type
+// @ POST /admin/currency/:id
+func UpdateCurrency(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "currency-update"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	currency := bindCurrency(c)
+	currency.ID, _ = strconv.Atoi(c.Param("id"))
+
+	if err := currency.Update(); err != nil {
+		// Failed to update currency
+		staffLog.Create(false, methods.Error{Details: err, Data: currency})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return currency
+	staffLog.Create(true, methods.Error{Data: currency})
+	return c.JSON(http.StatusOK, currency)
+}
+
+// ReportCurrency returns the outstanding paid (deferred revenue) &
+// free balances of each currency, and their changes between the
+// from & to dates @ GET /admin/currency/report
+func ReportCurrency(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "currency-report"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind query parameters to model
+	filter := new(methods.CurrencyReport)
+	if err := c.Bind(filter); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.ErrBadRequest
+	}
+
+	reports, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return reports
+	return c.JSON(http.StatusOK, reports)
+}
+
+// bindCurrency binds the form values of a currency create or
+// update request to a Currency.
+func bindCurrency(c echo.Context) methods.Currency {
+	currency := methods.Currency{
+		Name:        c.FormValue("name"),
+		URL:         c.FormValue("url"),
+		Description: c.FormValue("description"),
+	}
+	currency.MaxBalance, _ = strconv.Atoi(c.FormValue("max_balance"))
+	currency.SplitPaid, _ = strconv.ParseBool(c.FormValue("split_paid"))
+	currency.SpendPriority = c.FormValue("spend_priority")
+	currency.IsActive, _ = strconv.ParseBool(c.FormValue("is_active"))
+
+	return currency
+}
@@ -0,0 +1,66 @@
+// duplicate.go manages the duplicate policies of each rarity.
+package resources
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+)
+
+// IndexDuplicatePolicies returns the duplicate policy of every rarity
+// @ GET /admin/duplicates
+func IndexDuplicatePolicies(c echo.Context) error {
+	var filter methods.DuplicatePolicy
+
+	// Get all duplicate policies
+	policies, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return policies
+	return c.JSON(http.StatusOK, policies)
+}
+
+// UpdateDuplicatePolicy creates or replaces the duplicate policy of a
+// single rarity @ POST /admin/duplicates/:rarity
+func UpdateDuplicatePolicy(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "duplicate-update"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	policy := methods.DuplicatePolicy{Policy: c.FormValue("policy")}
+	policy.Rarity, _ = strconv.Atoi(c.Param("rarity"))
+	policy.MaxLimitBreak, _ = strconv.Atoi(c.FormValue("max_limit_break"))
+	policy.CurrencyID, _ = strconv.Atoi(c.FormValue("currency_id"))
+	policy.Amount, _ = strconv.Atoi(c.FormValue("amount"))
+
+	if err := policy.Save(); err != nil {
+		// Failed to save policy
+		staffLog.Create(false, methods.Error{Details: err, Data: policy})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return policy
+	staffLog.Create(true, methods.Error{Data: policy})
+	return c.JSON(http.StatusOK, policy)
+}
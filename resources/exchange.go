@@ -0,0 +1,181 @@
+// exchange.go manages CRUD operations for currency exchanges.
+package resources
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/axkeyz/gacha-api/internal/methods"
+	"github.com/axkeyz/gacha-api/internal/utils"
+)
+
+// IndexExchanges returns a list of all currency exchanges
+// @ GET /admin/exchanges
+func IndexExchanges(c echo.Context) error {
+	// Bind query parameters to model
+	filter := new(methods.Exchange)
+	if err := c.Bind(filter); err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.ErrBadRequest
+	}
+
+	// Get all applicable exchanges
+	exchanges, err := filter.Read()
+	if err != nil {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return exchanges
+	return c.JSON(http.StatusOK, exchanges)
+}
+
+// CreateExchange creates a new currency exchange. Inputs & outputs
+// are given as repeated "currency_id:amount" form values, and
+// duplicate hero inputs as repeated "hero_id:amount" hero_inputs
+// @ POST /admin/exchanges/new
+func CreateExchange(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "exchange-create"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	exchange, err := bindExchange(c)
+	if err == nil {
+		err = exchange.Create()
+	}
+
+	if err != nil {
+		// Failed to create exchange
+		staffLog.Create(false, methods.Error{Details: err, Data: exchange})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return exchange
+	staffLog.Create(true, methods.Error{Data: exchange})
+	return c.JSON(http.StatusOK, exchange)
+}
+
+// ReadExchange returns a single currency exchange
+// @ GET /admin/exchanges/:id
+func ReadExchange(c echo.Context) error {
+	var filter methods.Exchange
+	filter.ID, _ = strconv.Atoi(c.Param("id"))
+
+	// Get the exchange
+	exchanges, err := filter.Read()
+	if err != nil || len(exchanges) == 0 {
+		// Return the error
+		c.Logger().Error(err)
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return exchange
+	return c.JSON(http.StatusOK, exchanges[0])
+}
+
+// UpdateExchange updates a single currency exchange
+// @ POST /admin/exchanges/:id
+func UpdateExchange(c echo.Context) error {
+	user := methods.CurrentAuthStaff(c.Get("user"))
+	doAction := "exchange-update"
+
+	// Setup log
+	staffLog := methods.StaffLog{
+		StaffID:     user.ID,
+		StaffAction: methods.StaffAction{Name: doAction},
+		IPAddress:   c.RealIP(),
+	}
+
+	if !user.CanStaff(doAction) {
+		staffLog.Create(false, methods.Error{Message: "Unauthorised"})
+		return echo.ErrUnauthorized
+	}
+
+	// Bind form values to model
+	exchange, err := bindExchange(c)
+	exchange.ID, _ = strconv.Atoi(c.Param("id"))
+	if err == nil {
+		err = exchange.Update()
+	}
+
+	if err != nil {
+		// Failed to update exchange
+		staffLog.Create(false, methods.Error{Details: err, Data: exchange})
+		c.Logger().Error(err)
+
+		return echo.NewHTTPError(http.StatusNotFound, err)
+	}
+
+	// Return exchange
+	staffLog.Create(true, methods.Error{Data: exchange})
+	return c.JSON(http.StatusOK, exchange)
+}
+
+// bindExchange binds the form values of an exchange create or
+// update request to an Exchange.
+func bindExchange(c echo.Context) (methods.Exchange, error) {
+	exchange := methods.Exchange{
+		Name:        c.FormValue("name"),
+		Description: c.FormValue("description"),
+		RunStart:    c.FormValue("run_start"),
+		RunEnd:      c.FormValue("run_end"),
+	}
+	exchange.LimitCount, _ = strconv.Atoi(c.FormValue("limit_count"))
+	exchange.LimitHours, _ = strconv.Atoi(c.FormValue("limit_hours"))
+	exchange.IsActive, _ = strconv.ParseBool(c.FormValue("is_active"))
+
+	form, err := c.FormParams()
+	if err != nil {
+		return exchange, err
+	}
+
+	inputs, err := utils.ParseIntPairs(form["inputs"])
+	if err != nil {
+		return exchange, err
+	}
+	for _, input := range inputs {
+		exchange.Inputs = append(exchange.Inputs, methods.ExchangeItem{
+			CurrencyID: input[0], Amount: input[1],
+		})
+	}
+
+	heroes, err := utils.ParseIntPairs(form["hero_inputs"])
+	if err != nil {
+		return exchange, err
+	}
+	for _, hero := range heroes {
+		exchange.HeroInputs = append(exchange.HeroInputs, methods.ExchangeHero{
+			HeroID: hero[0], Amount: hero[1],
+		})
+	}
+
+	outputs, err := utils.ParseIntPairs(form["outputs"])
+	if err != nil {
+		return exchange, err
+	}
+	for _, output := range outputs {
+		exchange.Outputs = append(exchange.Outputs, methods.ExchangeItem{
+			CurrencyID: output[0], Amount: output[1],
+		})
+	}
+
+	return exchange, nil
+}